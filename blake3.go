@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// blake3 相关常量，见 BLAKE3 规范
+const (
+	blake3BlockLen   = 64
+	blake3ChunkLen   = 1024
+	blake3ChunkStart = 1 << 0
+	blake3ChunkEnd   = 1 << 1
+	blake3Parent     = 1 << 2
+	blake3Root       = 1 << 3
+)
+
+var blake3IV = [8]uint32{0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19}
+
+var blake3Permutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+// blake3Compress BLAKE3 压缩函数
+func blake3Compress(cv [8]uint32, block [16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	g := func(a, b, c, d int, mx, my uint32) {
+		s[a] += s[b] + mx
+		s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+		s[c] += s[d]
+		s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+		s[a] += s[b] + my
+		s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+		s[c] += s[d]
+		s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+	}
+	m := block
+	for round := 0; round < 7; round++ {
+		g(0, 4, 8, 12, m[0], m[1])
+		g(1, 5, 9, 13, m[2], m[3])
+		g(2, 6, 10, 14, m[4], m[5])
+		g(3, 7, 11, 15, m[6], m[7])
+		g(0, 5, 10, 15, m[8], m[9])
+		g(1, 6, 11, 12, m[10], m[11])
+		g(2, 7, 8, 13, m[12], m[13])
+		g(3, 4, 9, 14, m[14], m[15])
+		var permuted [16]uint32
+		for i, j := range blake3Permutation {
+			permuted[i] = m[j]
+		}
+		m = permuted
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+// blake3Words 将 64 字节的块按小端序转换为 16 个字
+func blake3Words(b []byte) [16]uint32 {
+	var buf [blake3BlockLen]byte
+	copy(buf[:], b)
+	var w [16]uint32
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(buf[i*4:])
+	}
+	return w
+}
+
+// blake3Output 尚未压缩的最后一个块，用于求链值或根输出
+type blake3Output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o blake3Output) chainingValue() [8]uint32 {
+	var cv [8]uint32
+	out := blake3Compress(o.cv, o.block, o.counter, o.blockLen, o.flags)
+	copy(cv[:], out[:8])
+	return cv
+}
+
+// blake3Hasher 实现 hash.Hash 的 BLAKE3 哈希（默认模式，32 字节输出）
+type blake3Hasher struct {
+	cv               [8]uint32 // 当前块的链值
+	chunkCounter     uint64
+	block            [blake3BlockLen]byte
+	blockLen         int
+	blocksCompressed int
+	cvStack          [][8]uint32
+}
+
+// newBLAKE3 创建 BLAKE3 哈希
+func newBLAKE3() hash.Hash {
+	h := &blake3Hasher{}
+	h.Reset()
+	return h
+}
+
+func (h *blake3Hasher) Reset() {
+	*h = blake3Hasher{cv: blake3IV}
+}
+
+func (h *blake3Hasher) Size() int      { return 32 }
+func (h *blake3Hasher) BlockSize() int { return blake3BlockLen }
+
+// chunkLen 当前块中已输入的字节数
+func (h *blake3Hasher) chunkLen() int {
+	return h.blocksCompressed*blake3BlockLen + h.blockLen
+}
+
+func (h *blake3Hasher) startFlag() uint32 {
+	if h.blocksCompressed == 0 {
+		return blake3ChunkStart
+	}
+	return 0
+}
+
+// chunkOutput 当前块的输出
+func (h *blake3Hasher) chunkOutput() blake3Output {
+	return blake3Output{
+		cv:       h.cv,
+		block:    blake3Words(h.block[:h.blockLen]),
+		counter:  h.chunkCounter,
+		blockLen: uint32(h.blockLen),
+		flags:    h.startFlag() | blake3ChunkEnd,
+	}
+}
+
+// parentOutput 由左右两个子节点链值组成的父节点输出
+func blake3ParentOutput(left, right [8]uint32) blake3Output {
+	var block [16]uint32
+	copy(block[:8], left[:])
+	copy(block[8:], right[:])
+	return blake3Output{cv: blake3IV, block: block, blockLen: blake3BlockLen, flags: blake3Parent}
+}
+
+// addChunkChainingValue 将完成的块链值压入栈中，并合并所有完整的子树
+func (h *blake3Hasher) addChunkChainingValue(cv [8]uint32, totalChunks uint64) {
+	for totalChunks&1 == 0 {
+		left := h.cvStack[len(h.cvStack)-1]
+		h.cvStack = h.cvStack[:len(h.cvStack)-1]
+		cv = blake3ParentOutput(left, cv).chainingValue()
+		totalChunks >>= 1
+	}
+	h.cvStack = append(h.cvStack, cv)
+}
+
+func (h *blake3Hasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// 当前块已满且还有输入时结束该块
+		if h.chunkLen() == blake3ChunkLen {
+			cv := h.chunkOutput().chainingValue()
+			total := h.chunkCounter + 1
+			h.addChunkChainingValue(cv, total)
+			h.cv, h.chunkCounter, h.blockLen, h.blocksCompressed = blake3IV, total, 0, 0
+		}
+		// 缓冲区已满且还有输入时压缩缓冲区
+		if h.blockLen == blake3BlockLen {
+			out := blake3Compress(h.cv, blake3Words(h.block[:]), h.chunkCounter, blake3BlockLen, h.startFlag())
+			copy(h.cv[:], out[:8])
+			h.blocksCompressed++
+			h.blockLen = 0
+		}
+		want := blake3BlockLen - h.blockLen
+		if rest := blake3ChunkLen - h.chunkLen(); rest < want {
+			want = rest
+		}
+		if want > len(p) {
+			want = len(p)
+		}
+		copy(h.block[h.blockLen:], p[:want])
+		h.blockLen += want
+		p = p[want:]
+	}
+	return n, nil
+}
+
+func (h *blake3Hasher) Sum(b []byte) []byte {
+	out := h.chunkOutput()
+	for i := len(h.cvStack) - 1; i >= 0; i-- {
+		out = blake3ParentOutput(h.cvStack[i], out.chainingValue())
+	}
+	words := blake3Compress(out.cv, out.block, 0, out.blockLen, out.flags|blake3Root)
+	var digest [32]byte
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(digest[i*4:], words[i])
+	}
+	return append(b, digest[:]...)
+}
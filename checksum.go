@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checksumAlgorithm 校验和算法及其附属文件命名
+type checksumAlgorithm struct {
+	ext      string // 单个压缩包附属文件的扩展名
+	sumsFile string // 输出目录中汇总文件的文件名
+	newHash  func() hash.Hash
+}
+
+// checksumAlgorithms 支持的校验和算法，文件格式与 sha256sum/b3sum 兼容
+var checksumAlgorithms = map[string]checksumAlgorithm{
+	"sha256": {ext: ".sha256", sumsFile: "SHA256SUMS", newHash: sha256.New},
+	"blake3": {ext: ".b3", sumsFile: "B3SUMS", newHash: newBLAKE3},
+}
+
+// fileChecksum 计算 fsys 中文件 name 的校验和，返回十六进制字符串
+func fileChecksum(fsys fs.FS, name string, newHash func() hash.Hash) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksum 按设置为 fsys 中的压缩包 name 生成附属校验和文件，或更新同目录中的汇总文件，返回写入的文件
+func writeChecksum(fsys writableFS, name string, opts packOptions) (string, error) {
+	algo := checksumAlgorithms[opts.ChecksumAlgorithm]
+	sum, err := fileChecksum(fsys, name, algo.newHash)
+	if err != nil {
+		return "", err
+	}
+	if opts.Checksums == "sidecar" {
+		sidecar := name + algo.ext
+		return sidecar, writeFile(fsys, sidecar, []byte(sum+"  "+path.Base(name)+"\n"), 0666)
+	}
+	sumsFile := path.Join(path.Dir(name), algo.sumsFile)
+	return sumsFile, updateSumsFile(fsys, sumsFile, path.Base(name), sum)
+}
+
+// refreshChecksums 重新计算 fsys 中压缩包 name 已有的附属校验和文件和汇总文件中的记录，补充压缩包后调用，返回更新过的文件
+func refreshChecksums(fsys writableFS, name string) ([]string, error) {
+	base := path.Base(name)
+	var updated []string
+	for _, algo := range checksumAlgorithms {
+		sidecar := name + algo.ext
+		sumsFile := path.Join(path.Dir(name), algo.sumsFile)
+		_, sidecarErr := fsys.Stat(sidecar)
+		listed, _ := readChecksumFile(fsys, sumsFile, algo, base)
+		if sidecarErr != nil && len(listed) == 0 {
+			continue
+		}
+		sum, err := fileChecksum(fsys, name, algo.newHash)
+		if err != nil {
+			return updated, err
+		}
+		if sidecarErr == nil {
+			if err := writeFile(fsys, sidecar, []byte(sum+"  "+base+"\n"), 0666); err != nil {
+				return updated, err
+			}
+			updated = append(updated, sidecar)
+		}
+		if len(listed) > 0 {
+			if err := updateSumsFile(fsys, sumsFile, base, sum); err != nil {
+				return updated, err
+			}
+			updated = append(updated, sumsFile)
+		}
+	}
+	return updated, nil
+}
+
+// updateSumsFile 在 fsys 中的汇总文件 sumsFile 中写入或替换文件 name 的校验和，sum 为空时只删除该文件的记录
+// （没有记录时删除汇总文件），通过临时文件和重命名保证文件完整
+func updateSumsFile(fsys writableFS, sumsFile, name, sum string) error {
+	var lines []string
+	data, err := fs.ReadFile(fsys, sumsFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, lineName, ok := parseChecksumLine(line); ok && lineName == name {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if sum != "" {
+		lines = append(lines, sum+"  "+name)
+	}
+	if len(lines) == 0 {
+		return fsys.Remove(sumsFile)
+	}
+	return replaceFile(fsys, sumsFile, []byte(strings.Join(lines, "\n")+"\n"), 0666)
+}
+
+// parseChecksumLine 解析 sha256sum 格式的一行："<校验和>  <文件名>" 或 "<校验和> *<文件名>"
+func parseChecksumLine(line string) (string, string, bool) {
+	sum, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+	if !ok || sum == "" || strings.HasPrefix(sum, "#") {
+		return "", "", false
+	}
+	if len(name) > 0 && (name[0] == ' ' || name[0] == '*') {
+		name = name[1:]
+	}
+	return strings.ToLower(sum), name, name != ""
+}
+
+// checksumEntry 校验和文件中的一条记录
+type checksumEntry struct {
+	listFile string // 记录所在的校验和文件
+	algo     checksumAlgorithm
+	sum      string
+	target   string // 被校验文件的路径
+}
+
+// readChecksumFile 读取 fsys 中附属文件或汇总文件 name 的所有记录，only 不为空时只返回该文件名的记录
+func readChecksumFile(fsys fs.FS, name string, algo checksumAlgorithm, only string) ([]checksumEntry, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []checksumEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		sum, target, ok := parseChecksumLine(line)
+		if !ok || (only != "" && target != only) {
+			continue
+		}
+		entries = append(entries, checksumEntry{listFile: fsPath(fsys, name), algo: algo, sum: sum, target: fsPath(fsys, path.Join(path.Dir(name), filepath.ToSlash(target)))})
+	}
+	return entries, nil
+}
+
+// checksumFileAlgorithm 根据文件名判断是否为校验和文件，返回对应的算法
+func checksumFileAlgorithm(name string) (checksumAlgorithm, bool) {
+	for _, algo := range checksumAlgorithms {
+		if name == algo.sumsFile || strings.HasSuffix(name, algo.ext) {
+			return algo, true
+		}
+	}
+	return checksumAlgorithm{}, false
+}
+
+// findChecksums 收集参数对应的校验和记录：目录中递归查找所有校验和文件，
+// 普通文件则查找其附属文件和同目录汇总文件中的记录
+func findChecksums(args []string) ([]checksumEntry, error) {
+	var entries []checksumEntry
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			err = filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if d.Name() == trashDirName {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if algo, ok := checksumFileAlgorithm(d.Name()); ok {
+					dir, name := localFile(path)
+					found, err := readChecksumFile(dir, name, algo, "")
+					if err != nil {
+						return err
+					}
+					entries = append(entries, found...)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if algo, ok := checksumFileAlgorithm(filepath.Base(arg)); ok {
+			dir, name := localFile(arg)
+			found, err := readChecksumFile(dir, name, algo, "")
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, found...)
+			continue
+		}
+		dir, name := localFile(arg)
+		for _, algo := range checksumAlgorithms {
+			for _, list := range []string{name + algo.ext, algo.sumsFile} {
+				found, err := readChecksumFile(dir, list, algo, name)
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+				entries = append(entries, found...)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// verifyChecksums 重新计算每条记录对应文件的校验和并比对，有任何不一致或文件缺失时返回错误
+func verifyChecksums(entries []checksumEntry) error {
+	failed := 0
+	for _, entry := range entries {
+		start := time.Now()
+		dir, name := localFile(entry.target)
+		sum, err := fileChecksum(dir, name, entry.algo.newHash)
+		switch {
+		case err != nil:
+			failed++
+			logger.Error("verify failed", "src", entry.target, "list", entry.listFile, "err", err)
+		case sum != entry.sum:
+			failed++
+			logger.Error("verify failed", "src", entry.target, "list", entry.listFile, "err", msg("verify.mismatch", sum, entry.sum))
+		default:
+			logger.Info("verify ok", "src", entry.target, "list", entry.listFile, "duration", time.Since(start))
+		}
+	}
+	fmt.Fprintln(statusOut, msg("summary.verified", len(entries), failed))
+	if failed > 0 {
+		return errors.New(msg("error.verifyFailed", failed))
+	}
+	if len(entries) == 0 {
+		return errors.New(msg("error.noChecksums"))
+	}
+	return nil
+}
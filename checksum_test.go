@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// packForChecksums 在 dir 中放入 n 个文件，按每批一个文件打包并生成校验和文件
+func packForChecksums(t *testing.T, dir string, n int, checksums, algorithm string) packOptions {
+	t.Helper()
+	for i := range n {
+		name := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if err := os.WriteFile(name, []byte(strings.Repeat("x", i+1)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := defaultPackOptions()
+	opts.MaxFiles = 1
+	opts.Checksums = checksums
+	opts.ChecksumAlgorithm = algorithm
+	if _, err := organizeFilesAndCompress(dirFS(dir), opts); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// TestWriteChecksumSidecar sidecar 方式为每个压缩包写入与 sha256sum 格式兼容的附属文件
+func TestWriteChecksumSidecar(t *testing.T) {
+	defer func(w io.Writer) { statusOut = w }(statusOut)
+	statusOut = io.Discard
+	dir := t.TempDir()
+	opts := packForChecksums(t, dir, 2, "sidecar", "sha256")
+	for _, n := range []string{"1", "2"} {
+		zipPath := filepath.Join(dir, opts.Prefix+n+".zip")
+		data, err := os.ReadFile(zipPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		want := hex.EncodeToString(sum[:]) + "  " + opts.Prefix + n + ".zip\n"
+		if got, err := os.ReadFile(zipPath + ".sha256"); err != nil || string(got) != want {
+			t.Errorf("sidecar %s = %q, %v, want %q", n, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "SHA256SUMS")); !os.IsNotExist(err) {
+		t.Errorf("sidecar mode wrote SHA256SUMS: %v", err)
+	}
+}
+
+// TestWriteChecksumSums sums 方式把所有压缩包的记录写入同一个汇总文件，重复写入时替换原有记录
+func TestWriteChecksumSums(t *testing.T) {
+	defer func(w io.Writer) { statusOut = w }(statusOut)
+	statusOut = io.Discard
+	dir := t.TempDir()
+	opts := packForChecksums(t, dir, 3, "sums", "blake3")
+	sumsPath := filepath.Join(dir, "B3SUMS")
+	data, err := os.ReadFile(sumsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("B3SUMS = %q", data)
+	}
+	for i, line := range lines {
+		sum, name, ok := parseChecksumLine(line)
+		if !ok || len(sum) != 64 || name != opts.Prefix+string(rune('1'+i))+".zip" {
+			t.Errorf("line %d = %q", i, line)
+		}
+	}
+
+	if _, err := writeChecksum(dirFS(dir), opts.Prefix+"2.zip", opts); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(sumsPath); strings.Count(string(again), opts.Prefix+"2.zip") != 1 || len(again) != len(data) {
+		t.Errorf("rewritten B3SUMS = %q", again)
+	}
+	if err := updateSumsFile(dirFS(dir), "B3SUMS", opts.Prefix+"1.zip", ""); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(sumsPath); strings.Contains(string(again), opts.Prefix+"1.zip") {
+		t.Errorf("record not removed: %q", again)
+	}
+}
+
+func TestParseChecksumLine(t *testing.T) {
+	for _, tt := range []struct {
+		line, sum, name string
+		ok              bool
+	}{
+		{"ABCD  a.zip", "abcd", "a.zip", true},
+		{"abcd *a b.zip\r", "abcd", "a b.zip", true},
+		{"# comment", "", "", false},
+		{"abcd", "", "", false},
+		{"abcd  ", "", "", false},
+	} {
+		sum, name, ok := parseChecksumLine(tt.line)
+		if ok != tt.ok || ok && (sum != tt.sum || name != tt.name) {
+			t.Errorf("parseChecksumLine(%q) = %q, %q, %v", tt.line, sum, name, ok)
+		}
+	}
+}
+
+// TestVerifyChecksums verify 在目录中找到附属文件和汇总文件中的记录，文件被改动或缺失时报错，
+// 参数为压缩包时只检查它自己的记录
+func TestVerifyChecksums(t *testing.T) {
+	defer func(w io.Writer) { statusOut = w }(statusOut)
+	defer func(l string) { locale = l }(locale)
+	locale, statusOut = "en", io.Discard
+	dir := t.TempDir()
+	opts := packForChecksums(t, dir, 2, "sidecar", "sha256")
+	opts.Checksums = "sums"
+	if _, err := writeChecksum(dirFS(dir), opts.Prefix+"1.zip", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := findChecksums([]string{dir})
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("findChecksums(dir) = %+v, %v", entries, err)
+	}
+	if err := verifyChecksums(entries); err != nil {
+		t.Errorf("untouched archives: %v", err)
+	}
+
+	first := filepath.Join(dir, opts.Prefix+"1.zip")
+	entries, err = findChecksums([]string{first})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("findChecksums(archive) = %+v, %v", entries, err)
+	}
+	for _, entry := range entries {
+		if entry.target != first {
+			t.Errorf("entry for %s", entry.target)
+		}
+	}
+
+	if err := os.WriteFile(first, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, opts.Prefix+"2.zip")); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = findChecksums([]string{dir})
+	if err := verifyChecksums(entries); err == nil || !strings.Contains(err.Error(), "3 file(s)") {
+		t.Errorf("changed and missing archives: %v", err)
+	}
+	if err := verifyChecksums(nil); err == nil || !strings.Contains(err.Error(), "no checksum files") {
+		t.Errorf("no entries: %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// codePage 旧式 Windows 双字节代码页，用于没有 UTF-8 标记的 zip 条目名。
+// 映射表由 codepages/gen.go 根据 Unicode 发布的 Microsoft CP936.TXT/CP932.TXT 生成，按代码从小到大记录每个字符，
+// 每项是两个 uvarint：与上一项的代码差减一、与上一项的码位差减一（zigzag 编码），整体以 raw DEFLATE 压缩
+type codePage struct {
+	data   string
+	weight func(code uint16) int // 检测编码时字符的得分，常用字为正，罕用或自定义区为负
+
+	once   sync.Once
+	err    error // 映射表损坏时的错误，load 后有效
+	decode map[uint16]rune
+	encode map[rune]uint16
+	lead   [256]bool
+}
+
+//go:generate go run codepages/gen.go
+
+//go:embed codepages/cp936.bin
+var cp936Table string
+
+//go:embed codepages/cp932.bin
+var cp932Table string
+
+// codePages 支持的旧式代码页，键为 -name-encoding 的取值
+var codePages = map[string]*codePage{
+	"gbk":       {data: cp936Table, weight: gbkWeight},
+	"shift-jis": {data: cp932Table, weight: shiftJISWeight},
+}
+
+// nameEncodingAliases 编码名称的其他写法
+var nameEncodingAliases = map[string]string{
+	"utf8":      "utf-8",
+	"cp936":     "gbk",
+	"gb2312":    "gbk",
+	"sjis":      "shift-jis",
+	"shift_jis": "shift-jis",
+	"cp932":     "shift-jis",
+}
+
+// normalizeNameEncoding 统一编码名称的写法
+func normalizeNameEncoding(name string) string {
+	name = strings.ToLower(name)
+	if alias, ok := nameEncodingAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// load 解压并检查映射表，只在第一次调用时执行，之后返回同样的结果
+func (cp *codePage) load() error {
+	cp.once.Do(func() {
+		cp.err = cp.parse()
+	})
+	return cp.err
+}
+
+func (cp *codePage) parse() error {
+	data, err := io.ReadAll(flate.NewReader(strings.NewReader(cp.data)))
+	if err != nil {
+		return err
+	}
+	decode := make(map[uint16]rune)
+	encode := make(map[rune]uint16)
+	var lead [256]bool
+	code, r := int64(0), int64(0)
+	for len(data) > 0 {
+		codeDelta, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("truncated code")
+		}
+		data = data[n:]
+		runeDelta, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("truncated code point")
+		}
+		data = data[n:]
+		delta := int64(runeDelta >> 1)
+		if runeDelta&1 != 0 {
+			delta = ^delta
+		}
+		code += int64(codeDelta) + 1
+		r += delta + 1
+		if code > 0xFFFF || code < 0x80 {
+			return fmt.Errorf("code 0x%X out of range", code)
+		}
+		if r < 0x80 || r > utf8.MaxRune || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("code 0x%X maps to invalid code point U+%04X", code, r)
+		}
+		decode[uint16(code)] = rune(r)
+		if _, ok := encode[rune(r)]; !ok { // 同一字符有多个代码时使用最小的，与 Windows 一致
+			encode[rune(r)] = uint16(code)
+		}
+		if code > 0xFF {
+			lead[code>>8] = true
+		}
+	}
+	for c := 0; c < 0x100; c++ {
+		if _, ok := decode[uint16(c)]; ok && lead[c] {
+			return fmt.Errorf("0x%02X is both a character and a lead byte", c)
+		}
+	}
+	if len(decode) == 0 {
+		return errors.New("empty table")
+	}
+	cp.decode, cp.encode, cp.lead = decode, encode, lead
+	return nil
+}
+
+// loadCodePages 在启动时解压并检查全部代码页映射表，嵌入的数据损坏时立即报错，
+// 而不是等到处理非 UTF-8 的条目名时才出现
+func loadCodePages() error {
+	for name, cp := range codePages {
+		if err := cp.load(); err != nil {
+			return errors.New(msg("error.codePage", name, err))
+		}
+	}
+	return nil
+}
+
+// decodeString 把代码页中的字节串转换为 UTF-8，遇到无效的字节或映射表损坏时返回 false
+func (cp *codePage) decodeString(s string) (string, bool) {
+	if cp.load() != nil {
+		return "", false
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x80 {
+			sb.WriteByte(c)
+			continue
+		}
+		code := uint16(c)
+		if cp.lead[c] {
+			if i+1 >= len(s) {
+				return "", false
+			}
+			i++
+			code = code<<8 | uint16(s[i])
+		}
+		r, ok := cp.decode[code]
+		if !ok {
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), true
+}
+
+// encodeString 把 UTF-8 字符串转换为代码页中的字节串，有字符无法表示或映射表损坏时返回 false
+func (cp *codePage) encodeString(s string) (string, bool) {
+	if cp.load() != nil {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if r < 0x80 {
+			sb.WriteByte(byte(r))
+			continue
+		}
+		code, ok := cp.encode[r]
+		if !ok {
+			return "", false
+		}
+		if code > 0xFF {
+			sb.WriteByte(byte(code >> 8))
+		}
+		sb.WriteByte(byte(code))
+	}
+	return sb.String(), true
+}
+
+// score 按代码页解码全部名称并累计字符得分，有名称无法解码时返回 false
+func (cp *codePage) score(names []string) (int, bool) {
+	if cp.load() != nil {
+		return 0, false
+	}
+	total := 0
+	for _, name := range names {
+		if _, ok := cp.decodeString(name); !ok {
+			return 0, false
+		}
+		for i := 0; i < len(name); i++ {
+			c := name[i]
+			if c < 0x80 {
+				continue
+			}
+			code := uint16(c)
+			if cp.lead[c] {
+				i++
+				code = code<<8 | uint16(name[i])
+			}
+			total += cp.weight(code)
+		}
+	}
+	return total, true
+}
+
+// gbkWeight GB2312 的汉字和符号区最常见，GBK 扩展区、自定义区和单字节字符较少出现在文件名中
+func gbkWeight(code uint16) int {
+	lead, trail := code>>8, code&0xFF
+	switch {
+	case lead >= 0xB0 && lead <= 0xF7 && trail >= 0xA1:
+		return 2
+	case lead >= 0xA1 && lead <= 0xA9 && trail >= 0xA1:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// shiftJISWeight 假名、全角符号和第一水准汉字最常见，半角片假名和 NEC/IBM 扩展较少出现在文件名中
+func shiftJISWeight(code uint16) int {
+	switch {
+	case code >= 0x8140 && code <= 0x84BE, code >= 0x889F && code <= 0x9872:
+		return 2
+	case code >= 0x989F && code <= 0xEAA4:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// unicodePathExtraID Info-ZIP Unicode Path 扩展字段，其中保存条目名的 UTF-8 形式
+const unicodePathExtraID = 0x7075
+
+// zipUnicodePath 读取条目的 Unicode Path 扩展字段，字段中的 CRC32 与当前的条目名不符时忽略
+func zipUnicodePath(file *zip.File) (string, bool) {
+	extra := file.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		field := extra[:size]
+		extra = extra[size:]
+		if id != unicodePathExtraID || len(field) < 5 || field[0] != 1 {
+			continue
+		}
+		if binary.LittleEndian.Uint32(field[1:]) != crc32.ChecksumIEEE([]byte(file.Name)) || !utf8.Valid(field[5:]) {
+			continue
+		}
+		return string(field[5:]), true
+	}
+	return "", false
+}
+
+// isASCII 判断字符串是否只含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// detectNameEncoding 检测没有 UTF-8 标记的条目名使用的编码：全部是有效的 UTF-8 时按 UTF-8 处理，
+// 否则选择能解码全部名称且得分最高的代码页，得分相同时优先 GBK
+func detectNameEncoding(names []string) string {
+	allUTF8 := true
+	for _, name := range names {
+		if !utf8.ValidString(name) {
+			allUTF8 = false
+			break
+		}
+	}
+	if allUTF8 {
+		return "utf-8"
+	}
+	best, bestScore := "utf-8", math.MinInt
+	for _, encoding := range []string{"gbk", "shift-jis"} {
+		score, ok := codePages[encoding].score(names)
+		if ok && score > bestScore {
+			best, bestScore = encoding, score
+		}
+	}
+	return best
+}
+
+// zipEntryNames 返回压缩包条目名的 UTF-8 形式：优先使用 Unicode Path 扩展字段，
+// 有 UTF-8 标记或只含 ASCII 的名称保持不变，其余名称按 encoding 解码，auto 时按这些名称检测编码
+func zipEntryNames(files []*zip.File, encoding string) []string {
+	names := make([]string, len(files))
+	var legacy []int
+	var raw []string
+	for i, file := range files {
+		names[i] = file.Name
+		if name, ok := zipUnicodePath(file); ok {
+			names[i] = name
+			continue
+		}
+		if file.Flags&0x800 != 0 || isASCII(file.Name) {
+			continue
+		}
+		legacy = append(legacy, i)
+		raw = append(raw, file.Name)
+	}
+	if len(legacy) == 0 {
+		return names
+	}
+	if encoding == "auto" {
+		encoding = detectNameEncoding(raw)
+		logger.Debug("detect name encoding", "encoding", encoding, "names", len(raw))
+	}
+	cp := codePages[encoding]
+	if cp == nil {
+		return names
+	}
+	for _, i := range legacy {
+		name, ok := cp.decodeString(files[i].Name)
+		if !ok {
+			logger.Warn("decode entry name failed", "entry", fmt.Sprintf("%q", files[i].Name), "encoding", encoding)
+			continue
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// setZipEntryName 按 encoding 设置条目名：utf-8 时明确设置 UTF-8 标记；使用旧式代码页时写入该代码页的名称，
+// 供不支持 UTF-8 标记的旧版资源管理器使用，同时在 Unicode Path 扩展字段中保留 UTF-8 名称。
+// 名称无法用该代码页表示时仍按 UTF-8 写入
+func setZipEntryName(header *zip.FileHeader, name, encoding string) {
+	header.Name = name
+	cp := codePages[encoding]
+	if cp == nil {
+		header.Flags |= 0x800
+		return
+	}
+	if isASCII(name) {
+		return
+	}
+	encoded, ok := cp.encodeString(name)
+	if !ok {
+		logger.Warn("encode entry name failed, using utf-8", "entry", name, "encoding", encoding)
+		header.Flags |= 0x800
+		return
+	}
+	field := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(field, unicodePathExtraID)
+	binary.LittleEndian.PutUint16(field[2:], uint16(5+len(name)))
+	field[4] = 1
+	binary.LittleEndian.PutUint32(field[5:], crc32.ChecksumIEEE([]byte(encoded)))
+	header.Name = encoded
+	header.NonUTF8 = true
+	header.Extra = append(header.Extra, append(field, name...)...)
+}
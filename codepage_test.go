@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCodePageStrings(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		encoded  string // 十六进制
+	}{
+		{"gbk", "测试文件.txt", "b2e2cad4cec4bcfe2e747874"},
+		{"gbk", "报告/数据表.csv", "b1a8b8e62fcafdbeddb1ed2e637376"},
+		{"gbk", "€", "80"},
+		{"shift-jis", "テスト.txt", "8365835883672e747874"},
+		{"shift-jis", "表示", "955c8ea6"}, // 第二个字节是反斜杠
+		{"shift-jis", "ｶﾅ", "b6c5"},     // 半角片假名是单字节
+	}
+	for _, tt := range tests {
+		cp := codePages[tt.encoding]
+		encoded, ok := cp.encodeString(tt.text)
+		if !ok || hex.EncodeToString([]byte(encoded)) != tt.encoded {
+			t.Errorf("%s encode %q = %x, %v, want %s", tt.encoding, tt.text, encoded, ok, tt.encoded)
+		}
+		raw, _ := hex.DecodeString(tt.encoded)
+		decoded, ok := cp.decodeString(string(raw))
+		if !ok || decoded != tt.text {
+			t.Errorf("%s decode %s = %q, %v, want %q", tt.encoding, tt.encoded, decoded, ok, tt.text)
+		}
+	}
+
+	for _, encoding := range []string{"gbk", "shift-jis"} {
+		cp := codePages[encoding]
+		if _, ok := cp.encodeString("😀"); ok {
+			t.Errorf("%s encoded a character outside the code page", encoding)
+		}
+		if _, ok := cp.decodeString("\x81"); ok {
+			t.Errorf("%s decoded a truncated double-byte character", encoding)
+		}
+	}
+}
+
+// TestCodePageRoundTrip 对表中的每个代码：解码后再编码、再解码得到同一字符。
+// 多个代码对应同一字符时编码使用其中之一，所以不要求得到原来的代码
+func TestCodePageRoundTrip(t *testing.T) {
+	for encoding, cp := range codePages {
+		codes := 0
+		for code := 0x80; code <= 0xFFFF; code++ {
+			raw := string([]byte{byte(code)})
+			if code > 0xFF {
+				raw = string([]byte{byte(code >> 8), byte(code)})
+			}
+			decoded, ok := cp.decodeString(raw)
+			if !ok || (code > 0xFF) != (len(raw) == 2) {
+				continue
+			}
+			codes++
+			encoded, ok := cp.encodeString(decoded)
+			if !ok {
+				t.Errorf("%s: %q (%x) cannot be encoded", encoding, decoded, raw)
+				continue
+			}
+			if again, ok := cp.decodeString(encoded); !ok || again != decoded {
+				t.Errorf("%s: %x -> %q -> %x -> %q", encoding, raw, decoded, encoded, again)
+			}
+		}
+		if codes < 5000 {
+			t.Errorf("%s: only %d codes decoded", encoding, codes)
+		}
+	}
+}
+
+func TestDetectNameEncoding(t *testing.T) {
+	encode := func(encoding string, names ...string) []string {
+		var out []string
+		for _, name := range names {
+			encoded, ok := codePages[encoding].encodeString(name)
+			if !ok {
+				t.Fatalf("%s cannot encode %q", encoding, name)
+			}
+			out = append(out, encoded)
+		}
+		return out
+	}
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"测试.txt", "报告/数据.csv"}, "utf-8"},
+		{encode("gbk", "测试文件.txt", "报告/数据表.csv"), "gbk"},
+		{encode("gbk", "会议纪要.docx"), "gbk"},
+		{encode("shift-jis", "テスト.txt", "資料/表計算.xls"), "shift-jis"},
+		{encode("shift-jis", "表示.txt"), "shift-jis"},
+	}
+	for _, tt := range tests {
+		if got := detectNameEncoding(tt.names); got != tt.want {
+			t.Errorf("detectNameEncoding(%q) = %s, want %s", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestNameEncodingOption(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // 为空表示应拒绝
+	}{
+		{"UTF8", "utf-8"},
+		{"GBK", "gbk"},
+		{"cp936", "gbk"},
+		{"gb2312", "gbk"},
+		{"Shift_JIS", "shift-jis"},
+		{"cp932", "shift-jis"},
+		{"gb18030", ""}, // 四字节序列不在 GBK 中
+		{"big5", ""},
+	}
+	for _, tt := range tests {
+		opts := defaultPackOptions()
+		if err := (nameEncodingFlag{&opts.NameEncoding}).Set(tt.value); err != nil {
+			t.Fatal(err)
+		}
+		err := opts.validate()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("-name-encoding %s accepted as %q", tt.value, opts.NameEncoding)
+			}
+			continue
+		}
+		if err != nil || opts.NameEncoding != tt.want {
+			t.Errorf("-name-encoding %s = %q, %v, want %q", tt.value, opts.NameEncoding, err, tt.want)
+		}
+	}
+}
+
+// TestCodePageLoad 嵌入的映射表都能通过检查，损坏的映射表返回错误而不是 panic
+func TestCodePageLoad(t *testing.T) {
+	if err := loadCodePages(); err != nil {
+		t.Fatal(err)
+	}
+	deflate := func(raw []byte) string {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(raw)
+		w.Close()
+		return buf.String()
+	}
+	// 每项为代码差减一、码位差减一的 zigzag 编码
+	entry := func(raw []byte, codeDelta uint64, runeDelta int64) []byte {
+		raw = binary.AppendUvarint(raw, codeDelta)
+		return binary.AppendUvarint(raw, uint64(runeDelta<<1^runeDelta>>63))
+	}
+	valid := entry(nil, 0x80-1, 0x20AC-1) // 0x80 → €
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not deflate", "\xff\xff\xff"},
+		{"empty", deflate(nil)},
+		{"truncated", deflate(append(append([]byte{}, valid...), 0x85))},
+		{"ascii code", deflate(entry(nil, 0x41-1, 0x41-1))},
+		{"surrogate", deflate(entry(nil, 0x8140-1, 0xD800-1))},
+		{"code overflow", deflate(entry(valid, 0x10000, 0))},
+		{"lead conflict", deflate(entry(valid, 0x8040-0x80-1, 0x4E00-0x20AC-1))},
+	}
+	for _, tt := range tests {
+		cp := &codePage{data: tt.data, weight: gbkWeight}
+		if err := cp.load(); err == nil {
+			t.Errorf("%s: load succeeded", tt.name)
+		}
+		if _, ok := cp.decodeString("\x80"); ok {
+			t.Errorf("%s: decoded with a corrupt table", tt.name)
+		}
+		if _, ok := cp.score([]string{"a"}); ok {
+			t.Errorf("%s: scored with a corrupt table", tt.name)
+		}
+	}
+	cp := &codePage{data: deflate(valid)}
+	if got, ok := cp.decodeString("\x80"); !ok || got != "€" {
+		t.Errorf("valid table: decode = %q, %v", got, ok)
+	}
+}
@@ -0,0 +1,146 @@
+//go:build ignore
+
+// gen 根据 Unicode 发布的 Microsoft 代码页映射表生成 cp936.bin 和 cp932.bin，在仓库根目录运行 go generate。
+//
+// 数据来源（Unicode, Inc. 提供的 Windows 代码页最佳匹配以外的精确映射）：
+//
+//	https://www.unicode.org/Public/MAPPINGS/VENDORS/MICSFT/WINDOWS/CP936.TXT
+//	https://www.unicode.org/Public/MAPPINGS/VENDORS/MICSFT/WINDOWS/CP932.TXT
+//
+// 每行为 "0x代码<TAB>0x码位<TAB>#名称"，没有码位的行（未定义或前导字节）被忽略。
+// 无法访问 unicode.org 时可以用 -cp936、-cp932 指定本地文件。
+//
+// 输出格式见 codepage.go 中的 codePage：只记录 0x80 及以上的代码，按代码从小到大，
+// 每项是两个 uvarint：与上一项的代码差减一、与上一项的码位差减一（zigzag 编码），整体以 raw DEFLATE 压缩
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const mappings = "https://www.unicode.org/Public/MAPPINGS/VENDORS/MICSFT/WINDOWS/"
+
+func main() {
+	cp936 := flag.String("cp936", mappings+"CP936.TXT", "CP936 映射表的地址或本地文件")
+	cp932 := flag.String("cp932", mappings+"CP932.TXT", "CP932 映射表的地址或本地文件")
+	out := flag.String("out", "codepages", "输出目录")
+	flag.Parse()
+
+	for _, table := range []struct{ src, dst string }{{*cp936, "cp936.bin"}, {*cp932, "cp932.bin"}} {
+		data, err := readSource(table.src)
+		if err != nil {
+			log.Fatal(err)
+		}
+		codes, runes, err := parseMapping(data)
+		if err != nil {
+			log.Fatalf("%s: %v", table.src, err)
+		}
+		encoded, err := encodeTable(codes, runes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dst := filepath.Join(*out, table.dst)
+		if err := os.WriteFile(dst, encoded, 0666); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s: %d codes from %s", dst, len(codes), table.src)
+	}
+}
+
+// readSource 读取 http(s) 地址或本地文件
+func readSource(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", src, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseMapping 解析映射表，返回按代码排序的 0x80 及以上的代码和对应的码位
+func parseMapping(data []byte) ([]int, []rune, error) {
+	mapping := make(map[int]rune)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			continue // 注释、空行、未定义的代码和前导字节
+		}
+		code, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "0x"), 16, 16)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		r, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return nil, nil, fmt.Errorf("line %d: invalid code point %s", line, fields[1])
+		}
+		if code < 0x80 {
+			if rune(r) != rune(code) {
+				return nil, nil, fmt.Errorf("line %d: 0x%02X is not ASCII", line, code)
+			}
+			continue
+		}
+		if _, ok := mapping[int(code)]; ok {
+			return nil, nil, fmt.Errorf("line %d: duplicate code 0x%X", line, code)
+		}
+		mapping[int(code)] = rune(r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	codes := make([]int, 0, len(mapping))
+	for code := range mapping {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	runes := make([]rune, len(codes))
+	for i, code := range codes {
+		runes[i] = mapping[code]
+	}
+	return codes, runes, nil
+}
+
+// encodeTable 按 codePage 的格式编码并压缩映射表
+func encodeTable(codes []int, runes []rune) ([]byte, error) {
+	var raw []byte
+	code, r := 0, rune(0)
+	for i := range codes {
+		runeDelta := int64(runes[i]-r) - 1
+		raw = binary.AppendUvarint(raw, uint64(codes[i]-code-1))
+		raw = binary.AppendUvarint(raw, uint64(runeDelta<<1^runeDelta>>63))
+		code, r = codes[i], runes[i]
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
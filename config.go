@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFileName 配置文件名
+const configFileName = "marszip.json"
+
+// configFilePath 已加载的配置文件的绝对路径，打包时需跳过该文件
+var configFilePath string
+
+// profileConfig 配置文件中的一组设置，未填写的字段沿用上一层的值
+type profileConfig struct {
+	Prefix            string   `json:"prefix,omitempty"`
+	MaxFiles          int      `json:"maxFiles,omitempty"`
+	BatchBy           string   `json:"batchBy,omitempty"`
+	MaxBatchSize      string   `json:"maxBatchSize,omitempty"` // 例如 "500MB"、"2GiB"
+	Format            string   `json:"format,omitempty"`
+	Include           []string `json:"include,omitempty"`
+	Exclude           []string `json:"exclude,omitempty"`
+	Hidden            string   `json:"hidden,omitempty"`
+	Junk              string   `json:"junk,omitempty"`
+	JunkPatterns      []string `json:"junkPatterns,omitempty"`
+	Delete            string   `json:"delete,omitempty"`
+	OnlyWithPrefix    *bool    `json:"onlyWithPrefix,omitempty"`
+	Manifest          *bool    `json:"manifest,omitempty"`
+	Dedup             string   `json:"dedup,omitempty"`
+	Incremental       *bool    `json:"incremental,omitempty"`
+	TopUp             *bool    `json:"topUp,omitempty"`
+	Checksums         string   `json:"checksums,omitempty"`
+	ChecksumAlgorithm string   `json:"checksumAlgorithm,omitempty"`
+	TrashDir          string   `json:"trashDir,omitempty"`
+	TrashDays         int      `json:"trashDays,omitempty"`
+	TrashMaxSize      string   `json:"trashMaxSize,omitempty"`
+	UploadEndpoint    string   `json:"uploadEndpoint,omitempty"`
+	UploadRegion      string   `json:"uploadRegion,omitempty"`
+	UploadBucket      string   `json:"uploadBucket,omitempty"`
+	UploadKey         string   `json:"uploadKey,omitempty"` // 例如 "archives/{date}/{name}"
+	UploadAccessKey   string   `json:"uploadAccessKey,omitempty"`
+	UploadSecretKey   string   `json:"uploadSecretKey,omitempty"`
+	UploadVirtualHost *bool    `json:"uploadVirtualHost,omitempty"`
+	UploadPartSize    string   `json:"uploadPartSize,omitempty"`
+	UploadDeleteLocal *bool    `json:"uploadDeleteLocal,omitempty"`
+	Push              string   `json:"push,omitempty"` // 例如 "sftp://backup@example.com/incoming"
+	PushIdentity      string   `json:"pushIdentity,omitempty"`
+	PushRetries       int      `json:"pushRetries,omitempty"`
+	Sink              string   `json:"sink,omitempty"` // 例如 "-"、"https://example.com/upload/{name}"、"s3"
+	NameEncoding      string   `json:"nameEncoding,omitempty"`
+	Symlinks          string   `json:"symlinks,omitempty"`
+	ExtractDepth      int      `json:"extractDepth,omitempty"`
+	ExtractSubdirs    *bool    `json:"extractSubdirs,omitempty"`
+	ExtractConflict   string   `json:"extractConflict,omitempty"`
+	ExtractMaxSize    string   `json:"extractMaxSize,omitempty"`
+	ExtractMaxEntries int      `json:"extractMaxEntries,omitempty"`
+	ExtractEncoding   string   `json:"extractNameEncoding,omitempty"`
+}
+
+// fileConfig 配置文件内容，顶层设置对所有配置方案生效，配置方案中的设置覆盖顶层设置
+type fileConfig struct {
+	profileConfig
+	DefaultProfile string                   `json:"defaultProfile,omitempty"`
+	Profiles       map[string]profileConfig `json:"profiles,omitempty"`
+}
+
+// applyTo 将配置中已填写的字段覆盖到打包设置上
+func (p profileConfig) applyTo(opts *packOptions) error {
+	if p.Prefix != "" {
+		opts.Prefix = p.Prefix
+	}
+	if p.MaxFiles != 0 {
+		opts.MaxFiles = p.MaxFiles
+	}
+	if p.BatchBy != "" {
+		opts.BatchBy = p.BatchBy
+	}
+	if p.MaxBatchSize != "" {
+		size, err := parseSize(p.MaxBatchSize)
+		if err != nil {
+			return err
+		}
+		opts.MaxBatchBytes = size
+	}
+	if p.Format != "" {
+		opts.Format = p.Format
+	}
+	if p.Include != nil {
+		opts.Include = p.Include
+	}
+	if p.Exclude != nil {
+		opts.Exclude = p.Exclude
+	}
+	if p.Hidden != "" {
+		opts.Hidden = p.Hidden
+	}
+	if p.Junk != "" {
+		opts.Junk = p.Junk
+	}
+	if p.JunkPatterns != nil {
+		opts.JunkPatterns = p.JunkPatterns
+	}
+	if p.Delete != "" {
+		opts.DeletePolicy = p.Delete
+	}
+	if p.OnlyWithPrefix != nil {
+		opts.OnlyWithPrefix = p.OnlyWithPrefix
+	}
+	if p.Manifest != nil {
+		opts.Manifest = *p.Manifest
+	}
+	if p.Dedup != "" {
+		opts.Dedup = p.Dedup
+	}
+	if p.Incremental != nil {
+		opts.Incremental = *p.Incremental
+	}
+	if p.TopUp != nil {
+		opts.TopUp = *p.TopUp
+	}
+	if p.Checksums != "" {
+		opts.Checksums = p.Checksums
+	}
+	if p.ChecksumAlgorithm != "" {
+		opts.ChecksumAlgorithm = p.ChecksumAlgorithm
+	}
+	if p.TrashDir != "" {
+		opts.TrashDir = p.TrashDir
+	}
+	if p.TrashDays != 0 {
+		opts.TrashDays = p.TrashDays
+	}
+	if p.TrashMaxSize != "" {
+		size, err := parseSize(p.TrashMaxSize)
+		if err != nil {
+			return err
+		}
+		opts.TrashMaxBytes = size
+	}
+	if p.UploadEndpoint != "" {
+		opts.UploadEndpoint = p.UploadEndpoint
+	}
+	if p.UploadRegion != "" {
+		opts.UploadRegion = p.UploadRegion
+	}
+	if p.UploadBucket != "" {
+		opts.UploadBucket = p.UploadBucket
+	}
+	if p.UploadKey != "" {
+		opts.UploadKey = p.UploadKey
+	}
+	if p.UploadAccessKey != "" {
+		opts.UploadAccessKey = p.UploadAccessKey
+	}
+	if p.UploadSecretKey != "" {
+		opts.UploadSecretKey = p.UploadSecretKey
+	}
+	if p.UploadVirtualHost != nil {
+		opts.UploadVirtualHost = *p.UploadVirtualHost
+	}
+	if p.UploadPartSize != "" {
+		size, err := parseSize(p.UploadPartSize)
+		if err != nil {
+			return err
+		}
+		opts.UploadPartBytes = size
+	}
+	if p.UploadDeleteLocal != nil {
+		opts.UploadDeleteLocal = *p.UploadDeleteLocal
+	}
+	if p.Push != "" {
+		opts.PushTarget = p.Push
+	}
+	if p.PushIdentity != "" {
+		opts.PushIdentity = p.PushIdentity
+	}
+	if p.PushRetries != 0 {
+		opts.PushRetries = p.PushRetries
+	}
+	if p.Sink != "" {
+		opts.Sink = p.Sink
+	}
+	if p.NameEncoding != "" {
+		opts.NameEncoding = normalizeNameEncoding(p.NameEncoding)
+	}
+	if p.Symlinks != "" {
+		opts.Symlinks = p.Symlinks
+	}
+	if p.ExtractDepth != 0 {
+		opts.ExtractDepth = p.ExtractDepth
+	}
+	if p.ExtractSubdirs != nil {
+		opts.ExtractSubdirs = *p.ExtractSubdirs
+	}
+	if p.ExtractConflict != "" {
+		opts.ExtractConflict = p.ExtractConflict
+	}
+	if p.ExtractMaxSize != "" {
+		size, err := parseSize(p.ExtractMaxSize)
+		if err != nil {
+			return err
+		}
+		opts.ExtractMaxBytes = size
+	}
+	if p.ExtractMaxEntries != 0 {
+		opts.ExtractMaxEntries = p.ExtractMaxEntries
+	}
+	if p.ExtractEncoding != "" {
+		opts.ExtractEncoding = normalizeNameEncoding(p.ExtractEncoding)
+	}
+	return nil
+}
+
+// parseSize 解析 "500MB"、"2GiB"、"1024" 这样的大小，单位按 1024 进位
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit.suffix))
+			multiplier = unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New(msg("error.size", s))
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// findConfigFile 依次在源目录、程序所在目录和用户配置目录中查找配置文件，找不到时返回空字符串
+func findConfigFile(sourceDir, exeDir string) string {
+	candidates := []string{
+		filepath.Join(sourceDir, configFileName),
+		filepath.Join(exeDir, configFileName),
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "marszip", configFileName))
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig 读取配置文件并返回所选配置方案的设置，profileName 为空时使用配置文件中的默认方案
+func loadConfig(path, profileName string) (packOptions, error) {
+	opts := defaultPackOptions()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opts, errors.New(msg("error.config", path, err))
+	}
+	var cfg fileConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return opts, errors.New(msg("error.config", path, err))
+	}
+	if err := cfg.profileConfig.applyTo(&opts); err != nil {
+		return opts, err
+	}
+	if profileName == "" {
+		profileName = cfg.DefaultProfile
+	}
+	if profileName != "" {
+		p, ok := cfg.Profiles[profileName]
+		if !ok {
+			return opts, errors.New(msg("error.profile", profileName, path))
+		}
+		if err := p.applyTo(&opts); err != nil {
+			return opts, err
+		}
+	}
+	configFilePath, _ = filepath.Abs(path)
+	logger.Info("load config", "path", path, "profile", profileName)
+	return opts, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfig 在 dir 中写入配置文件并返回其路径
+func writeConfig(t *testing.T, dir, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, configFileName)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadConfigMerge 内置默认值、顶层设置、配置方案和命令行参数依次覆盖，未填写的字段沿用上一层
+func TestLoadConfigMerge(t *testing.T) {
+	defer func(p string) { configFilePath = p }(configFilePath)
+	path := writeConfig(t, t.TempDir(), `{
+		"prefix": "Top_",
+		"maxFiles": 20,
+		"exclude": ["*.tmp"],
+		"manifest": true,
+		"defaultProfile": "nightly",
+		"profiles": {
+			"nightly": {"maxFiles": 50, "batchBy": "size", "maxBatchSize": "2GiB", "manifest": false, "checksums": "sums"},
+			"keep": {"delete": "keep", "exclude": []}
+		}
+	}`)
+
+	opts, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Prefix != "Top_" || opts.MaxFiles != 50 || opts.BatchBy != "size" || opts.MaxBatchBytes != 2<<30 ||
+		opts.Manifest || opts.Checksums != "sums" || !slices.Equal(opts.Exclude, []string{"*.tmp"}) {
+		t.Errorf("default profile: %+v", opts)
+	}
+	if opts.Hidden != "skip" || opts.DeletePolicy != "keep" || opts.ChecksumAlgorithm != "sha256" {
+		t.Errorf("built-in defaults lost: %+v", opts)
+	}
+	if abs, _ := filepath.Abs(path); configFilePath != abs {
+		t.Errorf("configFilePath = %q, want %q", configFilePath, abs)
+	}
+
+	opts, err = loadConfig(path, "keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxFiles != 20 || !opts.Manifest || opts.Exclude == nil || len(opts.Exclude) != 0 {
+		t.Errorf("named profile: %+v", opts)
+	}
+
+	// 命令行参数以配置后的值为默认值，只覆盖给出的参数
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	addBatchFlags(fs, &opts)
+	if err := fs.Parse([]string{"-max-files", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxFiles != 7 || opts.Prefix != "Top_" {
+		t.Errorf("after flags: %+v", opts)
+	}
+}
+
+// TestLoadConfigErrors 配置文件无效、配置方案不存在或大小无法解析时报错
+func TestLoadConfigErrors(t *testing.T) {
+	defer func(p string) { configFilePath = p }(configFilePath)
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name, data, profile, err string
+	}{
+		{"json", `{"prefix": `, "", configFileName},
+		{"profile", `{"profiles": {"a": {}}}`, "b", `"b"`},
+		{"default profile", `{"defaultProfile": "x"}`, "", `"x"`},
+		{"size", `{"maxBatchSize": "lots"}`, "", `"lots"`},
+	} {
+		path := writeConfig(t, dir, tt.data)
+		if _, err := loadConfig(path, tt.profile); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if _, err := loadConfig(filepath.Join(dir, "missing.json"), ""); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+// TestFindConfigFile 源目录中的配置文件优先于程序所在目录
+func TestFindConfigFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	source, exe := t.TempDir(), t.TempDir()
+	if got := findConfigFile(source, exe); got != "" {
+		t.Errorf("no config: %q", got)
+	}
+	exeConfig := writeConfig(t, exe, "{}")
+	if got := findConfigFile(source, exe); got != exeConfig {
+		t.Errorf("exe dir: %q", got)
+	}
+	sourceConfig := writeConfig(t, source, "{}")
+	if got := findConfigFile(source, exe); got != sourceConfig {
+		t.Errorf("source dir: %q", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int64
+	}{
+		{"1024", 1024}, {"500MB", 500 << 20}, {"2GiB", 2 << 30}, {"1.5k", 1536}, {" 3 tb ", 3 << 40}, {"10B", 10},
+	} {
+		if got, err := parseSize(tt.in); err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1", "1XB"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) succeeded", in)
+		}
+	}
+}
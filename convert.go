@@ -0,0 +1,449 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveFormats 支持转换的归档格式及其扩展名，较长的扩展名在前以便优先匹配
+var archiveFormats = []struct{ name, ext string }{
+	{"tar.gz", ".tar.gz"}, {"tar.zst", ".tar.zst"}, {"tar.gz", ".tgz"}, {"tar.zst", ".tzst"}, {"tar", ".tar"}, {"zip", ".zip"},
+}
+
+// archiveFormatOf 根据文件名判断归档格式，返回格式名称和匹配的扩展名
+func archiveFormatOf(name string) (string, string, bool) {
+	lower := strings.ToLower(name)
+	for _, format := range archiveFormats {
+		if strings.HasSuffix(lower, format.ext) {
+			return format.name, name[len(name)-len(format.ext):], true
+		}
+	}
+	return "", "", false
+}
+
+// archiveEntry 与格式无关的归档条目信息
+type archiveEntry struct {
+	Name     string      // 条目路径，目录不带末尾的 /
+	Mode     os.FileMode // 包括 os.ModeDir、os.ModeSymlink 等类型位
+	Modified time.Time
+	Size     int64
+	Linkname string // 符号链接的目标
+}
+
+// archiveReader 按顺序读取归档中的条目
+type archiveReader interface {
+	// Next 返回下一个条目及其内容，目录和符号链接的内容为 nil，没有更多条目时返回 io.EOF
+	Next() (archiveEntry, io.Reader, error)
+	Close() error
+}
+
+// archiveWriter 按顺序写入归档条目
+type archiveWriter interface {
+	// Add 写入一个条目，目录和符号链接的 r 为 nil
+	Add(entry archiveEntry, r io.Reader) error
+	// Close 写入归档的结尾，不关闭底层文件
+	Close() error
+}
+
+// zstdCommand 准备调用外部的 zstd 程序，标准库没有 zstd 实现
+func zstdCommand(args ...string) (*exec.Cmd, error) {
+	path, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, errors.New(msg("error.zstdMissing"))
+	}
+	cmd := exec.Command(path, append([]string{"-q"}, args...)...)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// zipArchiveReader 基于 zip 中央目录按顺序读取条目
+type zipArchiveReader struct {
+	reader *zip.Reader
+	names  []string // 条目名的 UTF-8 形式，与 reader.File 一一对应
+	file   io.Closer
+	next   int
+	open   io.ReadCloser
+}
+
+func (z *zipArchiveReader) Next() (archiveEntry, io.Reader, error) {
+	if z.open != nil {
+		z.open.Close()
+		z.open = nil
+	}
+	if z.next >= len(z.reader.File) {
+		return archiveEntry{}, nil, io.EOF
+	}
+	file, name := z.reader.File[z.next], z.names[z.next]
+	z.next++
+	entry := archiveEntry{Name: strings.TrimSuffix(name, "/"), Mode: file.Mode(), Modified: file.Modified, Size: int64(file.UncompressedSize64)}
+	if entry.Modified.IsZero() {
+		entry.Modified = file.ModTime()
+	}
+	if entry.Mode.IsDir() {
+		entry.Size = 0
+		return entry, nil, nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return entry, nil, fmt.Errorf("%s: %w", file.Name, err)
+	}
+	z.open = rc
+	if entry.Mode&os.ModeSymlink != 0 {
+		// zip 中符号链接的内容就是链接目标
+		target, err := io.ReadAll(rc)
+		if err != nil {
+			return entry, nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		entry.Linkname, entry.Size = string(target), 0
+		return entry, nil, nil
+	}
+	return entry, rc, nil
+}
+
+func (z *zipArchiveReader) Close() error {
+	if z.open != nil {
+		z.open.Close()
+	}
+	return z.file.Close()
+}
+
+// tarArchiveReader 读取 tar、tar.gz 或 tar.zst，只返回普通文件、目录和符号链接
+type tarArchiveReader struct {
+	tr         *tar.Reader
+	file       fs.File
+	name       string
+	decompress io.ReadCloser // gzip 或 zstd 的输出，tar 时为 nil
+	cmd        *exec.Cmd
+}
+
+func (t *tarArchiveReader) Next() (archiveEntry, io.Reader, error) {
+	for {
+		hdr, err := t.tr.Next()
+		if err != nil {
+			return archiveEntry{}, nil, err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if name == "" || name == "." {
+			continue
+		}
+		entry := archiveEntry{Name: name, Mode: hdr.FileInfo().Mode(), Modified: hdr.ModTime, Size: hdr.Size}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			return entry, t.tr, nil
+		case tar.TypeDir:
+			entry.Size = 0
+			return entry, nil, nil
+		case tar.TypeSymlink:
+			entry.Linkname, entry.Size = hdr.Linkname, 0
+			return entry, nil, nil
+		default:
+			logger.Warn("skip unsupported entry", "src", t.name, "entry", hdr.Name, "type", string(hdr.Typeflag))
+		}
+	}
+}
+
+func (t *tarArchiveReader) Close() error {
+	var err error
+	if t.cmd != nil {
+		// 读完 zstd 的剩余输出，避免进程阻塞在写入上
+		io.Copy(io.Discard, t.decompress)
+		err = t.cmd.Wait()
+	} else if t.decompress != nil {
+		err = t.decompress.Close()
+	}
+	if closeErr := t.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openArchiveReader 按格式打开 fsys 中的归档，zip 中没有 UTF-8 标记的条目名按 encoding 解码
+func openArchiveReader(fsys fs.FS, name, format, encoding string) (archiveReader, error) {
+	if format == "zip" {
+		reader, file, err := openZipFS(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		return &zipArchiveReader{reader: reader, names: zipEntryNames(reader.File, encoding), file: file}, nil
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	t := &tarArchiveReader{file: file, name: fsPath(fsys, name)}
+	switch format {
+	case "tar":
+		t.tr = tar.NewReader(bufio.NewReader(file))
+	case "tar.gz":
+		gz, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		t.decompress, t.tr = gz, tar.NewReader(gz)
+	case "tar.zst":
+		cmd, err := zstdCommand("-d", "-c")
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		cmd.Stdin = file
+		stdout, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		t.cmd, t.decompress, t.tr = cmd, stdout, tar.NewReader(stdout)
+	default:
+		file.Close()
+		return nil, errors.New(msg("error.archiveFormat", format))
+	}
+	return t, nil
+}
+
+// zipArchiveWriter 以与 compressFolder 相同的方式写入 zip 条目：文件使用 Deflate，目录和符号链接不压缩
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchiveWriter) Add(entry archiveEntry, r io.Reader) error {
+	header := &zip.FileHeader{Name: entry.Name, Modified: entry.Modified}
+	header.SetMode(entry.Mode)
+	switch {
+	case entry.Mode.IsDir():
+		header.Name += "/"
+		_, err := z.zw.CreateHeader(header)
+		return err
+	case entry.Mode&os.ModeSymlink != 0:
+		writer, err := z.zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(writer, entry.Linkname)
+		return err
+	}
+	header.Method = zip.Deflate
+	writer, err := z.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, r)
+	return err
+}
+
+func (z *zipArchiveWriter) Close() error {
+	return z.zw.Close()
+}
+
+// tarArchiveWriter 写入 tar，可选经过 gzip 或外部 zstd 程序压缩
+type tarArchiveWriter struct {
+	tw       *tar.Writer
+	compress io.WriteCloser // gzip 写入器或 zstd 的标准输入，tar 时为 nil
+	cmd      *exec.Cmd
+}
+
+func (t *tarArchiveWriter) Add(entry archiveEntry, r io.Reader) error {
+	hdr := &tar.Header{Name: entry.Name, Mode: int64(entry.Mode.Perm()), ModTime: entry.Modified}
+	switch {
+	case entry.Mode.IsDir():
+		hdr.Typeflag, hdr.Name = tar.TypeDir, entry.Name+"/"
+	case entry.Mode&os.ModeSymlink != 0:
+		hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, entry.Linkname
+	default:
+		hdr.Typeflag, hdr.Size = tar.TypeReg, entry.Size
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+	_, err := io.Copy(t.tw, r)
+	return err
+}
+
+func (t *tarArchiveWriter) Close() error {
+	err := t.tw.Close()
+	if t.compress != nil {
+		if closeErr := t.compress.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if t.cmd != nil {
+		if waitErr := t.cmd.Wait(); err == nil {
+			err = waitErr
+		}
+	}
+	return err
+}
+
+// newArchiveWriter 按格式创建写入到 file 的归档写入器
+func newArchiveWriter(file *os.File, format string) (archiveWriter, error) {
+	switch format {
+	case "zip":
+		return &zipArchiveWriter{zw: zip.NewWriter(file)}, nil
+	case "tar":
+		return &tarArchiveWriter{tw: tar.NewWriter(file)}, nil
+	case "tar.gz":
+		gz := gzip.NewWriter(file)
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), compress: gz}, nil
+	case "tar.zst":
+		cmd, err := zstdCommand("-c")
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = file
+		stdin, err := cmd.StdinPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(stdin), compress: stdin, cmd: cmd}, nil
+	}
+	return nil, errors.New(msg("error.archiveFormat", format))
+}
+
+// convertedEntry 写入转换后归档的一个文件或符号链接，用于校验
+type convertedEntry struct {
+	size     int64
+	crc      uint32
+	linkname string
+	link     bool
+}
+
+// checkConverted 完整读取转换后的归档，确认 want 中的每个文件和符号链接都在，
+// 文件的大小和 CRC32、链接的目标与原归档一致。同名的条目按出现的顺序对应
+func checkConverted(path, format string, want map[string][]convertedEntry) error {
+	reader, err := openArchiveReader(dirFS(filepath.Dir(path)), filepath.Base(path), format, "auto")
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for {
+		entry, r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		link := entry.Mode&os.ModeSymlink != 0
+		if r == nil && !link {
+			continue
+		}
+		if len(want[entry.Name]) == 0 {
+			return fmt.Errorf("%s: %s", entry.Name, msg("error.convertExtra"))
+		}
+		expected := want[entry.Name][0]
+		want[entry.Name] = want[entry.Name][1:]
+		if link || expected.link {
+			if link != expected.link || entry.Linkname != expected.linkname {
+				return fmt.Errorf("%s: %s", entry.Name, msg("error.convertLink", entry.Linkname, expected.linkname))
+			}
+			continue
+		}
+		sum := crc32.NewIEEE()
+		n, err := io.Copy(sum, r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		if n != expected.size {
+			return fmt.Errorf("%s: %s", entry.Name, msg("error.convertSize", n, expected.size))
+		}
+		if sum.Sum32() != expected.crc {
+			return fmt.Errorf("%s: %s", entry.Name, msg("error.convertCRC", sum.Sum32(), expected.crc))
+		}
+	}
+	for name, missing := range want {
+		if len(missing) > 0 {
+			return fmt.Errorf("%s: %s", name, msg("error.convertMissing"))
+		}
+	}
+	return nil
+}
+
+// convertArchive 把归档中的条目逐个从 input 流式写入 format 格式的 output，不解压到磁盘。
+// 先写入临时文件并完整校验，通过后再重命名为 output。返回转换的文件数
+func convertArchive(input, output, format string) (int, error) {
+	from, _, ok := archiveFormatOf(input)
+	if !ok {
+		return 0, fmt.Errorf("%s: %s", input, msg("error.archiveFormatOf"))
+	}
+	if _, err := os.Stat(output); err == nil {
+		return 0, fmt.Errorf("%s: %w", output, os.ErrExist)
+	}
+	reader, err := openArchiveReader(dirFS(filepath.Dir(input)), filepath.Base(input), from, "auto")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", input, err)
+	}
+	defer reader.Close()
+
+	tmpPath := output + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath) // 重命名成功后删除不会生效
+	defer file.Close()
+	writer, err := newArchiveWriter(file, format)
+	if err != nil {
+		return 0, err
+	}
+
+	// 已写入的文件和符号链接，用于校验
+	want := make(map[string][]convertedEntry)
+	files := 0
+	for {
+		entry, r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writer.Close()
+			return 0, fmt.Errorf("%s: %w", input, err)
+		}
+		sum := crc32.NewIEEE()
+		if r != nil {
+			r = io.TeeReader(r, sum)
+		}
+		if err := writer.Add(entry, r); err != nil {
+			writer.Close()
+			return 0, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		switch {
+		case r != nil:
+			want[entry.Name] = append(want[entry.Name], convertedEntry{size: entry.Size, crc: sum.Sum32()})
+			files++
+		case entry.Mode&os.ModeSymlink != 0:
+			want[entry.Name] = append(want[entry.Name], convertedEntry{linkname: entry.Linkname, link: true})
+		}
+		logger.Debug("convert entry", "src", input, "entry", entry.Name, "size", entry.Size)
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	if err := checkConverted(tmpPath, format, want); err != nil {
+		return 0, fmt.Errorf("%s: %w", output, err)
+	}
+	return files, os.Rename(tmpPath, output)
+}
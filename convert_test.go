@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// convertTestEntry 转换测试中的一个条目和它的内容
+type convertTestEntry struct {
+	archiveEntry
+	data string
+}
+
+func convertTestEntries() []convertTestEntry {
+	modified := time.Date(2024, 9, 30, 12, 34, 56, 0, time.UTC)
+	return []convertTestEntry{
+		{archiveEntry{Name: "sub", Mode: os.ModeDir | 0o750, Modified: modified}, ""},
+		{archiveEntry{Name: "sub/a.txt", Mode: 0o640, Modified: modified.Add(time.Hour)}, "hello, world\n"},
+		{archiveEntry{Name: "run.sh", Mode: 0o755, Modified: modified.Add(2 * time.Hour)}, "#!/bin/sh\necho hi\n"},
+		{archiveEntry{Name: "empty", Mode: 0o600, Modified: modified}, ""},
+		{archiveEntry{Name: "link", Mode: os.ModeSymlink | 0o777, Modified: modified, Linkname: "sub/a.txt"}, ""},
+	}
+}
+
+// readConverted 读取归档中的全部条目，文件内容放在返回值的 data 中
+func readConverted(t *testing.T, path, format string) []convertTestEntry {
+	t.Helper()
+	reader, err := openArchiveReader(dirFS(filepath.Dir(path)), filepath.Base(path), format, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var entries []convertTestEntry
+	for {
+		entry, r, err := reader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data []byte
+		if r != nil {
+			if data, err = io.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries = append(entries, convertTestEntry{entry, string(data)})
+	}
+}
+
+// TestConvertRoundTrip zip 转换为各种 tar 格式再转回 zip，条目的内容、权限、修改时间和符号链接目标保持不变
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.zip")
+	file, err := os.Create(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &zipArchiveWriter{zw: zip.NewWriter(file)}
+	for _, entry := range convertTestEntries() {
+		var r io.Reader
+		if entry.Mode.IsRegular() {
+			entry.Size = int64(len(entry.data))
+			r = strings.NewReader(entry.data)
+		}
+		if err := writer.Add(entry.archiveEntry, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	for _, format := range []string{"tar", "tar.gz", "tar.zst"} {
+		t.Run(format, func(t *testing.T) {
+			if _, err := exec.LookPath("zstd"); err != nil && format == "tar.zst" {
+				t.Skip("zstd not installed")
+			}
+			converted := filepath.Join(dir, "converted."+format)
+			if files, err := convertArchive(source, converted, format); err != nil || files != 3 {
+				t.Fatalf("convert to %s: %d files, %v", format, files, err)
+			}
+			back := filepath.Join(dir, format+".zip")
+			if files, err := convertArchive(converted, back, "zip"); err != nil || files != 3 {
+				t.Fatalf("convert back to zip: %d files, %v", files, err)
+			}
+			for _, path := range []string{converted, back} {
+				got := readConverted(t, path, map[bool]string{true: "zip", false: format}[path == back])
+				want := convertTestEntries()
+				if len(got) != len(want) {
+					t.Fatalf("%s: %d entries, want %d", filepath.Base(path), len(got), len(want))
+				}
+				for i, w := range want {
+					g := got[i]
+					if g.Name != w.Name || g.Mode != w.Mode || !g.Modified.Equal(w.Modified) || g.Linkname != w.Linkname || g.data != w.data {
+						t.Errorf("%s: entry %d = %s %v %v %q %q, want %s %v %v %q %q", filepath.Base(path), i,
+							g.Name, g.Mode, g.Modified, g.Linkname, g.data, w.Name, w.Mode, w.Modified, w.Linkname, w.data)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCheckConverted 转换后的归档中内容损坏、缺少或多出条目、链接目标改变时校验失败
+func TestCheckConverted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.tar")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(file)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4})
+	tw.Write([]byte("abcX")) // 长度正确但内容损坏
+	tw.WriteHeader(&tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "a.txt"})
+	tw.Close()
+	file.Close()
+
+	content := func(data string) convertedEntry {
+		return convertedEntry{size: int64(len(data)), crc: crc32.ChecksumIEEE([]byte(data))}
+	}
+	link := convertedEntry{linkname: "a.txt", link: true}
+	tests := []struct {
+		name string
+		want map[string][]convertedEntry
+		err  string // 为空表示应通过
+	}{
+		{"ok", map[string][]convertedEntry{"a.txt": {content("abcX")}, "l": {link}}, ""},
+		{"corrupt", map[string][]convertedEntry{"a.txt": {content("abcd")}, "l": {link}}, "CRC32"},
+		{"size", map[string][]convertedEntry{"a.txt": {content("abc")}, "l": {link}}, "size"},
+		{"missing", map[string][]convertedEntry{"a.txt": {content("abcX")}, "l": {link}, "b.txt": {content("")}}, "missing"},
+		{"duplicate", map[string][]convertedEntry{"a.txt": {content("abcX"), content("abcX")}, "l": {link}}, "missing"},
+		{"extra", map[string][]convertedEntry{"l": {link}}, "unexpected"},
+		{"link", map[string][]convertedEntry{"a.txt": {content("abcX")}, "l": {{linkname: "b.txt", link: true}}}, "link target"},
+	}
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	for _, tt := range tests {
+		err := checkConverted(path, "tar", tt.want)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// findDuplicates 按内容查找重复文件：先按大小分组，再对大小相同的文件计算 SHA-256。
+// 返回去重后的文件、重复的文件，以及重复文件名到保留文件名（按名称排序的第一个）的映射
+func findDuplicates(fsys fs.FS, fileEntries []os.DirEntry) ([]os.DirEntry, []os.DirEntry, map[string]string, error) {
+	bySize := make(map[int64][]os.DirEntry)
+	for _, entry := range fileEntries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], entry)
+	}
+
+	aliasOf := make(map[string]string)
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		firstBySum := make(map[string]string)
+		for _, entry := range group {
+			sum, err := fileChecksum(fsys, entry.Name(), sha256.New)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if original, ok := firstBySum[sum]; ok {
+				aliasOf[entry.Name()] = original
+			} else {
+				firstBySum[sum] = entry.Name()
+			}
+		}
+	}
+
+	var unique, dupes []os.DirEntry
+	for _, entry := range fileEntries {
+		if _, ok := aliasOf[entry.Name()]; ok {
+			dupes = append(dupes, entry)
+		} else {
+			unique = append(unique, entry)
+		}
+	}
+	return unique, dupes, aliasOf, nil
+}
+
+// dupesFolderName 返回存放重复文件的批次名称，例如 MarsGoExe_dupes，已存在时依次加上 _2、_3
+func dupesFolderName(fsys fs.FS, prefix string) string {
+	base := strings.TrimSuffix(prefix, "_") + "_dupes"
+	name := base
+	for i := 2; ; i++ {
+		_, dirErr := fs.Stat(fsys, name)
+		_, zipErr := fs.Stat(fsys, name+".zip")
+		if errors.Is(dirErr, fs.ErrNotExist) && errors.Is(zipErr, fs.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// TestDedupPolicies 三种去重方式：skip 把重复文件留在源目录，alias 只打包保留副本并在清单中记录，
+// separate 把重复文件放入单独的 dupes 压缩包；off 时全部打包
+func TestDedupPolicies(t *testing.T) {
+	for _, tt := range []struct {
+		policy  string
+		names   []string
+		entries []string
+	}{
+		{"off", []string{"P_1.zip"}, []string{"P_1/", "a.txt", "b.txt", "c.txt"}},
+		{"skip", []string{"P_1.zip", "c.txt"}, []string{"P_1/", "a.txt", "b.txt"}},
+		{"alias", []string{"P_1.zip", "P_1.zip" + manifestSuffix}, []string{"P_1/", "a.txt", "b.txt"}},
+		{"separate", []string{"P_1.zip", "P_dupes.zip"}, []string{"P_1/", "a.txt", "b.txt"}},
+	} {
+		fsys := newMemFS()
+		// b.txt 与 a.txt 大小相同但内容不同，不是重复文件
+		for name, data := range map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "alpha"} {
+			fsys.files[name] = &fstest.MapFile{Data: []byte(data), Mode: 0o644}
+		}
+		opts := defaultPackOptions()
+		opts.Prefix = "P_"
+		opts.Dedup = tt.policy
+		opts.DeletePolicy = "delete"
+		if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		if got := fsys.names(); !slices.Equal(got, tt.names) {
+			t.Errorf("%s: files %q, want %q", tt.policy, got, tt.names)
+		}
+		if got := archiveEntryNames(t, fsys, "P_1.zip"); !slices.Equal(got, tt.entries) {
+			t.Errorf("%s: P_1.zip entries %q, want %q", tt.policy, got, tt.entries)
+		}
+		switch tt.policy {
+		case "alias":
+			manifest, err := readManifest(fsys, "P_1.zip")
+			if err != nil || manifest == nil {
+				t.Fatalf("alias: manifest %v, %v", manifest, err)
+			}
+			i := slices.IndexFunc(manifest.Entries, func(e manifestEntry) bool { return e.Name == "c.txt" })
+			if i < 0 || manifest.Entries[i].AliasOf != "a.txt" || manifest.Entries[i].Size != 5 {
+				t.Errorf("alias: manifest entries %+v", manifest.Entries)
+			}
+		case "separate":
+			if got, want := archiveEntryNames(t, fsys, "P_dupes.zip"), []string{"P_dupes/", "c.txt"}; !slices.Equal(got, want) {
+				t.Errorf("separate: P_dupes.zip entries %q, want %q", got, want)
+			}
+		}
+	}
+}
+
+// TestDupesFolderName 已有同名的文件夹或压缩包时依次加上编号
+func TestDupesFolderName(t *testing.T) {
+	fsys := fstest.MapFS{}
+	if got := dupesFolderName(fsys, "P_"); got != "P_dupes" {
+		t.Errorf("empty: %q", got)
+	}
+	fsys["P_dupes.zip"] = &fstest.MapFile{}
+	fsys["P_dupes_2/x"] = &fstest.MapFile{}
+	if got := dupesFolderName(fsys, "P_"); got != "P_dupes_3" {
+		t.Errorf("taken: %q", got)
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// extractFromFolder 把 fsys 中文件夹 folder 里的文件移到 destination
+func extractFromFolder(fsys writableFS, folder, destination string) error {
+	files, err := fsys.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		oldName := path.Join(folder, file.Name())
+		newName := path.Join(destination, file.Name())
+		if file.IsDir() {
+			err = fsys.MkdirAll(newName, 0777)
+			if err != nil {
+				return err
+			}
+			err = extractFromFolder(fsys, oldName, newName)
+			if err != nil {
+				return err
+			}
+		} else {
+			err = moveFile(fsys, oldName, newName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeEmptyFolders 删除空文件夹
+func removeEmptyFolders(fsys writableFS, folder, prefix string) error {
+	files, err := fsys.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fsys.Remove(folder)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			err := removeEmptyFolders(fsys, path.Join(folder, file.Name()), prefix)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	files, _ = fsys.ReadDir(folder)
+	if len(files) == 0 {
+		return fsys.Remove(folder)
+	}
+	return nil
+}
+
+// extractBudget 一个源压缩包（含其中嵌套的归档）已解压出的条目数和字节数，用于安全上限
+type extractBudget struct {
+	entries int
+	bytes   int64
+}
+
+// extractEntryName 把条目名转换为 destination 下的路径：反斜杠视为分隔符，
+// 拒绝绝对路径、盘符和指向 destination 之外的条目（zip slip）
+func extractEntryName(destination, entryName string) (string, error) {
+	name := path.Clean(strings.ReplaceAll(entryName, "\\", "/"))
+	if path.IsAbs(name) || (len(name) >= 2 && name[1] == ':') || name == ".." || strings.HasPrefix(name, "../") {
+		return "", errors.New(msg("error.extractUnsafe", entryName))
+	}
+	return path.Join(destination, name), nil
+}
+
+// extractConflictName 按处理方式确定已存在的目标文件写到哪里：overwrite 原位置，
+// rename 加编号的新名称，skip 返回空字符串，error 返回错误
+func extractConflictName(fsys writableFS, name, conflict string) (string, error) {
+	_, err := fsys.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch conflict {
+	case "skip":
+		return "", nil
+	case "error":
+		return "", errors.New(msg("error.extractConflict", fsPath(fsys, name)))
+	case "rename":
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 2; ; i++ {
+			candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+			if _, err := fsys.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+				return candidate, nil
+			}
+		}
+	}
+	return name, nil
+}
+
+// extractLinkTarget 检查要在 name 处创建的符号链接的目标 linkname：拒绝绝对路径、盘符和解析后位于 destination 之外的目标。
+// 返回清理后的目标，创建链接时使用它，避免 a/.. 这样的目标先经过其他链接再向上离开 destination
+func extractLinkTarget(destination, name, linkname string) (string, error) {
+	target := path.Clean(strings.ReplaceAll(linkname, "\\", "/"))
+	resolved := path.Join(path.Dir(name), target)
+	inside := resolved == destination || strings.HasPrefix(resolved, destination+"/")
+	if destination == "." {
+		inside = resolved != ".." && !strings.HasPrefix(resolved, "../")
+	}
+	if linkname == "" || path.IsAbs(target) || (len(target) >= 2 && target[1] == ':') || !inside {
+		return "", errors.New(msg("error.extractUnsafeLink", name, linkname))
+	}
+	return target, nil
+}
+
+// hasLinkParent 判断 name 在 destination 之下的上级目录中是否有符号链接，经过链接创建的新链接可能离开 destination
+func hasLinkParent(fsys writableFS, destination, name string) bool {
+	for dir := path.Dir(name); dir != destination && dir != "."; dir = path.Dir(dir) {
+		if info, err := fsys.Lstat(dir); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// extractLink 在 name 处创建指向 target 的符号链接，replace 时先删除已有的文件或链接（非空的目录不会被删除）
+func extractLink(fsys writableFS, destination, name, target string, replace bool) error {
+	if hasLinkParent(fsys, destination, name) {
+		return errors.New(msg("error.extractUnsafeLink", name, target))
+	}
+	if err := fsys.MkdirAll(path.Dir(name), 0777); err != nil {
+		return err
+	}
+	if replace {
+		if err := fsys.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return fsys.Symlink(target, name)
+}
+
+// extractEntry 把条目内容写入 target，写入的字节数计入 budget；
+// 超过 maxBytes 或写入失败时删除写了一半的文件
+func extractEntry(fsys writableFS, target string, perm fs.FileMode, r io.Reader, maxBytes int64, budget *extractBudget) (int64, error) {
+	if err := fsys.MkdirAll(path.Dir(target), 0777); err != nil {
+		return 0, err
+	}
+	if perm == 0 {
+		perm = 0666
+	}
+	file, err := fsys.Create(target, perm)
+	if err != nil {
+		return 0, err
+	}
+	if maxBytes > 0 {
+		r = io.LimitReader(r, maxBytes-budget.bytes+1)
+	}
+	size, err := io.Copy(file, r)
+	budget.bytes += size
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && maxBytes > 0 && budget.bytes > maxBytes {
+		err = errors.New(msg("error.extractMaxBytes", formatBytes(maxBytes)))
+	}
+	if err != nil {
+		fsys.Remove(target)
+		return size, err
+	}
+	return size, nil
+}
+
+// extractArchive 把 fsys 中的归档 name 解压到 destination，depth 为当前的嵌套层数。
+// 层数小于 opts.ExtractDepth 时，解压出的 zip 和 tar 归档继续解压到旁边的同名文件夹，成功后删除；
+// 条目数和字节数计入 budget，超过上限时停止。符号链接在其他条目都写入后创建，目标离开 destination 的链接被跳过；
+// opts.Symlinks 为 skip 时不恢复链接
+func extractArchive(fsys writableFS, name, format, destination string, depth int, opts packOptions, budget *extractBudget) error {
+	reader, err := openArchiveReader(fsys, name, format, opts.ExtractEncoding)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	type pendingLink struct {
+		name, target, entry string
+	}
+	var nested []string
+	var links []pendingLink
+	for {
+		entry, r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// 只选择部分条目时跳过目录，文件的上级目录在写入时创建；需要继续解压的嵌套归档总是解压
+		_, _, isArchive := archiveFormatOf(entry.Name)
+		descend := isArchive && depth < opts.ExtractDepth
+		if opts.extractFiltered() && (entry.Mode.IsDir() || !descend && !opts.extractSelected(entry.Name)) {
+			continue
+		}
+		target, err := extractEntryName(destination, entry.Name)
+		if err != nil {
+			return err
+		}
+		budget.entries++
+		if opts.ExtractMaxEntries > 0 && budget.entries > opts.ExtractMaxEntries {
+			return errors.New(msg("error.extractMaxEntries", opts.ExtractMaxEntries))
+		}
+		if entry.Mode.IsDir() {
+			if err := fsys.MkdirAll(target, fs.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Mode&fs.ModeSymlink != 0 && opts.Symlinks != "skip" {
+			// 先写入全部文件，避免条目经过归档中的链接写到别处
+			linkTarget, err := extractLinkTarget(destination, target, entry.Linkname)
+			if err != nil {
+				logger.Warn("skip entry", "src", fsPath(fsys, name), "entry", entry.Name, "err", err)
+				continue
+			}
+			links = append(links, pendingLink{name: target, target: linkTarget, entry: entry.Name})
+			continue
+		}
+		if r == nil {
+			logger.Warn("skip unsupported entry", "src", fsPath(fsys, name), "entry", entry.Name, "type", entry.Mode.Type().String())
+			continue
+		}
+		target, err = extractConflictName(fsys, target, opts.ExtractConflict)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			logger.Info("skip entry", "src", fsPath(fsys, name), "entry", entry.Name, "reason", "exists")
+			continue
+		}
+
+		start := time.Now()
+		size, err := extractEntry(fsys, target, entry.Mode.Perm(), r, opts.ExtractMaxBytes, budget)
+		if err != nil {
+			logger.Error("extract entry failed", "src", fsPath(fsys, name), "entry", entry.Name, "dst", fsPath(fsys, target), "err", err)
+			return err
+		}
+		logger.Info("extract entry", "src", fsPath(fsys, name), "entry", entry.Name, "dst", fsPath(fsys, target), "size", size, "duration", time.Since(start))
+		if descend {
+			nested = append(nested, target)
+		}
+	}
+
+	// 创建链接失败（例如 Windows 上没有权限）时只记录警告
+	for _, link := range links {
+		target, err := extractConflictName(fsys, link.name, opts.ExtractConflict)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			logger.Info("skip entry", "src", fsPath(fsys, name), "entry", link.entry, "reason", "exists")
+			continue
+		}
+		if err := extractLink(fsys, destination, target, link.target, target == link.name); err != nil {
+			logger.Warn("restore symlink failed", "src", fsPath(fsys, name), "entry", link.entry, "dst", fsPath(fsys, target), "err", err)
+			continue
+		}
+		logger.Info("restore symlink", "src", fsPath(fsys, name), "entry", link.entry, "dst", fsPath(fsys, target), "target", link.target)
+	}
+
+	// 外层归档读完后再解压嵌套的归档
+	for _, archive := range nested {
+		format, ext, _ := archiveFormatOf(archive)
+		nestedDestination, err := getDestinationFolder(fsys, strings.TrimSuffix(archive, ext))
+		if err != nil {
+			return err
+		}
+		if err := extractArchive(fsys, archive, format, nestedDestination, depth+1, opts, budget); err != nil {
+			return fmt.Errorf("%s: %w", path.Base(archive), err)
+		}
+		logger.Info("extract nested archive", "src", fsPath(fsys, archive), "dst", fsPath(fsys, nestedDestination), "depth", depth+1)
+		if err := fsys.Remove(archive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findNextAvailableFolder 查找下一个可用的同名文件夹
+func findNextAvailableFolder(fsys fs.StatFS, baseFolder string) (string, error) {
+	num := 1
+	for {
+		folder := fmt.Sprintf("%s_%d", baseFolder, num)
+		_, err := fsys.Stat(folder)
+		if errors.Is(err, fs.ErrNotExist) {
+			return folder, nil
+		}
+		num++
+	}
+}
+
+// getDestinationFolder 确定解压目标文件夹，baseFolder 已存在且不为空时使用下一个编号
+func getDestinationFolder(fsys writableFS, baseFolder string) (string, error) {
+	// 检查是否存在同名文件夹
+	_, err := fsys.Stat(baseFolder)
+	if errors.Is(err, fs.ErrNotExist) {
+		// 文件夹不存在，创建它
+		err = fsys.MkdirAll(baseFolder, 0777)
+		if err != nil {
+			return "", err
+		}
+		return baseFolder, nil
+	}
+
+	// 存在同名文件夹，检查是否为空
+	entries, _ := fsys.ReadDir(baseFolder)
+	if len(entries) == 0 {
+		// 文件夹为空，直接使用
+		return baseFolder, nil
+	}
+
+	// 文件夹不为空，查找下一个可用的同名文件夹
+	maxNum, _, _, _ := findMaxPrefixNumber(fsys, path.Dir(baseFolder), path.Base(baseFolder)+"_")
+	nextNum := maxNum + 1
+	destination := fmt.Sprintf("%s_%d", baseFolder, nextNum)
+	err = fsys.MkdirAll(destination, 0777)
+	if err != nil {
+		return "", err
+	}
+	return destination, nil
+}
+
+// zipHasSelected 通过中央目录判断压缩包中是否有要解压的条目，需要继续解压的嵌套归档也算在内
+func zipHasSelected(fsys fs.FS, zipName string, opts packOptions) (bool, error) {
+	reader, file, err := openZipFS(fsys, zipName)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	names := zipEntryNames(reader.File, opts.ExtractEncoding)
+	for i, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if _, _, isArchive := archiveFormatOf(names[i]); (isArchive && opts.ExtractDepth > 0) || opts.extractSelected(names[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readEntryNames 读取要解压的条目名：清单文件（*.manifest.json）取其中的全部条目，
+// 重复文件同时选择其保留的条目；其他文件按行或 NUL 分隔，- 为标准输入
+func readEntryNames(from string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	if strings.HasSuffix(from, manifestSuffix) {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			return nil, err
+		}
+		var manifest archiveManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("%s: %w", from, err)
+		}
+		for _, entry := range manifest.Entries {
+			names[entry.Name] = true
+			if entry.AliasOf != "" {
+				names[entry.AliasOf] = true
+			}
+		}
+		return names, nil
+	}
+	list, err := readFileList(from)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range list {
+		names[strings.TrimPrefix(strings.ReplaceAll(name, "\\", "/"), "./")] = true
+	}
+	return names, nil
+}
+
+// extractFromZips 从 fsys 根目录中的压缩包提取文件，opts.ExtractSubdirs 时也包括子文件夹中的压缩包。
+// 每个压缩包解压到旁边的同名文件夹，嵌套的归档、同名文件和安全上限按 opts 处理
+func extractFromZips(fsys writableFS, prefix string, onlyWithPrefix bool, opts packOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	isCandidate := func(name string) bool {
+		return strings.HasSuffix(name, ".zip") && (!onlyWithPrefix || strings.HasPrefix(strings.TrimSuffix(name, path.Ext(name)), prefix))
+	}
+
+	// 先列出全部压缩包再解压，解压出的压缩包不会被再次处理
+	var zips []string
+	if opts.ExtractSubdirs {
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && name == trashDirName {
+				return fs.SkipDir
+			}
+			if !d.IsDir() && isCandidate(d.Name()) {
+				zips = append(zips, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		files, err := fsys.ReadDir(".")
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if !file.IsDir() && isCandidate(file.Name()) {
+				zips = append(zips, file.Name())
+			}
+		}
+	}
+
+	for _, zipName := range zips {
+		// 只选择部分条目时先通过中央目录检查，没有要解压的条目就不创建解压文件夹
+		if opts.extractFiltered() {
+			wanted, err := zipHasSelected(fsys, zipName, opts)
+			if err != nil {
+				logger.Error("extract zip failed", "src", fsPath(fsys, zipName), "err", err)
+				continue
+			}
+			if !wanted {
+				logger.Debug("skip zip", "src", fsPath(fsys, zipName), "reason", "no matching entries")
+				continue
+			}
+		}
+		logger.Info("processing zip", "src", fsPath(fsys, zipName))
+
+		// 确定解压目标路径
+		baseFolder := strings.TrimSuffix(zipName, path.Ext(zipName))
+		destination, err := getDestinationFolder(fsys, baseFolder)
+		if err != nil {
+			return err
+		}
+
+		// 解压文件
+		err = extractArchive(fsys, zipName, "zip", destination, 0, opts, &extractBudget{})
+		if err != nil {
+			logger.Error("extract zip failed", "src", fsPath(fsys, zipName), "dst", fsPath(fsys, destination), "err", err)
+		} else {
+			logger.Info("extract zip", "src", fsPath(fsys, zipName), "dst", fsPath(fsys, destination))
+		}
+	}
+	return nil
+}
+
+// extractFromFolders 将 fsys 根目录下各文件夹中的文件提取到根目录
+func extractFromFolders(fsys writableFS, prefix string, onlyWithPrefix, deleteEmpty bool) {
+	files, _ := fsys.ReadDir(".")
+	for _, file := range files {
+		if file.IsDir() && file.Name() != trashDirName && (!onlyWithPrefix || strings.HasPrefix(file.Name(), prefix)) {
+			folder := file.Name()
+			logger.Info("processing folder", "src", fsPath(fsys, folder))
+			err := extractFromFolder(fsys, folder, ".")
+			if err != nil {
+				logger.Error("extract folder failed", "src", fsPath(fsys, folder), "dst", fsPath(fsys, "."), "err", err)
+			} else {
+				logger.Info("extract folder", "src", fsPath(fsys, folder), "dst", fsPath(fsys, "."))
+			}
+
+			// 删除空文件夹
+			if deleteEmpty && strings.HasPrefix(file.Name(), prefix) {
+				start := time.Now()
+				err := removeEmptyFolders(fsys, folder, prefix)
+				if err != nil {
+					logger.Error("delete folder failed", "src", fsPath(fsys, folder), "err", err)
+				} else {
+					logger.Info("delete folder", "src", fsPath(fsys, folder), "size", 0, "duration", time.Since(start))
+				}
+			}
+		}
+	}
+}
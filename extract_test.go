@@ -0,0 +1,311 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// zipBytes 返回压缩包的内容，files 为条目名和内容交替的列表
+func zipBytes(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// nestedZip 返回 outer.zip 的内容：a.txt 和 inner.zip，inner.zip 中有 b.txt 和 deep.zip，deep.zip 中有 c.txt
+func nestedZip(t *testing.T) []byte {
+	deep := zipBytes(t, "c.txt", "charlie")
+	inner := zipBytes(t, "b.txt", "bravo", "deep.zip", string(deep))
+	return zipBytes(t, "a.txt", "alpha", "inner.zip", string(inner))
+}
+
+// fileData 返回 fsys 中文件的内容，文件不存在时返回 "-"
+func fileData(fsys fs.FS, name string) string {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "-"
+	}
+	return string(data)
+}
+
+func TestExtractEntryName(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string // 为空表示应拒绝
+	}{
+		{"a.txt", "d/a.txt"},
+		{"sub/a.txt", "d/sub/a.txt"},
+		{"./a.txt", "d/a.txt"},
+		{"sub/../a.txt", "d/a.txt"},
+		{`sub\a.txt`, "d/sub/a.txt"},
+		{"../a.txt", ""},
+		{"sub/../../a.txt", ""},
+		{`..\a.txt`, ""},
+		{`sub\..\..\a.txt`, ""},
+		{"..", ""},
+		{"/etc/passwd", ""},
+		{`\Windows\win.ini`, ""},
+		{"C:/Windows/win.ini", ""},
+		{`C:\Windows\win.ini`, ""},
+		{"C:win.ini", ""},
+	}
+	for _, tt := range tests {
+		got, err := extractEntryName("d", tt.entry)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("extractEntryName(%q) = %q, want error", tt.entry, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("extractEntryName(%q) = %q, %v, want %q", tt.entry, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtractLinkTarget(t *testing.T) {
+	tests := []struct {
+		destination, name, linkname string
+		want                        string // 为空表示应拒绝
+	}{
+		{"d", "d/l", "a.txt", "a.txt"},
+		{"d", "d/l", ".", "."},
+		{"d", "d/sub/l", "../a.txt", "../a.txt"},
+		{"d", "d/sub/l", `..\a.txt`, "../a.txt"},
+		{"d", "d/l", "x/..", "."},       // 清理后创建，不会经过链接 x 再向上
+		{"d", "d/l", "x/../..", ""},     // 清理后离开 d
+		{"d", "d/l", "../d2/a.txt", ""}, // 同级的其他文件夹
+		{"d", "d/l", "..", ""},
+		{"d", "d/l", "/etc/passwd", ""},
+		{"d", "d/l", `C:\Windows`, ""},
+		{"d", "d/l", "", ""},
+		{".", "sub/l", "../a.txt", "../a.txt"},
+		{".", "l", "../a.txt", ""},
+	}
+	for _, tt := range tests {
+		got, err := extractLinkTarget(tt.destination, tt.name, tt.linkname)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("extractLinkTarget(%q, %q, %q) = %q, want error", tt.destination, tt.name, tt.linkname, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("extractLinkTarget(%q, %q, %q) = %q, %v, want %q", tt.destination, tt.name, tt.linkname, got, err, tt.want)
+		}
+	}
+}
+
+// TestExtractNested 按层数递归解压嵌套的归档，解压后删除嵌套的归档，超过层数的归档原样保留
+func TestExtractNested(t *testing.T) {
+	for _, tt := range []struct {
+		depth int
+		files map[string]string
+	}{
+		{0, map[string]string{"outer/a.txt": "alpha", "outer/inner.zip": "zip", "outer/inner/b.txt": "-"}},
+		{1, map[string]string{"outer/inner.zip": "-", "outer/inner/b.txt": "bravo", "outer/inner/deep.zip": "zip", "outer/inner/deep/c.txt": "-"}},
+		{2, map[string]string{"outer/inner/deep.zip": "-", "outer/inner/deep/c.txt": "charlie"}},
+	} {
+		fsys := newMemFS()
+		fsys.files["outer.zip"] = &fstest.MapFile{Data: nestedZip(t)}
+		opts := defaultPackOptions()
+		opts.ExtractDepth = tt.depth
+		if err := extractFromZips(fsys, "", false, opts); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range tt.files {
+			got := fileData(fsys, name)
+			if want == "zip" && strings.HasPrefix(got, "PK") {
+				continue
+			}
+			if got != want {
+				t.Errorf("depth %d: %s = %.20q, want %q", tt.depth, name, got, want)
+			}
+		}
+	}
+}
+
+// TestExtractLimits 条目数和字节数的上限对同一个源压缩包及其嵌套的归档合计计算，超过时停止并删除写了一半的文件
+func TestExtractLimits(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	extract := func(data []byte, opts packOptions) (*memFS, error) {
+		fsys := newMemFS()
+		fsys.files["x.zip"] = &fstest.MapFile{Data: data}
+		return fsys, extractArchive(fsys, "x.zip", "zip", "out", 0, opts, &extractBudget{})
+	}
+
+	// 外层 2 个条目，inner.zip 中 2 个，deep.zip 中 1 个
+	opts := defaultPackOptions()
+	opts.ExtractDepth = 2
+	opts.ExtractMaxEntries = 5
+	if _, err := extract(nestedZip(t), opts); err != nil {
+		t.Errorf("5 entries with a limit of 5: %v", err)
+	}
+	opts.ExtractMaxEntries = 4
+	if _, err := extract(nestedZip(t), opts); err == nil || !strings.Contains(err.Error(), "inner.zip: ") || !strings.Contains(err.Error(), "limit of 4") {
+		t.Errorf("5 entries with a limit of 4: %v", err)
+	}
+
+	data := zipBytes(t, "a", strings.Repeat("a", 100), "b", strings.Repeat("b", 100), "c", strings.Repeat("c", 100))
+	opts = defaultPackOptions()
+	opts.ExtractMaxBytes = 300
+	if _, err := extract(data, opts); err != nil {
+		t.Errorf("300 bytes with a limit of 300: %v", err)
+	}
+	opts.ExtractMaxBytes = 250
+	fsys, err := extract(data, opts)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("300 bytes with a limit of 250: %v", err)
+	}
+	if len(fileData(fsys, "out/a")) != 100 || len(fileData(fsys, "out/b")) != 100 || fileData(fsys, "out/c") != "-" {
+		t.Errorf("after the limit: a=%d b=%d c=%q", len(fileData(fsys, "out/a")), len(fileData(fsys, "out/b")), fileData(fsys, "out/c"))
+	}
+}
+
+// TestExtractConflict 目标文件已存在时按 overwrite、rename、skip、error 处理
+func TestExtractConflict(t *testing.T) {
+	for _, tt := range []struct {
+		conflict string
+		files    map[string]string
+		err      bool
+	}{
+		{"overwrite", map[string]string{"out/a.txt": "new", "out/a_2.txt": "-"}, false},
+		{"rename", map[string]string{"out/a.txt": "old", "out/a_2.txt": "new"}, false},
+		{"skip", map[string]string{"out/a.txt": "old", "out/a_2.txt": "-"}, false},
+		{"error", map[string]string{"out/a.txt": "old", "out/b.txt": "-"}, true},
+	} {
+		fsys := newMemFS()
+		fsys.files["x.zip"] = &fstest.MapFile{Data: zipBytes(t, "a.txt", "new", "b.txt", "bravo")}
+		fsys.files["out/a.txt"] = &fstest.MapFile{Data: []byte("old")}
+		opts := defaultPackOptions()
+		opts.ExtractConflict = tt.conflict
+		err := extractArchive(fsys, "x.zip", "zip", "out", 0, opts, &extractBudget{})
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err = %v", tt.conflict, err)
+		}
+		for name, want := range tt.files {
+			if got := fileData(fsys, name); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.conflict, name, got, want)
+			}
+		}
+	}
+}
+
+func TestExtractSelected(t *testing.T) {
+	opts := defaultPackOptions()
+	opts.ExtractInclude = []string{"*.txt", "docs/*.md"}
+	opts.ExtractExclude = []string{"secret*"}
+	opts.ExtractNames = map[string]bool{"bin/tool": true}
+	for name, want := range map[string]bool{
+		"a.txt":          true,
+		"sub/deep/b.txt": true, // 不含 / 的通配符匹配文件名
+		"docs/c.md":      true,
+		"sub/docs/c.md":  false, // 含 / 的通配符匹配完整路径
+		"./d.txt":        true,
+		`sub\e.txt`:      true,
+		"secret.txt":     false, // 排除优先
+		"bin/tool":       true,
+		"bin/other":      false,
+	} {
+		if got := opts.extractSelected(name); got != want {
+			t.Errorf("extractSelected(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	opts = defaultPackOptions()
+	opts.ExtractExclude = []string{"*.log"}
+	if !opts.extractSelected("a.txt") || opts.extractSelected("sub/a.log") {
+		t.Error("exclude only: other entries should be selected")
+	}
+}
+
+// TestExtractSelection 只解压选中的条目，中央目录中没有选中条目的压缩包不创建解压文件夹；
+// 需要继续解压的嵌套归档总是解压，其中的条目再按规则选择
+func TestExtractSelection(t *testing.T) {
+	fsys := newMemFS()
+	fsys.files["P_1.zip"] = &fstest.MapFile{Data: zipBytes(t, "a.txt", "alpha", "b.log", "bravo", "sub/c.txt", "charlie")}
+	fsys.files["P_2.zip"] = &fstest.MapFile{Data: zipBytes(t, "d.log", "delta")}
+	fsys.files["P_3.zip"] = &fstest.MapFile{Data: nestedZip(t)}
+	opts := defaultPackOptions()
+	opts.ExtractInclude = []string{"*.txt"}
+	opts.ExtractExclude = []string{"a.txt"}
+	if err := extractFromZips(fsys, "P_", true, opts); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"P_1/a.txt":     "-",
+		"P_1/b.log":     "-",
+		"P_1/sub/c.txt": "charlie",
+		"P_3/inner.zip": "-", // 不匹配 *.txt，层数为 0 时也不继续解压
+	} {
+		if got := fileData(fsys, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := fsys.Stat("P_2"); err == nil {
+		t.Error("folder created for an archive without matching entries")
+	}
+	if _, err := fsys.Stat("P_3"); err == nil {
+		t.Error("folder created for an archive whose only match is inside a nested archive that is not descended")
+	}
+
+	fsys = newMemFS()
+	fsys.files["P_3.zip"] = &fstest.MapFile{Data: nestedZip(t)}
+	opts.ExtractDepth = 2
+	if err := extractFromZips(fsys, "P_", true, opts); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"P_3/a.txt":            "-",
+		"P_3/inner/b.txt":      "bravo",
+		"P_3/inner/deep/c.txt": "charlie",
+		"P_3/inner.zip":        "-",
+		"P_3/inner/deep.zip":   "-",
+	} {
+		if got := fileData(fsys, name); got != want {
+			t.Errorf("depth 2: %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestReadEntryNames 清单文件选择其中全部条目和重复文件的保留条目，其他文件按行读取并去掉开头的 ./
+func TestReadEntryNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "P_1.zip")
+	writeStoredZip(t, path, map[string]string{"a.txt": "alpha"}, "a.txt")
+	fsys, name := localFile(path)
+	if err := writeManifest(fsys, name, map[string]string{"copy.txt": "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := readEntryNames(path + manifestSuffix)
+	if err != nil || len(names) != 2 || !names["a.txt"] || !names["copy.txt"] {
+		t.Errorf("manifest: %v, %v", names, err)
+	}
+
+	list := filepath.Join(dir, "names.txt")
+	if err := os.WriteFile(list, []byte("./a.txt\r\nsub\\b.txt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	names, err = readEntryNames(list)
+	if err != nil || len(names) != 2 || !names["a.txt"] || !names["sub/b.txt"] {
+		t.Errorf("list: %v, %v", names, err)
+	}
+}
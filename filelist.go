@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// listedFile 文件列表中的一个文件及其在压缩包中的条目名
+type listedFile struct {
+	path string
+	name string
+	info os.FileInfo
+}
+
+// readFileList 读取文件列表，from 为 - 时读取标准输入。内容中有 NUL 时按 NUL 分隔（find -print0），
+// 否则按行分隔；空项被忽略
+func readFileList(from string) ([]string, error) {
+	var data []byte
+	var err error
+	if from == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sep := "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = "\x00"
+	}
+	var paths []string
+	for _, path := range strings.Split(string(data), sep) {
+		if sep == "\n" {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// fileListEntryName 把列表中的路径转换为条目名：去掉盘符、开头的 ./ 和 /，
+// 拒绝清理后仍指向上级目录的路径
+func fileListEntryName(path string) (string, error) {
+	name := filepath.Clean(path)
+	name = strings.TrimPrefix(name, filepath.VolumeName(name))
+	name = strings.TrimLeft(filepath.ToSlash(name), "/")
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", errors.New(msg("error.filesFromPath", path))
+	}
+	return name, nil
+}
+
+// resolveFileList 检查列表中的路径并生成条目名：目录被跳过（find 会同时列出目录和其中的文件），
+// 符号链接按 opts.Symlinks 处理，隐藏文件和系统、临时文件按 opts 的设置跳过，其他非普通文件和重复的条目名记录警告后跳过
+func resolveFileList(paths []string, opts packOptions) ([]listedFile, error) {
+	var files []listedFile
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		name, err := fileListEntryName(path)
+		if err != nil {
+			return nil, err
+		}
+		if reason := opts.skipReason(name); reason != "" {
+			logger.Info("skip file", "src", path, "reason", reason)
+			continue
+		}
+		info, ok := packableFile(dirFS(filepath.Dir(path)), filepath.Base(path), opts.Symlinks)
+		if !ok {
+			continue
+		}
+		if seen[name] {
+			logger.Warn("skip file", "src", path, "reason", "duplicate entry name", "name", name)
+			continue
+		}
+		seen[name] = true
+		files = append(files, listedFile{path: path, name: name, info: info})
+	}
+	return files, nil
+}
+
+// packFileList 把文件列表中的文件打包为一个压缩包写入 opts.Sink，不移动也不删除源文件。
+// 条目名保留列表中的相对路径；压缩包按前缀取下一个编号命名。返回打包的文件数和压缩包位置
+func packFileList(sourceDir, from string, opts packOptions) (int, string, error) {
+	if err := opts.validate(); err != nil {
+		return 0, "", err
+	}
+	for _, conflict := range []struct {
+		flag string
+		used bool
+	}{
+		{"-delete", opts.DeletePolicy != "keep"},
+		{"-dedup", opts.Dedup != "off"},
+		{"-top-up", opts.TopUp},
+		{"-incremental", opts.Incremental},
+		{"-upload-endpoint", opts.UploadEndpoint != "" && opts.Sink != "s3"},
+		{"-push", opts.PushTarget != ""},
+	} {
+		if conflict.used {
+			return 0, "", errors.New(msg("error.filesFromOption", conflict.flag))
+		}
+	}
+	paths, err := readFileList(from)
+	if err != nil {
+		return 0, "", err
+	}
+	files, err := resolveFileList(paths, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(files) == 0 {
+		return 0, "", errors.New(msg("error.filesFromEmpty"))
+	}
+
+	fsys := dirFS(sourceDir)
+	sink, err := newArchiveSink(fsys, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	number := 1
+	if sink.Local() {
+		maxNum, exists, err, _ := findMaxPrefixNumber(fsys, ".", opts.Prefix)
+		if err != nil {
+			return 0, "", err
+		}
+		if exists {
+			number = maxNum + 1
+		}
+	}
+	zipName := fmt.Sprintf("%s%d.zip", opts.Prefix, number)
+	var totalBytes int64
+	for _, file := range files {
+		totalBytes += file.info.Size()
+	}
+	report := func(ev progressEvent) {
+		ev.Batch, ev.TotalBatches = 1, 1
+		ev.Folder = strings.TrimSuffix(zipName, ".zip")
+		ev.TotalBytes = totalBytes
+		emitProgress(ev)
+	}
+
+	start := time.Now()
+	size, err := writeToSink(sink, zipName, func(w io.Writer) error {
+		zipWriter := zip.NewWriter(w)
+		for _, listed := range files {
+			err := addZipEntry(zipWriter, dirFS(filepath.Dir(listed.path)), filepath.Base(listed.path), listed.name, opts, report)
+			if err != nil {
+				return err
+			}
+		}
+		return zipWriter.Close()
+	})
+	location := sink.Location(zipName)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", location, err)
+	}
+	logger.Info("create zip", "src", from, "dst", location, "size", size, "files", len(files), "duration", time.Since(start))
+	if !sink.Local() {
+		return len(files), location, nil
+	}
+
+	// 本地的压缩包与分批打包一样校验并按设置生成清单和校验和
+	if err := verifyZip(fsys, zipName, len(files)); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", location, err)
+	}
+	if opts.Manifest {
+		if err := writeManifest(fsys, zipName, nil); err != nil {
+			return 0, "", err
+		}
+		logger.Info("write manifest", "src", location, "dst", fsPath(fsys, zipName+manifestSuffix), "aliases", 0)
+	}
+	if opts.Checksums != "none" {
+		checksumName, err := writeChecksum(fsys, zipName, opts)
+		if err != nil {
+			return 0, "", err
+		}
+		logger.Info("write checksum", "src", location, "dst", fsPath(fsys, checksumName), "algorithm", opts.ChecksumAlgorithm)
+	}
+	return len(files), location, nil
+}
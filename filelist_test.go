@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestReadFileList 按行分隔时去掉行尾的 \r，内容中有 NUL 时按 NUL 分隔，文件名中的换行和空格保留；空项被忽略
+func TestReadFileList(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name, data string
+		want       []string
+	}{
+		{"lines", "a.txt\nsub/b c.txt\r\n\n./d.txt", []string{"a.txt", "sub/b c.txt", "./d.txt"}},
+		{"nul", "a.txt\x00line\nbreak.txt\x00\x00 e.txt \x00", []string{"a.txt", "line\nbreak.txt", " e.txt "}},
+		{"empty", "\n\n", nil},
+	} {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := readFileList(path); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := readFileList(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing list accepted")
+	}
+}
+
+func TestFileListEntryName(t *testing.T) {
+	for path, want := range map[string]string{
+		"a.txt":          "a.txt",
+		"./sub/b.txt":    "sub/b.txt",
+		"/abs/c.txt":     "abs/c.txt",
+		"sub/../d.txt":   "d.txt",
+		"sub//e.txt":     "sub/e.txt",
+		"..":             "",
+		"../up.txt":      "",
+		"sub/../../x":    "",
+		".":              "",
+		"/":              "",
+		"a/./b/../c.txt": "a/c.txt",
+	} {
+		got, err := fileListEntryName(path)
+		if want == "" {
+			if err == nil {
+				t.Errorf("fileListEntryName(%q) = %q, want an error", path, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("fileListEntryName(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+// TestPackFileList 按 NUL 分隔的列表打包，条目名保留相对路径，目录和重复的条目被跳过，源文件不移动
+func TestPackFileList(t *testing.T) {
+	defer func(w io.Writer) { statusOut = w }(statusOut)
+	statusOut = io.Discard
+	dir := t.TempDir()
+	t.Chdir(dir)
+	names := []string{"a.txt", "sub/b c.txt"}
+	if runtime.GOOS != "windows" {
+		names = append(names, "sub/line\nbreak.txt")
+	}
+	for _, name := range names {
+		os.MkdirAll(filepath.Dir(name), 0o755)
+		if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// find . -print0 的输出：包括目录本身，并重复列出 a.txt
+	list := append([]string{".", "sub", "./a.txt"}, names...)
+	if err := os.WriteFile("list", []byte(strings.Join(list, "\x00")+"\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	opts := defaultPackOptions()
+	opts.Prefix = "L_"
+	opts.Checksums = "sidecar"
+	n, location, err := packFileList(out, "list", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(names) || location != filepath.Join(out, "L_1.zip") {
+		t.Errorf("packed %d files to %s", n, location)
+	}
+	var want []string
+	for _, name := range names {
+		want = append(want, name+"="+name)
+	}
+	if got := zipContents(t, location); !slices.Equal(got, want) {
+		t.Errorf("entries %q, want %q", got, want)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("source moved: %v", err)
+		}
+	}
+	if _, err := os.Stat(location + ".sha256"); err != nil {
+		t.Error(err)
+	}
+
+	// 再次打包时使用下一个编号
+	if _, location, err := packFileList(out, "list", opts); err != nil || filepath.Base(location) != "L_2.zip" {
+		t.Errorf("second pack: %s, %v", location, err)
+	}
+}
+
+// TestPackFileListErrors 与文件列表不兼容的选项、指向上级目录的路径和空列表报错
+func TestPackFileListErrors(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "up.txt"), nil, 0o644)
+	dir = filepath.Join(dir, "work")
+	os.Mkdir(dir, 0o755)
+	t.Chdir(dir)
+	write := func(data string) string {
+		if err := os.WriteFile("list", []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return "list"
+	}
+	os.Mkdir("sub", 0o755)
+	os.WriteFile("a.txt", nil, 0o644)
+
+	opts := defaultPackOptions()
+	opts.DeletePolicy = "delete"
+	if _, _, err := packFileList(dir, write("a.txt\n"), opts); err == nil || !strings.Contains(err.Error(), "-delete") {
+		t.Errorf("delete policy: %v", err)
+	}
+	opts = defaultPackOptions()
+	if _, _, err := packFileList(dir, write("sub/../../up.txt\n"), opts); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("path outside the current directory: %v", err)
+	}
+	if _, _, err := packFileList(dir, write("sub\n"), opts); err == nil || !strings.Contains(err.Error(), "no files") {
+		t.Errorf("list with only directories: %v", err)
+	}
+	if _, _, err := packFileList(dir, write("missing.txt\n"), opts); err == nil {
+		t.Error("missing file accepted")
+	}
+}
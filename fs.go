@@ -0,0 +1,292 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// dirSize 统计文件夹中所有文件的总大小
+func dirSize(fsys fs.FS, name string) int64 {
+	var size int64
+	fs.WalkDir(fsys, name, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// writableFS 打包和提取使用的文件系统：在 io/fs 的只读接口上增加写入操作。
+// 分批、移动、压缩和解压通过它访问文件，换成内存中的文件系统或其他后端时这些逻辑不需要改动。
+// 路径遵循 io/fs 的规则：斜杠分隔、相对于根，"." 表示根目录
+type writableFS interface {
+	fs.ReadDirFS
+	fs.StatFS
+	fs.ReadLinkFS
+	// Create 创建或截断文件并打开用于写入，新建的文件权限为 perm
+	Create(name string, perm fs.FileMode) (io.WriteCloser, error)
+	// CreateTemp 在目录 dir 中创建新文件并打开用于写入，文件名按 pattern 生成（规则同 os.CreateTemp），权限为 perm。
+	// 返回的名称是 fsys 中的路径
+	CreateTemp(dir, pattern string, perm fs.FileMode) (io.WriteCloser, string, error)
+	// MkdirAll 创建目录及缺少的上级目录
+	MkdirAll(name string, perm fs.FileMode) error
+	// Rename 移动文件或目录；newname 是已有的文件时原子地替换它，用于先写临时文件再改名的更新
+	Rename(oldname, newname string) error
+	// Remove 删除文件或空目录
+	Remove(name string) error
+	// RemoveAll 删除文件或整个目录
+	RemoveAll(name string) error
+	// Symlink 创建指向 oldname 的符号链接 newname，oldname 是链接内容而不是 fsys 中的路径
+	Symlink(oldname, newname string) error
+}
+
+// dirFS 以本地目录为根的 writableFS，不允许访问根以外的路径
+type dirFS string
+
+// path 把 io/fs 形式的路径转换为本地路径
+func (d dirFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	path, err := d.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := d.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(path)
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := d.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+func (d dirFS) Lstat(name string) (fs.FileInfo, error) {
+	path, err := d.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(path)
+}
+
+func (d dirFS) ReadLink(name string) (string, error) {
+	path, err := d.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(target), nil
+}
+
+func (d dirFS) Create(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	path, err := d.path("create", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (d dirFS) CreateTemp(dir, pattern string, perm fs.FileMode) (io.WriteCloser, string, error) {
+	dirPath, err := d.path("createtemp", dir)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.CreateTemp(dirPath, pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", err
+	}
+	return file, path.Join(dir, filepath.Base(file.Name())), nil
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	path, err := d.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, perm)
+}
+
+func (d dirFS) Rename(oldname, newname string) error {
+	oldPath, err := d.path("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newPath, err := d.path("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+func (d dirFS) Remove(name string) error {
+	path, err := d.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (d dirFS) RemoveAll(name string) error {
+	path, err := d.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+func (d dirFS) Symlink(oldname, newname string) error {
+	path, err := d.path("symlink", newname)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(oldname), path)
+}
+
+// fsPath 返回 name 在日志中显示的路径，本地目录中的文件显示本地路径
+func fsPath(fsys fs.FS, name string) string {
+	if path, ok := localPath(fsys, name); ok {
+		return path
+	}
+	return name
+}
+
+// localPath 返回 fsys 中 name 的本地路径，fsys 不是本地目录时返回 false。
+// 上传、推送和移入回收站需要本地文件
+func localPath(fsys fs.FS, name string) (string, bool) {
+	d, ok := fsys.(dirFS)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), true
+}
+
+// localFile 把本地路径拆成所在目录的 dirFS 和文件名，命令行给出的压缩包由此交给按 fsys 访问文件的函数
+func localFile(path string) (dirFS, string) {
+	return dirFS(filepath.Dir(path)), filepath.Base(path)
+}
+
+// writeFile 把 data 写入 fsys 中的文件 name
+func writeFile(fsys writableFS, name string, data []byte, perm fs.FileMode) error {
+	w, err := fsys.Create(name, perm)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// replaceFile 先把 data 写入 name.tmp 再改名为 name，中断时不会留下不完整的文件
+func replaceFile(fsys writableFS, name string, data []byte, perm fs.FileMode) error {
+	tmp := name + ".tmp"
+	if err := writeFile(fsys, tmp, data, perm); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, name)
+}
+
+// openZipFS 打开 fsys 中的压缩包，文件不支持随机读取时先读入内存
+func openZipFS(fsys fs.FS, name string) (*zip.Reader, io.Closer, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	size := info.Size()
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		readerAt, size = bytes.NewReader(data), int64(len(data))
+	}
+	reader, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// moveFile 在 fsys 中移动文件并记录日志
+func moveFile(fsys writableFS, oldName, newName string) error {
+	start := time.Now()
+	var size int64
+	if info, err := fsys.Stat(oldName); err == nil {
+		size = info.Size()
+	}
+	if err := fsys.Rename(oldName, newName); err != nil {
+		logger.Error("move file failed", "src", fsPath(fsys, oldName), "dst", fsPath(fsys, newName), "err", err)
+		return err
+	}
+	logger.Info("move file", "src", fsPath(fsys, oldName), "dst", fsPath(fsys, newName), "size", size, "duration", time.Since(start))
+	return nil
+}
+
+// moveLink 把符号链接 oldName 移到 newName，相对路径的目标改写为从新位置出发，仍指向原来的文件
+func moveLink(fsys writableFS, oldName, newName, target string) error {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(newName)), filepath.FromSlash(path.Join(path.Dir(oldName), target)))
+	if path.IsAbs(target) || filepath.IsAbs(filepath.FromSlash(target)) || err != nil {
+		return moveFile(fsys, oldName, newName)
+	}
+	start := time.Now()
+	rebased := filepath.ToSlash(rel)
+	err = fsys.Symlink(rebased, newName)
+	if err == nil {
+		err = fsys.Remove(oldName)
+	}
+	if err != nil {
+		logger.Error("move file failed", "src", fsPath(fsys, oldName), "dst", fsPath(fsys, newName), "err", err)
+		return err
+	}
+	logger.Info("move symlink", "src", fsPath(fsys, oldName), "dst", fsPath(fsys, newName), "target", rebased, "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,3 @@
+module marszip
+
+go 1.25
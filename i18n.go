@@ -0,0 +1,459 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// locale 当前界面语言，"zh" 或 "en"
+var locale = "zh"
+
+// catalogs 消息目录：语言 -> 消息键 -> 文本（可包含 fmt 格式化占位符）
+var catalogs = map[string]map[string]string{
+	"zh": {
+		"banner.line":                 "！！！======================================================================== ！！！",
+		"banner.warning":              "！！！输入框留空回车将使用程序默认值且无法回退只能关闭窗口重新进入，请谨慎操作 ！！！",
+		"prompt.prefix":               "请输入文件夹和压缩包的前缀（直接回车将使用默认值%s）: ",
+		"prompt.action":               "请选择操作：\n1. 压缩文件\n2. 仅组织文件\n3. 从文件夹或压缩包中提取文件\n请输入数字(1, 2 或 3): ",
+		"prompt.maxFiles":             "请输入每个文件夹中的最大文件数（正整数，空行回车将使用默认值%s）: ",
+		"prompt.deleteSource":         "压缩完成后是否需要删除源文件？(y 删除/t 移入回收站/n 保留, 直接回车将使用默认值%s): ",
+		"prompt.extractFrom":          "请选择提取方式：\n1. 从文件夹中提取文件\n2. 从压缩包中提取文件\n请输入数字(1 或 2): ",
+		"prompt.deleteEmpty":          "是否删除已提取的空文件夹？(y/n, 直接回车将使用默认值%s): ",
+		"prompt.folderPrefix":         "是否只从指定前缀的文件夹中提取文件？(y/n, 直接回车将使用默认值%s): ",
+		"prompt.zipPrefix":            "是否只从指定前缀的压缩包中提取文件？(y/n, 直接回车将使用默认值%s): ",
+		"summary.compressed":          "文件组织、压缩完成。最后的文件夹编号是 %d。",
+		"summary.organized":           "文件组织完成。最后的文件夹编号是 %d。",
+		"summary.extracted":           "从压缩包中提取文件完成。",
+		"error.invalidChoice":         "无效的选择，请重新运行程序并选择有效的选项。",
+		"error.logLevel":              "无效的日志级别 %q",
+		"error.logFormat":             "无效的日志格式 %q，可选 text 或 json",
+		"error.lang":                  "不支持的语言 %q，可选 zh 或 en",
+		"error.zipFileCount":          "压缩包中有 %d 个文件，预期 %d 个",
+		"error.maxFiles":              "每个文件夹中的最大文件数必须为正整数: %d",
+		"progress.line":               "剩余 %s 批次 %d/%d",
+		"flag.logLevel":               "日志级别：debug、info、warn 或 error",
+		"flag.logFormat":              "日志格式：text 或 json（每行一个 JSON 对象）",
+		"flag.logFile":                "同时将日志追加写入该文件",
+		"flag.lang":                   "界面语言：zh 或 en（默认根据 LC_ALL/LANG 环境变量选择）",
+		"error.config":                "读取配置文件 %s 失败: %v",
+		"error.noConfig":              "指定了配置方案 %q，但没有找到配置文件",
+		"error.profile":               "配置方案 %q 在配置文件 %s 中不存在",
+		"error.batchBy":               "无效的分批方式 %q，可选 count 或 size",
+		"error.maxBatchSize":          "按大小分批时每批的最大大小必须为正数: %d",
+		"error.format":                "不支持的压缩包格式 %q",
+		"error.deletePolicy":          "无效的源文件处理方式 %q，可选 keep、delete 或 trash",
+		"error.size":                  "无效的大小 %q",
+		"error.extractFrom":           "无效的提取来源 %q，可选 zips 或 folders",
+		"error.unknownCommand":        "未知命令 %q",
+		"usage.header":                "用法: %s [选项] [命令 [命令选项]]\n不带命令时进入交互模式。\n命令：\n  pack      组织文件并压缩\n  organize  仅组织文件\n  extract   从压缩包或文件夹中提取文件\n  restore   列出或恢复回收站中的文件夹\n  watch     持续监视源目录，文件写入完成后自动分批压缩\n  repack    按新的分批设置重新打包已有的压缩包\n  merge     把多个压缩包合并为一个\n  split     把一个压缩包拆分为多个\n  convert   在 zip、tar、tar.gz 和 tar.zst 之间转换归档格式\n  list      列出压缩包中的条目和统计信息\n  upload    把压缩包上传到 S3 兼容对象存储，可续传中断的上传\n  push      通过 SFTP 把压缩包推送到服务器\n  test      完整校验压缩包，发现问题时以非零状态退出\n  verify    根据 SHA256SUMS/B3SUMS 等校验和文件检查压缩包\n选项：",
+		"flag.config":                 "配置文件路径（默认依次查找源目录、程序所在目录和用户配置目录中的 marszip.json）",
+		"flag.profile":                "使用配置文件中的指定配置方案",
+		"flag.dir":                    "源目录（默认为程序所在目录）",
+		"flag.prefix":                 "文件夹和压缩包的前缀",
+		"flag.maxFiles":               "每个文件夹中的最大文件数",
+		"flag.batchBy":                "分批方式：count（按文件数）或 size（按总大小）",
+		"flag.maxBatchSize":           "按大小分批时每批的最大大小，例如 500MB",
+		"flag.format":                 "压缩包格式",
+		"flag.include":                "只处理文件名匹配这些通配符的文件，以逗号分隔",
+		"flag.exclude":                "跳过文件名匹配这些通配符的文件，以逗号分隔",
+		"flag.delete":                 "压缩后如何处理源文件：keep（保留）、delete（删除）或 trash（移入回收站）",
+		"flag.from":                   "提取来源：zips（压缩包）或 folders（文件夹）",
+		"flag.onlyWithPrefix":         "只从指定前缀的压缩包或文件夹中提取",
+		"flag.deleteEmpty":            "删除已提取的空文件夹",
+		"error.restoreExists":         "原始位置 %s 已存在，无法恢复",
+		"error.notInTrash":            "回收站中没有 %s",
+		"summary.restored":            "已从回收站恢复 %d 项。",
+		"flag.trashDir":               "回收站目录（默认 Linux 上为系统回收站，其他系统为源目录下的 .marszip-trash）",
+		"flag.trashDays":              "回收站中的项目保留天数，0 表示不限",
+		"flag.trashMaxSize":           "回收站的最大总大小，例如 10GB，0 表示不限",
+		"flag.restoreAll":             "恢复回收站中的所有项目",
+		"flag.restorePrefix":          "只处理原始名称以此开头的项目",
+		"flag.watchInterval":          "检查等待超时的间隔，不支持 inotify 的系统上也是扫描源目录的间隔",
+		"flag.watchStable":            "文件大小和修改时间保持不变多久后，再确认没有被写打开即视为写入完成",
+		"flag.watchFlushAfter":        "文件等待多久后即使不满一批也打包",
+		"test.truncated":              "压缩包被截断: %v",
+		"test.badDirectory":           "中央目录损坏或不是 zip 文件: %v",
+		"test.crcMismatch":            "CRC32 校验不匹配",
+		"test.badMethod":              "不支持的压缩方法",
+		"test.corrupt":                "数据损坏: %v",
+		"test.badManifest":            "无法读取清单文件: %v",
+		"test.missingEntry":           "清单中有此条目，但压缩包中没有",
+		"test.extraEntry":             "压缩包中有此条目，但清单中没有",
+		"test.sizeMismatch":           "大小为 %d，清单中为 %d",
+		"test.manifestCRC":            "CRC32 为 %08x，清单中为 %08x",
+		"summary.tested":              "已校验 %d 个压缩包，%d 个有问题。",
+		"error.testFailed":            "%d 个压缩包未通过校验",
+		"flag.manifest":               "为每个压缩包生成记录条目大小和 CRC32 的清单文件",
+		"flag.testOnlyWithPrefix":     "只校验以前缀开头的压缩包",
+		"verify.mismatch":             "校验和为 %s，预期 %s",
+		"summary.verified":            "已检查 %d 个校验和，%d 个不一致或缺失。",
+		"error.verifyFailed":          "%d 个文件未通过校验和检查",
+		"error.noChecksums":           "没有找到校验和文件",
+		"error.checksums":             "无效的校验和文件方式 %q，可选 none、sidecar 或 sums",
+		"error.checksumAlgorithm":     "不支持的校验和算法 %q，可选 sha256 或 blake3",
+		"flag.checksums":              "校验和文件：none 不生成，sidecar 每个压缩包生成一个附属文件，sums 写入输出目录中的 SHA256SUMS/B3SUMS",
+		"flag.checksumAlgorithm":      "校验和算法：sha256 或 blake3",
+		"test.missingAlias":           "重复文件对应的 %s 不在压缩包中",
+		"error.dedup":                 "无效的去重方式 %q，可选 off、skip、alias 或 separate",
+		"flag.dedup":                  "内容重复的文件：off 不检查，skip 留在源目录，alias 只打包一份并在清单中记录，separate 放入单独的 dupes 批次",
+		"flag.incremental":            "增量模式：跳过状态文件 .marszip-state.json 中记录为已打包过的文件",
+		"flag.topUp":                  "先把新文件追加到最后一个未满的压缩包（通过临时文件和重命名安全地重写），再新建批次",
+		"flag.toPrefix":               "新压缩包的前缀，默认与 -prefix 相同",
+		"flag.level":                  "Deflate 压缩级别 0-9，-1 表示原样复制已压缩的数据",
+		"flag.repackDelete":           "新压缩包校验通过后如何处理原压缩包：delete（删除）、trash（移入回收站）或 keep（保留，需要配合 -to-prefix）",
+		"error.level":                 "无效的压缩级别 %d，应为 -1 到 9",
+		"error.repackKeep":            "保留原压缩包时需要用 -to-prefix 指定不同的前缀",
+		"error.repackMissing":         "新压缩包中缺少此条目",
+		"error.repackChanged":         "新压缩包中的大小或 CRC32 与原压缩包不一致",
+		"summary.repacked":            "重新打包完成，共生成 %d 个压缩包。",
+		"flag.mergeOutput":            "合并后的压缩包路径（必填）",
+		"flag.mergeConflict":          "同名条目的处理方式：rename（改名保留）、skip（只保留第一个）或 error（报错）",
+		"flag.mergeDelete":            "新压缩包校验通过后如何处理原压缩包：keep（保留）、delete（删除）或 trash（移入回收站）",
+		"flag.splitPrefix":            "拆分后压缩包的前缀，默认为 \"<原名称>_\"",
+		"error.mergeConflictPolicy":   "无效的同名条目处理方式 %q，可选 rename、skip 或 error",
+		"error.mergeConflict":         "条目 %s 与之前的压缩包中的条目同名",
+		"error.mergeArgs":             "至少需要两个要合并的压缩包",
+		"error.mergeOutput":           "输出文件不能是要合并的压缩包之一",
+		"error.mergeNoOutput":         "请用 -o 指定合并后的压缩包路径",
+		"error.splitArgs":             "请指定一个要拆分的压缩包",
+		"summary.merged":              "已将 %d 个压缩包合并为 %s。",
+		"summary.split":               "已将 %s 拆分为 %d 个压缩包。",
+		"flag.convertTo":              "目标格式：zip、tar、tar.gz 或 tar.zst（需要安装 zstd 程序）",
+		"flag.convertOutput":          "输出路径，只转换一个归档时可用，默认把原扩展名替换为目标格式",
+		"error.archiveFormat":         "不支持的归档格式 %q，可选 zip、tar、tar.gz 或 tar.zst",
+		"error.archiveFormatOf":       "无法根据扩展名判断归档格式",
+		"error.zstdMissing":           "找不到 zstd 程序，处理 tar.zst 需要先安装 zstd",
+		"error.convertExtra":          "转换后的归档中多出此条目",
+		"error.convertMissing":        "原归档中有此条目，但转换后的归档中没有",
+		"error.convertSize":           "大小为 %d，原归档中为 %d",
+		"error.convertCRC":            "CRC32 为 %08x，原归档中为 %08x",
+		"error.convertLink":           "链接目标为 %q，原归档中为 %q",
+		"error.convertArgs":           "请指定要转换的归档",
+		"error.convertOutput":         "转换多个归档时不能使用 -o",
+		"summary.converted":           "已将 %d 个归档转换为 %s。",
+		"flag.listOutput":             "输出格式：table（表格）、csv 或 json",
+		"list.header":                 "大小\t压缩后\t压缩率\t方法\t修改时间\tCRC32\t名称",
+		"list.files":                  "合计 %d 个文件",
+		"list.total":                  "总计 %d 个压缩包，%d 个文件",
+		"error.listFormat":            "无效的输出格式 %q，可选 table、csv 或 json",
+		"flag.uploadEndpoint":         "S3 兼容对象存储的地址，例如 https://s3.amazonaws.com 或 http://127.0.0.1:9000；设置后压缩完成即上传",
+		"flag.uploadRegion":           "签名使用的区域，默认 us-east-1",
+		"flag.uploadBucket":           "存储桶名称",
+		"flag.uploadKey":              "对象键模板，支持 {name}、{prefix}、{date}、{year}、{month}、{day} 和 {host}，默认 {name}",
+		"flag.uploadVirtualHost":      "使用 bucket.host 形式的地址（默认使用 host/bucket 路径形式）",
+		"flag.uploadPartSize":         "分段上传的每段大小，大于该大小的压缩包使用分段上传，至少 5MiB",
+		"flag.uploadDeleteLocal":      "上传并确认后删除本地的压缩包",
+		"error.uploadEndpoint":        "无效的对象存储地址 %q",
+		"error.uploadCredentials":     "未设置访问密钥，请在配置文件中设置 uploadAccessKey 和 uploadSecretKey，或设置 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 环境变量",
+		"error.uploadNotConfigured":   "上传需要同时设置对象存储地址和存储桶",
+		"error.uploadPartSize":        "分段大小 %d 无效，至少为 5MiB",
+		"error.uploadETag":            "服务端的 ETag 为 %s，应为 %s",
+		"error.uploadSize":            "服务端的对象大小为 %d，本地为 %d",
+		"error.uploadResponse":        "无法解析服务端的响应",
+		"error.uploadFailed":          "%d 个压缩包上传失败",
+		"summary.uploaded":            "已上传 %d 个压缩包，%d 个失败。",
+		"flag.push":                   "SFTP 目标 sftp://[user@]host[:port][/dir]，/~/dir 表示远程主目录下的目录；设置后压缩完成即推送",
+		"flag.pushIdentity":           "SSH 私钥文件，默认使用 ssh 的配置",
+		"flag.pushRetries":            "推送失败时的最多尝试次数",
+		"error.pushTarget":            "无效的 SFTP 目标 %q，应为 sftp://[user@]host[:port][/dir]",
+		"error.pushRetries":           "无效的尝试次数 %d，至少为 1",
+		"error.pushMissing":           "上传后在服务器上找不到该文件",
+		"error.pushSize":              "服务器上的大小为 %d，本地为 %d",
+		"error.pushNotConfigured":     "请用 -push 指定 SFTP 目标",
+		"error.pushFailed":            "%d 个压缩包推送失败",
+		"summary.pushed":              "已推送 %d 个压缩包，%d 个失败。",
+		"flag.sink":                   "压缩包写到哪里：为空时写入源目录，- 写到标准输出（只能有一批），http(s):// 地址用 PUT 流式上传（{name} 替换为文件名，以 / 结尾时追加文件名），s3 流式写入 -upload-* 设置的存储桶",
+		"error.sink":                  "无效的写入目标 %q，应为 -、s3 或 http(s):// 地址",
+		"error.sinkLocalOnly":         "写入目标为 %s 时不能使用 %s，该功能需要本地的压缩包",
+		"error.sinkStdoutOnce":        "标准输出只能写入一个压缩包",
+		"error.sinkStdoutBatches":     "文件分成了 %d 批，标准输出只能写入一个压缩包，请调大每批的限制",
+		"error.sinkStdoutWatch":       "监视模式会产生多个压缩包，不能写到标准输出",
+		"error.localOnly":             "上传、推送和移入回收站需要本地的源目录",
+		"error.sinkHTTP":              "上传到 %s 失败：%s %s",
+		"flag.stdout":                 "把压缩包写到标准输出，等同于 -sink -",
+		"flag.filesFrom":              "从文件读取要打包的文件列表（- 为标准输入），按行或 NUL 分隔；列出的文件打包为一个压缩包，保留相对路径，不移动源文件",
+		"error.filesFromPath":         "路径 %q 指向当前目录之外，不能作为条目名",
+		"error.filesFromOption":       "%s 不能与 -files-from 一起使用",
+		"error.filesFromEmpty":        "文件列表中没有可打包的文件",
+		"summary.packedList":          "已将 %d 个文件打包到 %s。",
+		"flag.extractDepth":           "递归解压嵌套的 zip 和 tar 归档的层数，0 表示不解压嵌套的归档",
+		"flag.extractSubdirs":         "同时解压源目录子文件夹中的压缩包",
+		"flag.extractConflict":        "解压出的文件已存在时：overwrite（覆盖）、rename（改名保留）、skip（跳过）或 error（报错）",
+		"flag.extractMaxSize":         "每个压缩包（含嵌套的归档）最多解压出的大小，例如 10GB，0 表示不限",
+		"flag.extractMaxEntries":      "每个压缩包（含嵌套的归档）最多解压出的条目数，0 表示不限",
+		"error.extractDepth":          "无效的嵌套层数 %d，不能为负数",
+		"error.extractConflictPolicy": "无效的同名文件处理方式 %q，可选 overwrite、rename、skip 或 error",
+		"error.extractLimit":          "解压上限不能为负数",
+		"error.extractUnsafe":         "条目 %q 指向解压目录之外，已拒绝",
+		"error.extractConflict":       "%s 已存在",
+		"error.extractMaxBytes":       "解压出的内容超过了上限 %s",
+		"error.extractMaxEntries":     "解压出的条目超过了上限 %d 个",
+		"flag.extractInclude":         "只解压匹配这些通配符的条目（逗号分隔，可重复），含 / 的通配符匹配完整路径，否则匹配文件名",
+		"flag.extractExclude":         "不解压匹配这些通配符的条目（逗号分隔，可重复）",
+		"flag.extractNames":           "只解压列表文件中的条目名（- 为标准输入，按行或 NUL 分隔），也可以是 .manifest.json 清单",
+		"error.nameEncoding":          "不支持的条目名编码 %q，可选 utf-8、gbk、shift-jis（解压时还可选 auto）",
+		"flag.nameEncoding":           "压缩包中条目名的编码：utf-8 设置 UTF-8 标记，gbk 或 shift-jis 写入旧式代码页的名称以兼容旧版资源管理器",
+		"flag.extractNameEncoding":    "没有 UTF-8 标记的条目名的编码：auto 自动检测，utf-8、gbk 或 shift-jis",
+		"error.symlinks":              "不支持的符号链接处理方式 %q，可选 follow、store 或 skip",
+		"error.extractUnsafeLink":     "符号链接 %s 的目标 %q 不安全，可能指向解压目录之外",
+		"flag.symlinks":               "符号链接：follow 打包指向的文件，store 保存为链接，skip 跳过；套接字、管道和设备总是跳过",
+		"flag.extractSymlinks":        "skip 时不恢复压缩包中的符号链接，其他值恢复目标在解压目录之内的链接",
+		"error.skipPolicy":            "不支持的处理方式 %q，-hidden 和 -junk 可选 skip 或 include",
+		"flag.hidden":                 "以 . 开头的隐藏文件：skip 跳过，include 打包",
+		"flag.junk":                   "系统和临时文件（.DS_Store、Thumbs.db、desktop.ini、~$ 锁文件、交换文件等）：skip 跳过，include 打包",
+		"flag.junkPatterns":           "系统和临时文件的通配符，逗号分隔，可重复指定，替换默认列表；匹配文件名时不区分大小写",
+		"error.codePage":              "代码页 %s 的映射表已损坏：%v",
+	},
+	"en": {
+		"banner.line":                 "!!! ======================================================================== !!!",
+		"banner.warning":              "!!! An empty answer uses the default and cannot be undone; close the window to start over !!!",
+		"prompt.prefix":               "Enter the prefix for folders and archives (press Enter for the default %s): ",
+		"prompt.action":               "Choose an action:\n1. Compress files\n2. Organize files only\n3. Extract files from folders or archives\nEnter a number (1, 2 or 3): ",
+		"prompt.maxFiles":             "Enter the maximum number of files per folder (positive integer, press Enter for the default %s): ",
+		"prompt.deleteSource":         "Delete the source files after compressing? (y delete/t move to trash/n keep, press Enter for the default %s): ",
+		"prompt.extractFrom":          "Choose where to extract from:\n1. Extract files from folders\n2. Extract files from archives\nEnter a number (1 or 2): ",
+		"prompt.deleteEmpty":          "Delete the folders once they are empty? (y/n, press Enter for the default %s): ",
+		"prompt.folderPrefix":         "Only extract from folders with the given prefix? (y/n, press Enter for the default %s): ",
+		"prompt.zipPrefix":            "Only extract from archives with the given prefix? (y/n, press Enter for the default %s): ",
+		"summary.compressed":          "Files organized and compressed. The last folder number is %d.",
+		"summary.organized":           "Files organized. The last folder number is %d.",
+		"summary.extracted":           "Finished extracting files from archives.",
+		"error.invalidChoice":         "Invalid choice. Please run the program again and choose a valid option.",
+		"error.logLevel":              "invalid log level %q",
+		"error.logFormat":             "invalid log format %q, expected text or json",
+		"error.lang":                  "unsupported language %q, expected zh or en",
+		"error.zipFileCount":          "archive contains %d files, expected %d",
+		"error.maxFiles":              "maximum number of files per folder must be a positive integer: %d",
+		"progress.line":               "ETA %s batch %d/%d",
+		"flag.logLevel":               "log level: debug, info, warn or error",
+		"flag.logFormat":              "log format: text or json (one JSON object per line)",
+		"flag.logFile":                "also append the log to this file",
+		"flag.lang":                   "interface language: zh or en (defaults to the LC_ALL/LANG environment variables)",
+		"error.config":                "failed to read config file %s: %v",
+		"error.noConfig":              "profile %q was requested but no config file was found",
+		"error.profile":               "profile %q does not exist in config file %s",
+		"error.batchBy":               "invalid batching strategy %q, expected count or size",
+		"error.maxBatchSize":          "maximum batch size must be positive when batching by size: %d",
+		"error.format":                "unsupported archive format %q",
+		"error.deletePolicy":          "invalid delete policy %q, expected keep, delete or trash",
+		"error.size":                  "invalid size %q",
+		"error.extractFrom":           "invalid extraction source %q, expected zips or folders",
+		"error.unknownCommand":        "unknown command %q",
+		"usage.header":                "Usage: %s [options] [command [command options]]\nWithout a command the program runs interactively.\nCommands:\n  pack      organize files and compress them\n  organize  organize files only\n  extract   extract files from archives or folders\n  restore   list or restore folders from the trash\n  watch     keep watching the source directory and compress files in batches once they are complete\n  repack    re-batch existing archives with new batch settings\n  merge     combine several archives into one\n  split     break one archive into several\n  convert   convert archives between zip, tar, tar.gz and tar.zst\n  list      list archive entries with statistics\n  upload    upload archives to S3-compatible object storage, resuming interrupted uploads\n  push      push archives to a server over SFTP\n  test      fully check archives and exit with a non-zero status on problems\n  verify    check archives against checksum files such as SHA256SUMS/B3SUMS\nOptions:",
+		"flag.config":                 "config file path (defaults to marszip.json in the source directory, the program directory or the user config directory)",
+		"flag.profile":                "use this profile from the config file",
+		"flag.dir":                    "source directory (defaults to the program directory)",
+		"flag.prefix":                 "prefix for folders and archives",
+		"flag.maxFiles":               "maximum number of files per folder",
+		"flag.batchBy":                "batching strategy: count (number of files) or size (total size)",
+		"flag.maxBatchSize":           "maximum size of a batch when batching by size, e.g. 500MB",
+		"flag.format":                 "archive format",
+		"flag.include":                "only process files whose names match these comma-separated wildcards",
+		"flag.exclude":                "skip files whose names match these comma-separated wildcards",
+		"flag.delete":                 "what to do with the source files after compressing: keep, delete or trash (move to the trash)",
+		"flag.from":                   "extraction source: zips (archives) or folders",
+		"flag.onlyWithPrefix":         "only extract from archives or folders with the prefix",
+		"flag.deleteEmpty":            "delete folders once they are empty",
+		"error.restoreExists":         "original location %s already exists, cannot restore",
+		"error.notInTrash":            "%s is not in the trash",
+		"summary.restored":            "Restored %d item(s) from the trash.",
+		"flag.trashDir":               "trash directory (defaults to the desktop trash on Linux and .marszip-trash in the source directory elsewhere)",
+		"flag.trashDays":              "days to keep items in the trash, 0 means forever",
+		"flag.trashMaxSize":           "maximum total size of the trash, e.g. 10GB, 0 means unlimited",
+		"flag.restoreAll":             "restore every item in the trash",
+		"flag.restorePrefix":          "only handle items whose original name starts with this",
+		"flag.watchInterval":          "how often to check the flush timeout; also how often to scan the source directory where inotify is unavailable",
+		"flag.watchStable":            "how long a file's size and modification time must stay unchanged before it is checked for open writers and considered complete",
+		"flag.watchFlushAfter":        "how long a file may wait before it is packed even if its batch is not full",
+		"test.truncated":              "archive is truncated: %v",
+		"test.badDirectory":           "central directory is damaged or the file is not a zip: %v",
+		"test.crcMismatch":            "CRC32 mismatch",
+		"test.badMethod":              "unsupported compression method",
+		"test.corrupt":                "corrupt data: %v",
+		"test.badManifest":            "cannot read the manifest: %v",
+		"test.missingEntry":           "listed in the manifest but missing from the archive",
+		"test.extraEntry":             "present in the archive but not listed in the manifest",
+		"test.sizeMismatch":           "size is %d, the manifest says %d",
+		"test.manifestCRC":            "CRC32 is %08x, the manifest says %08x",
+		"summary.tested":              "Checked %d archive(s), %d with problems.",
+		"error.testFailed":            "%d archive(s) failed the check",
+		"flag.manifest":               "write a manifest with the size and CRC32 of every entry next to each archive",
+		"flag.testOnlyWithPrefix":     "only check archives that start with the prefix",
+		"verify.mismatch":             "checksum is %s, expected %s",
+		"summary.verified":            "Checked %d checksum(s), %d mismatched or missing.",
+		"error.verifyFailed":          "%d file(s) failed the checksum check",
+		"error.noChecksums":           "no checksum files found",
+		"error.checksums":             "invalid checksum mode %q, expected none, sidecar or sums",
+		"error.checksumAlgorithm":     "unsupported checksum algorithm %q, expected sha256 or blake3",
+		"flag.checksums":              "checksum files: none, sidecar (one file per archive) or sums (SHA256SUMS/B3SUMS in the output directory)",
+		"flag.checksumAlgorithm":      "checksum algorithm: sha256 or blake3",
+		"test.missingAlias":           "the copy %s this duplicate refers to is missing from the archive",
+		"error.dedup":                 "invalid deduplication mode %q, expected off, skip, alias or separate",
+		"flag.dedup":                  "files with duplicate content: off (no check), skip (leave them in place), alias (pack one copy and record the others in the manifest) or separate (put them in a dupes batch)",
+		"flag.incremental":            "incremental mode: skip files recorded as already archived in .marszip-state.json",
+		"flag.topUp":                  "top up the last incomplete archive first (rewritten safely via a temporary file and rename), then start new batches",
+		"flag.toPrefix":               "prefix for the new archives, defaults to -prefix",
+		"flag.level":                  "Deflate compression level 0-9, -1 copies the compressed data as is",
+		"flag.repackDelete":           "what to do with the old archives once the new ones are verified: delete, trash (move to the trash) or keep (requires -to-prefix)",
+		"error.level":                 "invalid compression level %d, expected -1 to 9",
+		"error.repackKeep":            "keeping the old archives requires a different prefix via -to-prefix",
+		"error.repackMissing":         "entry is missing from the new archive",
+		"error.repackChanged":         "size or CRC32 in the new archive differs from the old archive",
+		"summary.repacked":            "Repacking finished, %d archive(s) written.",
+		"flag.mergeOutput":            "path of the merged archive (required)",
+		"flag.mergeConflict":          "how to handle entries with the same name: rename, skip (keep the first) or error",
+		"flag.mergeDelete":            "what to do with the original archives once the new ones are verified: keep, delete or trash (move to the trash)",
+		"flag.splitPrefix":            "prefix for the resulting archives, defaults to \"<original name>_\"",
+		"error.mergeConflictPolicy":   "invalid conflict handling %q, expected rename, skip or error",
+		"error.mergeConflict":         "entry %s has the same name as an entry in an earlier archive",
+		"error.mergeArgs":             "at least two archives are needed to merge",
+		"error.mergeOutput":           "the output must not be one of the archives being merged",
+		"error.mergeNoOutput":         "specify the merged archive path with -o",
+		"error.splitArgs":             "specify exactly one archive to split",
+		"summary.merged":              "Merged %d archive(s) into %s.",
+		"summary.split":               "Split %s into %d archive(s).",
+		"flag.convertTo":              "target format: zip, tar, tar.gz or tar.zst (requires the zstd program)",
+		"flag.convertOutput":          "output path, only with a single input; defaults to the input with its extension replaced",
+		"error.archiveFormat":         "unsupported archive format %q, expected zip, tar, tar.gz or tar.zst",
+		"error.archiveFormatOf":       "cannot tell the archive format from the file extension",
+		"error.zstdMissing":           "the zstd program was not found, install zstd to handle tar.zst",
+		"error.convertExtra":          "unexpected entry in the converted archive",
+		"error.convertMissing":        "present in the input archive but missing from the converted one",
+		"error.convertSize":           "size is %d, the input archive says %d",
+		"error.convertCRC":            "CRC32 is %08x, the input archive says %08x",
+		"error.convertLink":           "link target is %q, the input archive says %q",
+		"error.convertArgs":           "specify the archives to convert",
+		"error.convertOutput":         "-o cannot be used when converting several archives",
+		"summary.converted":           "Converted %d archive(s) to %s.",
+		"flag.listOutput":             "output format: table, csv or json",
+		"list.header":                 "Size\tCompressed\tRatio\tMethod\tModified\tCRC32\tName",
+		"list.files":                  "total: %d file(s)",
+		"list.total":                  "total: %d archive(s), %d file(s)",
+		"error.listFormat":            "invalid output format %q, expected table, csv or json",
+		"flag.uploadEndpoint":         "S3-compatible endpoint, e.g. https://s3.amazonaws.com or http://127.0.0.1:9000; archives are uploaded after compressing when set",
+		"flag.uploadRegion":           "region used for signing, defaults to us-east-1",
+		"flag.uploadBucket":           "bucket name",
+		"flag.uploadKey":              "object key template with {name}, {prefix}, {date}, {year}, {month}, {day} and {host}, defaults to {name}",
+		"flag.uploadVirtualHost":      "use bucket.host addressing (defaults to host/bucket path style)",
+		"flag.uploadPartSize":         "part size for multipart uploads, used for archives larger than this, at least 5MiB",
+		"flag.uploadDeleteLocal":      "delete the local archive once the upload is confirmed",
+		"error.uploadEndpoint":        "invalid object storage endpoint %q",
+		"error.uploadCredentials":     "no credentials, set uploadAccessKey and uploadSecretKey in the config file or the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables",
+		"error.uploadNotConfigured":   "uploading needs both an endpoint and a bucket",
+		"error.uploadPartSize":        "invalid part size %d, must be at least 5MiB",
+		"error.uploadETag":            "the server ETag is %s, expected %s",
+		"error.uploadSize":            "the server object size is %d, the local size is %d",
+		"error.uploadResponse":        "cannot parse the server response",
+		"error.uploadFailed":          "%d archive(s) failed to upload",
+		"summary.uploaded":            "Uploaded %d archive(s), %d failed.",
+		"flag.push":                   "SFTP target sftp://[user@]host[:port][/dir], /~/dir is relative to the remote home; archives are pushed after compressing when set",
+		"flag.pushIdentity":           "SSH private key file, defaults to the ssh configuration",
+		"flag.pushRetries":            "maximum number of attempts when pushing fails",
+		"error.pushTarget":            "invalid SFTP target %q, expected sftp://[user@]host[:port][/dir]",
+		"error.pushRetries":           "invalid number of attempts %d, must be at least 1",
+		"error.pushMissing":           "the file is missing on the server after uploading",
+		"error.pushSize":              "the remote size is %d, the local size is %d",
+		"error.pushNotConfigured":     "specify the SFTP target with -push",
+		"error.pushFailed":            "%d archive(s) failed to push",
+		"summary.pushed":              "Pushed %d archive(s), %d failed.",
+		"flag.sink":                   "where archives are written: empty for the source directory, - for stdout (single batch only), an http(s):// URL for a streaming PUT ({name} is replaced by the file name, a trailing / appends it), s3 for streaming into the -upload-* bucket",
+		"error.sink":                  "invalid sink %q, expected -, s3 or an http(s):// URL",
+		"error.sinkLocalOnly":         "%[2]s cannot be used with sink %[1]s, it needs a local archive",
+		"error.sinkStdoutOnce":        "only one archive can be written to stdout",
+		"error.sinkStdoutBatches":     "files were split into %d batches but only one archive can be written to stdout, raise the batch limit",
+		"error.sinkStdoutWatch":       "watch mode produces many archives and cannot write to stdout",
+		"error.localOnly":             "upload, push and the trash delete policy need a local source directory",
+		"error.sinkHTTP":              "upload to %s failed: %s %s",
+		"flag.stdout":                 "write the archive to stdout, same as -sink -",
+		"flag.filesFrom":              "read the files to pack from a list file (- for stdin), newline or NUL separated; the listed files go into one archive with their relative paths and are not moved",
+		"error.filesFromPath":         "path %q points outside the current directory and cannot be used as an entry name",
+		"error.filesFromOption":       "%s cannot be used with -files-from",
+		"error.filesFromEmpty":        "the file list contains no files to pack",
+		"summary.packedList":          "Packed %d files into %s.",
+		"flag.extractDepth":           "how many levels of nested zip and tar archives to extract, 0 leaves nested archives packed",
+		"flag.extractSubdirs":         "also extract archives in subdirectories of the source directory",
+		"flag.extractConflict":        "when an extracted file already exists: overwrite, rename, skip or error",
+		"flag.extractMaxSize":         "maximum size extracted from each archive including nested ones, e.g. 10GB, 0 means unlimited",
+		"flag.extractMaxEntries":      "maximum number of entries extracted from each archive including nested ones, 0 means unlimited",
+		"error.extractDepth":          "invalid nesting depth %d, must not be negative",
+		"error.extractConflictPolicy": "invalid conflict handling %q, expected overwrite, rename, skip or error",
+		"error.extractLimit":          "extraction limits must not be negative",
+		"error.extractUnsafe":         "entry %q points outside the extraction folder and was refused",
+		"error.extractConflict":       "%s already exists",
+		"error.extractMaxBytes":       "extracted content exceeds the limit of %s",
+		"error.extractMaxEntries":     "extracted entries exceed the limit of %d",
+		"flag.extractInclude":         "only extract entries matching these wildcards (comma separated, repeatable); wildcards with / match the full path, others the file name",
+		"flag.extractExclude":         "skip entries matching these wildcards (comma separated, repeatable)",
+		"flag.extractNames":           "only extract the entry names in a list file (- for stdin, newline or NUL separated), or in a .manifest.json manifest",
+		"error.nameEncoding":          "unsupported entry name encoding %q, use utf-8, gbk or shift-jis (or auto when extracting)",
+		"flag.nameEncoding":           "encoding of entry names in the zip: utf-8 sets the UTF-8 flag, gbk or shift-jis write legacy code page names for old Windows Explorer",
+		"flag.extractNameEncoding":    "encoding of entry names without the UTF-8 flag: auto to detect, utf-8, gbk or shift-jis",
+		"error.symlinks":              "unsupported symlink policy %q, expected follow, store or skip",
+		"error.extractUnsafeLink":     "unsafe target %[2]q for symlink %[1]s, it may point outside the extraction folder",
+		"flag.symlinks":               "symlinks: follow packs the target file, store keeps the link, skip leaves it out; sockets, FIFOs and devices are always skipped",
+		"flag.extractSymlinks":        "skip does not restore symlinks from archives, other values restore links whose target stays inside the extraction folder",
+		"error.skipPolicy":            "unsupported policy %q, -hidden and -junk accept skip or include",
+		"flag.hidden":                 "hidden files starting with a dot: skip leaves them out, include packs them",
+		"flag.junk":                   "system and temporary files (.DS_Store, Thumbs.db, desktop.ini, ~$ lock files, swap files, ...): skip leaves them out, include packs them",
+		"flag.junkPatterns":           "wildcards for system and temporary files, comma separated and repeatable, replacing the default list; matched case-insensitively against file names",
+		"error.codePage":              "the %s code page table is corrupt: %v",
+	},
+}
+
+// msg 返回当前语言下的消息文本，缺失时回退到中文
+func msg(key string, args ...interface{}) string {
+	text, ok := catalogs[locale][key]
+	if !ok {
+		text, ok = catalogs["zh"][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// parseLocale 将 zh_CN.UTF-8、en_US 等语言标识归一化为目录中的语言，无法识别时返回空字符串
+func parseLocale(value string) string {
+	value = strings.ToLower(value)
+	if i := strings.IndexAny(value, "_.-@"); i >= 0 {
+		value = value[:i]
+	}
+	switch value {
+	case "zh":
+		return "zh"
+	case "en", "c", "posix":
+		return "en"
+	}
+	return ""
+}
+
+// langFromArgs 在解析参数之前从命令行中找出 -lang 的值
+func langFromArgs(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(name, "lang=") {
+			return strings.TrimPrefix(name, "lang=")
+		}
+		if name == "lang" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// detectLocale 依次根据 LC_ALL 和 LANG 环境变量确定界面语言，默认使用中文
+func detectLocale() string {
+	for _, name := range []string{"LC_ALL", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if l := parseLocale(value); l != "" {
+				return l
+			}
+			break
+		}
+	}
+	return "zh"
+}
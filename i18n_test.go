@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestCatalogParity 中英文目录的消息键相同，同一条消息的格式化占位符数量相同
+func TestCatalogParity(t *testing.T) {
+	verb := regexp.MustCompile(`%(\[\d+\])?[-+# 0]*\d*(\.\d+)?[a-zA-Z]`)
+	zh, en := catalogs["zh"], catalogs["en"]
+	for key, text := range zh {
+		other, ok := en[key]
+		if !ok {
+			t.Errorf("%s: missing in en", key)
+			continue
+		}
+		if a, b := len(verb.FindAllString(text, -1)), len(verb.FindAllString(other, -1)); a != b {
+			t.Errorf("%s: %d verbs in zh, %d in en", key, a, b)
+		}
+	}
+	for key := range en {
+		if _, ok := zh[key]; !ok {
+			t.Errorf("%s: missing in zh", key)
+		}
+	}
+}
+
+// TestCatalogKeysUsed 源代码中用到的消息键都在目录中
+func TestCatalogKeysUsed(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	use := regexp.MustCompile(`msg\("([A-Za-z0-9.]+)"`)
+	found := 0
+	for _, name := range files {
+		if name == "zip.go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range use.FindAllStringSubmatch(string(data), -1) {
+			found++
+			if _, ok := catalogs["zh"][m[1]]; !ok {
+				t.Errorf("%s: unknown message key %s", name, m[1])
+			}
+		}
+	}
+	if found == 0 {
+		t.Error("no message keys found")
+	}
+}
+
+// TestMsg 按当前语言选择目录，缺失的键回退到中文，再缺失时返回键本身
+func TestMsg(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	catalogs["zh"]["test.onlyZh"] = "只有中文 %d"
+	defer delete(catalogs["zh"], "test.onlyZh")
+
+	locale = "en"
+	if got := msg("error.filesFromEmpty"); got != catalogs["en"]["error.filesFromEmpty"] {
+		t.Errorf("en: %q", got)
+	}
+	if got := msg("test.onlyZh", 3); got != "只有中文 3" {
+		t.Errorf("fallback to zh: %q", got)
+	}
+	if got := msg("test.missing"); got != "test.missing" {
+		t.Errorf("missing key: %q", got)
+	}
+	locale = "zh"
+	if got := msg("error.filesFromEmpty"); got != catalogs["zh"]["error.filesFromEmpty"] {
+		t.Errorf("zh: %q", got)
+	}
+}
+
+// TestLocaleSelection -lang 优先于环境变量，LC_ALL 优先于 LANG，无法识别的值使用中文
+func TestLocaleSelection(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"zh_CN.UTF-8", "zh"}, {"en_US.UTF-8", "en"}, {"EN", "en"}, {"C", "en"}, {"POSIX", "en"}, {"de_DE", ""}, {"", ""},
+	} {
+		if got := parseLocale(tt.in); got != tt.want {
+			t.Errorf("parseLocale(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-lang", "en", "pack"}, "en"},
+		{[]string{"--lang=zh", "pack"}, "zh"},
+		{[]string{"pack", "-max-files", "3"}, ""},
+		{[]string{"-lang"}, ""},
+	} {
+		if got := langFromArgs(tt.args); got != tt.want {
+			t.Errorf("langFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	t.Setenv("LC_ALL", "en_US.UTF-8")
+	t.Setenv("LANG", "zh_CN.UTF-8")
+	if got := detectLocale(); got != "en" {
+		t.Errorf("LC_ALL before LANG: %q", got)
+	}
+	t.Setenv("LC_ALL", "")
+	if got := detectLocale(); got != "zh" {
+		t.Errorf("LANG: %q", got)
+	}
+	t.Setenv("LANG", "fr_FR.UTF-8")
+	if got := detectLocale(); got != "zh" {
+		t.Errorf("unknown locale: %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// describeReadError 将读取压缩包时的错误归类为截断、中央目录损坏、CRC 不匹配等问题
+func describeReadError(err error) string {
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return msg("test.truncated", err)
+	case errors.Is(err, zip.ErrFormat):
+		return msg("test.badDirectory", err)
+	case errors.Is(err, zip.ErrChecksum):
+		return msg("test.crcMismatch")
+	case errors.Is(err, zip.ErrAlgorithm):
+		return msg("test.badMethod")
+	}
+	return msg("test.corrupt", err)
+}
+
+// hasZipLocalHeader 判断文件是否以 zip 本地文件头签名开头
+func hasZipLocalHeader(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sig := make([]byte, 4)
+	_, err = io.ReadFull(f, sig)
+	return err == nil && string(sig) == "PK\x03\x04"
+}
+
+// testArchive 完整解压压缩包中的每个条目以校验 CRC32，并与清单（如果有）比对，返回发现的问题
+func testArchive(zipFilePath string) []string {
+	var problems []string
+	stat, err := os.Stat(zipFilePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	reader, err := zip.OpenReader(zipFilePath)
+	if err != nil {
+		// 以本地文件头开头却找不到中央目录，通常是写入或传输时被截断
+		if errors.Is(err, zip.ErrFormat) && hasZipLocalHeader(zipFilePath) {
+			return []string{msg("test.truncated", err)}
+		}
+		return []string{describeReadError(err)}
+	}
+	defer reader.Close()
+
+	entries := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		entries[file.Name] = file
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		// 数据区超出文件末尾说明压缩包被截断
+		if offset, err := file.DataOffset(); err == nil && offset+int64(file.CompressedSize64) > stat.Size() {
+			problems = append(problems, file.Name+": "+msg("test.truncated", io.ErrUnexpectedEOF))
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			problems = append(problems, file.Name+": "+describeReadError(err))
+			continue
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			problems = append(problems, file.Name+": "+describeReadError(err))
+		}
+	}
+
+	manifest, err := readManifest(localFile(zipFilePath))
+	if err != nil {
+		problems = append(problems, msg("test.badManifest", err))
+	}
+	if manifest != nil {
+		listed := make(map[string]bool)
+		for _, want := range manifest.Entries {
+			listed[want.Name] = true
+			if want.AliasOf != "" {
+				// 重复文件只在清单中记录，检查其保留副本存在即可
+				if _, ok := entries[want.AliasOf]; !ok {
+					problems = append(problems, want.Name+": "+msg("test.missingAlias", want.AliasOf))
+				}
+				continue
+			}
+			file, ok := entries[want.Name]
+			switch {
+			case !ok:
+				problems = append(problems, want.Name+": "+msg("test.missingEntry"))
+			case file.UncompressedSize64 != want.Size:
+				problems = append(problems, want.Name+": "+msg("test.sizeMismatch", file.UncompressedSize64, want.Size))
+			case file.CRC32 != want.CRC32:
+				problems = append(problems, want.Name+": "+msg("test.manifestCRC", file.CRC32, want.CRC32))
+			}
+		}
+		for _, file := range reader.File {
+			if !file.FileInfo().IsDir() && !listed[file.Name] {
+				problems = append(problems, file.Name+": "+msg("test.extraEntry"))
+			}
+		}
+	}
+	return problems
+}
+
+// findArchives 递归查找目录中的 .zip 文件，onlyWithPrefix 为 true 时只返回以 prefix 开头的压缩包
+func findArchives(dir, prefix string, onlyWithPrefix bool) ([]string, error) {
+	var archives []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == trashDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), ".zip") && (!onlyWithPrefix || strings.HasPrefix(d.Name(), prefix)) {
+			archives = append(archives, path)
+		}
+		return nil
+	})
+	return archives, err
+}
+
+// testArchives 校验多个压缩包，有任何一个出现问题时返回错误
+func testArchives(archives []string) error {
+	failed := 0
+	for _, archive := range archives {
+		start := time.Now()
+		problems := testArchive(archive)
+		if len(problems) == 0 {
+			logger.Info("test ok", "src", archive, "duration", time.Since(start))
+			continue
+		}
+		failed++
+		for _, problem := range problems {
+			logger.Error("test failed", "src", archive, "problem", problem)
+		}
+	}
+	fmt.Fprintln(statusOut, msg("summary.tested", len(archives), failed))
+	if failed > 0 {
+		return errors.New(msg("error.testFailed", failed))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStoredZip 写入不压缩的压缩包，条目内容在文件中原样可见，便于测试中改坏
+func writeStoredZip(t *testing.T, path string, files map[string]string, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestTestArchive 截断、中央目录损坏、数据损坏的压缩包分别报告对应的问题，完好的压缩包没有问题
+func TestTestArchive(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": strings.Repeat("alpha ", 50), "b.txt": strings.Repeat("bravo ", 50)}
+	good := filepath.Join(dir, "good.zip")
+	data := writeStoredZip(t, good, files, "a.txt", "b.txt")
+	if problems := testArchive(good); len(problems) != 0 {
+		t.Fatalf("good archive: %q", problems)
+	}
+
+	cd := bytes.Index(data, []byte("PK\x01\x02"))
+	corrupt := func(name string, edit func([]byte) []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, edit(bytes.Clone(data)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"cut in the data", corrupt("cut.zip", func(b []byte) []byte { return b[:len(b)/3] }), "truncated"},
+		{"cut in the central directory", corrupt("cutdir.zip", func(b []byte) []byte { return b[:cd+10] }), "truncated"},
+		{"damaged central directory", corrupt("baddir.zip", func(b []byte) []byte {
+			copy(b[cd:], "XXXX")
+			return b
+		}), "truncated"},
+		{"not a zip", corrupt("text.zip", func([]byte) []byte { return []byte(strings.Repeat("not a zip\n", 10)) }), "central directory is damaged"},
+		{"flipped data byte", corrupt("crc.zip", func(b []byte) []byte {
+			b[bytes.Index(b, []byte("bravo"))] = 'B'
+			return b
+		}), "b.txt: CRC32 mismatch"},
+		{"missing", filepath.Join(dir, "missing.zip"), "no such file"},
+	}
+	for _, tt := range tests {
+		problems := testArchive(tt.path)
+		if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+			t.Errorf("%s: %q, want one problem containing %q", tt.name, problems, tt.want)
+		}
+	}
+}
+
+// TestTestArchiveManifest 压缩包与清单不一致时逐项报告缺少、多出、大小和 CRC32 不符的条目，以及保留副本缺失的重复文件
+func TestTestArchiveManifest(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "P_1.zip")
+	files := map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "charlie", "d.txt": "delta"}
+	writeStoredZip(t, path, files, "a.txt", "b.txt", "c.txt", "d.txt")
+	fsys, name := localFile(path)
+	if err := writeManifest(fsys, name, map[string]string{"a2.txt": "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if problems := testArchive(path); len(problems) != 0 {
+		t.Fatalf("matching manifest: %q", problems)
+	}
+
+	manifest, err := readManifest(fsys, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []manifestEntry
+	for _, entry := range manifest.Entries {
+		switch entry.Name {
+		case "a.txt":
+			entry.Size++
+		case "b.txt":
+			entry.CRC32++
+		case "c.txt":
+			continue // 压缩包中多出
+		case "a2.txt":
+			entry.AliasOf = "gone.txt"
+		}
+		entries = append(entries, entry)
+	}
+	manifest.Entries = append(entries, manifestEntry{Name: "e.txt", Size: 1})
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+manifestSuffix, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(testArchive(path), "\n")
+	for _, want := range []string{
+		"a.txt: size is 5, the manifest says 6",
+		"b.txt: CRC32 is",
+		"c.txt: present in the archive but not listed",
+		"e.txt: listed in the manifest but missing",
+		"a2.txt: the copy gone.txt",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("problems %q do not contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "d.txt") {
+		t.Errorf("d.txt matches the manifest but was reported: %q", got)
+	}
+
+	if err := os.WriteFile(path+manifestSuffix, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := testArchive(path); len(got) != 1 || !strings.Contains(got[0], "cannot read the manifest") {
+		t.Errorf("broken manifest: %q", got)
+	}
+}
+
+// TestTestArchives 有压缩包未通过时返回错误，回收站目录中的压缩包不参与查找
+func TestTestArchives(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	defer func(w io.Writer) { statusOut = w }(statusOut)
+	locale, statusOut = "en", io.Discard
+	dir := t.TempDir()
+	writeStoredZip(t, filepath.Join(dir, "P_1.zip"), map[string]string{"a": "a"}, "a")
+	writeStoredZip(t, filepath.Join(dir, "other.zip"), map[string]string{"a": "a"}, "a")
+	if err := os.MkdirAll(filepath.Join(dir, trashDirName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeStoredZip(t, filepath.Join(dir, trashDirName, "P_2.zip"), map[string]string{"a": "a"}, "a")
+
+	archives, err := findArchives(dir, "P_", true)
+	if err != nil || len(archives) != 1 || filepath.Base(archives[0]) != "P_1.zip" {
+		t.Fatalf("findArchives = %q, %v", archives, err)
+	}
+	if archives, _ := findArchives(dir, "P_", false); len(archives) != 2 {
+		t.Errorf("findArchives without prefix = %q", archives)
+	}
+	if err := testArchives(archives); err != nil {
+		t.Errorf("good archives: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "other.zip"), []byte("PK\x03\x04"), 0o644)
+	archives, _ = findArchives(dir, "P_", false)
+	if err := testArchives(archives); err == nil || !strings.Contains(err.Error(), "1") {
+		t.Errorf("bad archive: %v", err)
+	}
+}
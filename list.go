@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// listEntry list 命令输出的一个文件条目
+type listEntry struct {
+	Name       string    `json:"name"`
+	Size       uint64    `json:"size"`
+	Compressed uint64    `json:"compressed"`
+	Ratio      float64   `json:"ratio"` // 压缩节省的百分比
+	Method     string    `json:"method"`
+	Modified   time.Time `json:"modified"`
+	CRC32      string    `json:"crc32"`
+}
+
+// listTotals 一组条目的合计
+type listTotals struct {
+	Archives   int     `json:"archives,omitempty"`
+	Files      int     `json:"files"`
+	Size       uint64  `json:"size"`
+	Compressed uint64  `json:"compressed"`
+	Ratio      float64 `json:"ratio"`
+}
+
+// archiveListing 一个压缩包的内容和合计
+type archiveListing struct {
+	Archive string      `json:"archive"`
+	Entries []listEntry `json:"entries"`
+	Totals  listTotals  `json:"totals"`
+}
+
+// compressionRatio 返回压缩节省的百分比，保留一位小数
+func compressionRatio(size, compressed uint64) float64 {
+	if size == 0 {
+		return 0
+	}
+	return math.Round((1-float64(compressed)/float64(size))*1000) / 10
+}
+
+// methodName 返回压缩方法的名称
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	}
+	return fmt.Sprintf("method-%d", method)
+}
+
+// add 把一个条目计入合计
+func (t *listTotals) add(size, compressed uint64) {
+	t.Files++
+	t.Size += size
+	t.Compressed += compressed
+	t.Ratio = compressionRatio(t.Size, t.Compressed)
+}
+
+// listArchive 从中央目录读取压缩包中的文件条目，不解压数据
+func listArchive(zipFilePath string) (archiveListing, error) {
+	listing := archiveListing{Archive: zipFilePath, Entries: []listEntry{}}
+	reader, err := zip.OpenReader(zipFilePath)
+	if err != nil {
+		return listing, fmt.Errorf("%s: %w", zipFilePath, err)
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		listing.Entries = append(listing.Entries, listEntry{
+			Name:       file.Name,
+			Size:       file.UncompressedSize64,
+			Compressed: file.CompressedSize64,
+			Ratio:      compressionRatio(file.UncompressedSize64, file.CompressedSize64),
+			Method:     methodName(file.Method),
+			Modified:   file.Modified,
+			CRC32:      fmt.Sprintf("%08x", file.CRC32),
+		})
+		listing.Totals.add(file.UncompressedSize64, file.CompressedSize64)
+	}
+	return listing, nil
+}
+
+// printListings 以 table、csv 或 json 格式输出压缩包内容，多个压缩包时附加总计
+func printListings(out io.Writer, listings []archiveListing, format string) error {
+	var total listTotals
+	for _, listing := range listings {
+		total.Archives++
+		total.Files += listing.Totals.Files
+		total.Size += listing.Totals.Size
+		total.Compressed += listing.Totals.Compressed
+	}
+	total.Ratio = compressionRatio(total.Size, total.Compressed)
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Archives []archiveListing `json:"archives"`
+			Totals   listTotals       `json:"totals"`
+		}{listings, total})
+	case "csv":
+		// 合计行的 name 列为 (total)，总计行的 archive 列为 (all)
+		w := csv.NewWriter(out)
+		w.Write([]string{"archive", "name", "size", "compressed", "ratio", "method", "modified", "crc32"})
+		for _, listing := range listings {
+			for _, e := range listing.Entries {
+				w.Write([]string{listing.Archive, e.Name, strconv.FormatUint(e.Size, 10), strconv.FormatUint(e.Compressed, 10),
+					strconv.FormatFloat(e.Ratio, 'f', 1, 64), e.Method, e.Modified.Format(time.RFC3339), e.CRC32})
+			}
+			t := listing.Totals
+			w.Write([]string{listing.Archive, "(total)", strconv.FormatUint(t.Size, 10), strconv.FormatUint(t.Compressed, 10),
+				strconv.FormatFloat(t.Ratio, 'f', 1, 64), "", "", ""})
+		}
+		w.Write([]string{"(all)", "(total)", strconv.FormatUint(total.Size, 10), strconv.FormatUint(total.Compressed, 10),
+			strconv.FormatFloat(total.Ratio, 'f', 1, 64), "", "", ""})
+		w.Flush()
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for i, listing := range listings {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, listing.Archive)
+			fmt.Fprintln(w, msg("list.header"))
+			for _, e := range listing.Entries {
+				fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%s\t%s\t%s\t%s\n", formatBytes(int64(e.Size)), formatBytes(int64(e.Compressed)),
+					e.Ratio, e.Method, e.Modified.Local().Format("2006-01-02 15:04:05"), e.CRC32, e.Name)
+			}
+			t := listing.Totals
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\t\t\t\t%s\n", formatBytes(int64(t.Size)), formatBytes(int64(t.Compressed)), t.Ratio, msg("list.files", t.Files))
+		}
+		if len(listings) > 1 {
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\t\t\t\t%s\n", formatBytes(int64(total.Size)), formatBytes(int64(total.Compressed)), total.Ratio, msg("list.total", total.Archives, total.Files))
+		}
+		return w.Flush()
+	}
+	return errors.New(msg("error.listFormat", format))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listTestArchives 写入两个压缩包：一个只有不压缩的条目，一个有文件夹条目和 Deflate 压缩的条目
+func listTestArchives(t *testing.T) []archiveListing {
+	t.Helper()
+	dir := t.TempDir()
+	stored := filepath.Join(dir, "s.zip")
+	writeStoredZip(t, stored, map[string]string{"a.txt": strings.Repeat("a", 100)}, "a.txt")
+
+	deflated := filepath.Join(dir, "d.zip")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("d/")
+	for _, name := range []string{"d/b.txt", "d/c.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes.Repeat([]byte("bc"), 500))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deflated, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var listings []archiveListing
+	for _, path := range []string{stored, deflated} {
+		listing, err := listArchive(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listings = append(listings, listing)
+	}
+	return listings
+}
+
+// TestListArchive 只列出文件条目，合计大小、压缩后大小和压缩率
+func TestListArchive(t *testing.T) {
+	listings := listTestArchives(t)
+	s, d := listings[0], listings[1]
+	if len(s.Entries) != 1 || s.Entries[0].Method != "store" || s.Entries[0].Ratio != 0 || s.Entries[0].Size != 100 {
+		t.Errorf("stored entries %+v", s.Entries)
+	}
+	if len(d.Entries) != 2 || d.Entries[0].Name != "d/b.txt" || d.Entries[0].Method != "deflate" || d.Entries[0].Ratio < 90 {
+		t.Errorf("deflated entries %+v", d.Entries)
+	}
+	if d.Totals.Files != 2 || d.Totals.Size != 2000 || d.Totals.Compressed != d.Entries[0].Compressed+d.Entries[1].Compressed ||
+		d.Totals.Ratio != compressionRatio(2000, d.Totals.Compressed) {
+		t.Errorf("totals %+v", d.Totals)
+	}
+	if _, err := listArchive(filepath.Join(t.TempDir(), "missing.zip")); err == nil {
+		t.Error("missing archive listed")
+	}
+}
+
+func TestCompressionRatio(t *testing.T) {
+	for _, tt := range []struct {
+		size, compressed uint64
+		want             float64
+	}{
+		{0, 0, 0}, {200, 50, 75}, {3, 2, 33.3}, {10, 12, -20},
+	} {
+		if got := compressionRatio(tt.size, tt.compressed); got != tt.want {
+			t.Errorf("compressionRatio(%d, %d) = %v, want %v", tt.size, tt.compressed, got, tt.want)
+		}
+	}
+}
+
+// TestPrintListings json 和 csv 带有每个压缩包的合计和总计，table 在多个压缩包时输出总计行
+func TestPrintListings(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	listings := listTestArchives(t)
+	size := listings[0].Totals.Size + listings[1].Totals.Size
+	compressed := listings[0].Totals.Compressed + listings[1].Totals.Compressed
+
+	var out bytes.Buffer
+	if err := printListings(&out, listings, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Archives []archiveListing `json:"archives"`
+		Totals   listTotals       `json:"totals"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if want := (listTotals{Archives: 2, Files: 3, Size: size, Compressed: compressed, Ratio: compressionRatio(size, compressed)}); decoded.Totals != want {
+		t.Errorf("json totals %+v, want %+v", decoded.Totals, want)
+	}
+	if len(decoded.Archives) != 2 || decoded.Archives[1].Entries[1].Name != "d/c.txt" {
+		t.Errorf("json archives %+v", decoded.Archives)
+	}
+
+	out.Reset()
+	if err := printListings(&out, listings, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 表头、3 个条目、2 个合计行、1 个总计行
+	if len(rows) != 7 || rows[0][1] != "name" || rows[2][1] != "(total)" || rows[2][2] != "100" {
+		t.Errorf("csv rows %q", rows)
+	}
+	if last := rows[len(rows)-1]; last[0] != "(all)" || last[2] != "2100" {
+		t.Errorf("csv grand total %q", last)
+	}
+
+	out.Reset()
+	if err := printListings(&out, listings, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "total: 1 file(s)") || !strings.Contains(got, "total: 2 archive(s), 3 file(s)") ||
+		!strings.Contains(got, "d/b.txt") {
+		t.Errorf("table output:\n%s", got)
+	}
+	out.Reset()
+	printListings(&out, listings[:1], "table")
+	if strings.Contains(out.String(), "archive(s)") {
+		t.Errorf("grand total for a single archive:\n%s", out.String())
+	}
+
+	if err := printListings(&out, listings, "xml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
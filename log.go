@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logFilePath 日志文件的绝对路径，打包时需跳过该文件
+var logFilePath string
+
+// isToolFile 判断路径是否为程序自身正在使用的日志文件或配置文件
+func isToolFile(path string) bool {
+	if logFilePath == "" && configFilePath == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && (abs == logFilePath || abs == configFilePath)
+}
+
+// logger 全局日志记录器，默认以文本格式输出到控制台
+var logger = slog.New(&consoleHandler{out: consoleWriter{}, level: slog.LevelInfo})
+
+// consoleWriter 将日志逐行写到控制台，不会打乱正在显示的进度条
+type consoleWriter struct{}
+
+func (consoleWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		statusf("%s", line)
+	}
+	return len(p), nil
+}
+
+// consoleHandler 输出适合人阅读的单行日志：时间 级别 消息 key=value...
+type consoleHandler struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	groups string
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(r.Time.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, " %-5s %s", r.Level.String(), r.Message)
+	writeAttr := func(a slog.Attr) bool {
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
+		value := a.Value.Resolve().String()
+		if strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&sb, " %s%s=%s", h.groups, a.Key, value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	sb.WriteString("\n")
+	if h.mu != nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+	}
+	_, err := io.WriteString(h.out, sb.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &h2
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.groups += name + "."
+	return &h2
+}
+
+// multiHandler 将日志同时写到多个 slog.Handler
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	m2 := make(multiHandler, len(m))
+	for i, h := range m {
+		m2[i] = h.WithAttrs(attrs)
+	}
+	return m2
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	m2 := make(multiHandler, len(m))
+	for i, h := range m {
+		m2[i] = h.WithGroup(name)
+	}
+	return m2
+}
+
+// setupLogging 根据日志级别、格式（text 或 json）和日志文件配置全局日志记录器，
+// 返回的函数用于关闭日志文件
+func setupLogging(levelStr, format, logFile string) (func(), error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+		return nil, errors.New(msg("error.logLevel", levelStr))
+	}
+	newHandler := func(w io.Writer) (slog.Handler, error) {
+		switch format {
+		case "text":
+			return &consoleHandler{mu: &sync.Mutex{}, out: w, level: level}, nil
+		case "json":
+			return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}), nil
+		}
+		return nil, errors.New(msg("error.logFormat", format))
+	}
+
+	console, err := newHandler(consoleWriter{})
+	if err != nil {
+		return nil, err
+	}
+	handlers := multiHandler{console}
+	closeFn := func() {}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+		fileHandler, _ := newHandler(f)
+		handlers = append(handlers, fileHandler)
+		logFilePath, _ = filepath.Abs(logFile)
+		closeFn = func() { f.Close() }
+	}
+	logger = slog.New(handlers)
+	return closeFn, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restoreLogging 测试结束后恢复全局日志设置
+func restoreLogging(t *testing.T) {
+	l, path, out := logger, logFilePath, statusOut
+	t.Cleanup(func() { logger, logFilePath, statusOut = l, path, out })
+}
+
+// TestLogFileJSON 日志文件中每行是一个 JSON 对象，打包事件带有 src、dst、size、files 和 duration 字段，
+// 日志文件所在的源目录打包时跳过日志文件
+func TestLogFileJSON(t *testing.T) {
+	restoreLogging(t)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "marszip.log")
+	var console bytes.Buffer
+	statusOut = &console
+	closeLog, err := setupLogging("debug", "json", logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := defaultPackOptions()
+	if _, err := organizeFilesAndCompress(dirFS(dir), opts); err != nil {
+		t.Fatal(err)
+	}
+	closeLog()
+
+	if _, err := os.Stat(logPath); err != nil {
+		t.Fatalf("log file was packed: %v", err)
+	}
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records := make(map[string]map[string]any)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%q: %v", scanner.Text(), err)
+		}
+		records[record["msg"].(string)] = record
+	}
+	create, ok := records["create zip"]
+	if !ok {
+		t.Fatalf("no create zip record in %v", records)
+	}
+	for _, key := range []string{"time", "level", "src", "dst", "size", "files", "duration"} {
+		if _, ok := create[key]; !ok {
+			t.Errorf("create zip record has no %s field: %v", key, create)
+		}
+	}
+	if create["dst"] != filepath.Join(dir, opts.Prefix+"1.zip") || create["files"] != 1.0 {
+		t.Errorf("create zip record = %v", create)
+	}
+	if !strings.Contains(console.String(), `"msg":"create zip"`) {
+		t.Errorf("console output is not JSON: %q", console.String())
+	}
+}
+
+// TestConsoleLogFormat 控制台日志为单行的 时间 级别 消息 key=value，含空格、引号或等号的值加引号，低于级别的日志不输出
+func TestConsoleLogFormat(t *testing.T) {
+	restoreLogging(t)
+	var console bytes.Buffer
+	statusOut = &console
+	if _, err := setupLogging("info", "text", ""); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("hidden")
+	logger.With("batch", 2).Info("move file", "src", "a b.txt", "size", 5)
+	line := strings.TrimSuffix(console.String(), "\n")
+	if strings.Contains(line, "hidden") || strings.Count(line, "\n") != 0 {
+		t.Fatalf("console output = %q", console.String())
+	}
+	if _, rest, _ := strings.Cut(line, " INFO  "); rest != `move file batch=2 src="a b.txt" size=5` {
+		t.Errorf("console line = %q", line)
+	}
+}
+
+// TestSetupLoggingErrors 无效的日志级别和格式报错
+func TestSetupLoggingErrors(t *testing.T) {
+	restoreLogging(t)
+	if _, err := setupLogging("loud", "text", ""); err == nil {
+		t.Error("invalid level accepted")
+	}
+	if _, err := setupLogging("info", "xml", ""); err == nil {
+		t.Error("invalid format accepted")
+	}
+}
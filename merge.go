@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// uniqueEntryName 为同名条目生成不冲突的名称，例如 a.txt 改为 a_2.txt
+func uniqueEntryName(name string, taken map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// mergeArchives 把多个压缩包中的文件条目按顺序合并到 output，不重新压缩。
+// 同名条目按 conflict 处理：rename 改名保留，skip 只保留第一个，error 报错
+func mergeArchives(archives []string, output, conflict string, opts packOptions) error {
+	switch conflict {
+	case "rename", "skip", "error":
+	default:
+		return errors.New(msg("error.mergeConflictPolicy", conflict))
+	}
+	if len(archives) < 2 {
+		return errors.New(msg("error.mergeArgs"))
+	}
+	outAbs, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		if abs, err := filepath.Abs(archive); err == nil && abs == outAbs {
+			return fmt.Errorf("%s: %s", output, msg("error.mergeOutput"))
+		}
+	}
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("%s: %w", output, os.ErrExist)
+	}
+	entries, err := readRepackEntries(archives)
+	if err != nil {
+		return err
+	}
+
+	taken := make(map[string]bool)
+	var merged []repackEntry
+	for _, entry := range entries {
+		if taken[entry.name] {
+			switch conflict {
+			case "skip":
+				logger.Info("skip duplicate entry", "src", entry.archive, "entry", entry.name)
+				continue
+			case "rename":
+				entry.target = uniqueEntryName(entry.name, taken)
+				logger.Info("rename duplicate entry", "src", entry.archive, "entry", entry.name, "dst", entry.target)
+			default:
+				return fmt.Errorf("%s: %s", entry.archive, msg("error.mergeConflict", entry.name))
+			}
+		}
+		taken[entry.targetName()] = true
+		merged = append(merged, entry)
+	}
+
+	tmpPaths, err := writeArchives([]string{output}, [][]repackEntry{merged}, "merge", -1)
+	if err != nil {
+		return err
+	}
+	if err := replaceArchives(filepath.Dir(output), archives, tmpPaths, []string{output}, opts); err != nil {
+		return err
+	}
+	logger.Info("merge finished", "dst", output, "archives", len(archives), "files", len(merged))
+	return nil
+}
+
+// splitArchive 按分批设置把一个压缩包拆分为 toPrefix 加编号命名的多个压缩包，不重新压缩。
+// toPrefix 为空时使用 "<原名称>_"。返回生成的压缩包数量
+func splitArchive(archive, toPrefix string, opts packOptions) (int, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+	dir := filepath.Dir(archive)
+	if toPrefix == "" {
+		toPrefix = strings.TrimSuffix(filepath.Base(archive), ".zip") + "_"
+	}
+	entries, err := readRepackEntries([]string{archive})
+	if err != nil {
+		return 0, err
+	}
+	batches := planRepack(entries, opts)
+	maxNum, exists, err, _ := findMaxPrefixNumber(dirFS(dir), ".", toPrefix)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		maxNum = 0
+	}
+	var zipFilePaths []string
+	for i := range batches {
+		zipFilePaths = append(zipFilePaths, filepath.Join(dir, fmt.Sprintf("%s%d.zip", toPrefix, maxNum+1+i)))
+	}
+
+	tmpPaths, err := writeArchives(zipFilePaths, batches, "split", -1)
+	if err != nil {
+		return 0, err
+	}
+	if err := replaceArchives(dir, []string{archive}, tmpPaths, zipFilePaths, opts); err != nil {
+		return 0, err
+	}
+	logger.Info("split finished", "src", archive, "archives", len(batches), "files", len(entries))
+	return len(batches), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// zipContents 返回压缩包中每个条目的 "名称=内容"，按条目顺序
+func zipContents(t *testing.T, path string) []string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var out []string
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		out = append(out, file.Name+"="+string(data))
+	}
+	return out
+}
+
+// TestMergeSplitRoundTrip 合并后再拆分得到的条目和内容与原压缩包相同，同名条目按 rename 改名
+func TestMergeSplitRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "x_1.zip"), filepath.Join(dir, "x_2.zip")
+	writeStoredZip(t, first, map[string]string{"a.txt": "alpha", "b.txt": "bravo"}, "a.txt", "b.txt")
+	writeStoredZip(t, second, map[string]string{"a.txt": "ALPHA", "c.txt": "charlie"}, "a.txt", "c.txt")
+	opts := defaultPackOptions()
+
+	merged := filepath.Join(dir, "all.zip")
+	if err := mergeArchives([]string{first, second}, merged, "rename", opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt=alpha", "b.txt=bravo", "a_2.txt=ALPHA", "c.txt=charlie"}
+	if got, want := zipContents(t, merged), append([]string{"all/="}, want...); !slices.Equal(got, want) {
+		t.Fatalf("merged %q, want %q", got, want)
+	}
+	for _, archive := range []string{first, second} {
+		if _, err := os.Stat(archive); err != nil {
+			t.Errorf("keep policy removed %s: %v", archive, err)
+		}
+	}
+
+	opts.MaxFiles = 3
+	n, err := splitArchive(merged, "", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("split into %d archives, want 2", n)
+	}
+	// 每个压缩包以自己的文件夹条目开头，文件夹条目不随合并和拆分转移
+	parts := append(zipContents(t, filepath.Join(dir, "all_1.zip")), zipContents(t, filepath.Join(dir, "all_2.zip"))...)
+	if want := append(append([]string{"all_1/="}, want[:3]...), append([]string{"all_2/="}, want[3:]...)...); !slices.Equal(parts, want) {
+		t.Errorf("split parts %q, want %q", parts, want)
+	}
+
+	// 目标前缀已有编号时从下一个编号开始
+	if n, err := splitArchive(merged, "all_", opts); err != nil || n != 2 {
+		t.Fatalf("second split: %d, %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "all_4.zip")); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestMergeConflicts skip 保留第一个同名条目，error 报错且不生成输出，输出文件不能已存在或是输入之一
+func TestMergeConflicts(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "x_1.zip"), filepath.Join(dir, "x_2.zip")
+	writeStoredZip(t, first, map[string]string{"a.txt": "alpha"}, "a.txt")
+	writeStoredZip(t, second, map[string]string{"a.txt": "ALPHA", "c.txt": "charlie"}, "a.txt", "c.txt")
+	opts := defaultPackOptions()
+
+	skipped := filepath.Join(dir, "skip.zip")
+	if err := mergeArchives([]string{first, second}, skipped, "skip", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := zipContents(t, skipped), []string{"skip/=", "a.txt=alpha", "c.txt=charlie"}; !slices.Equal(got, want) {
+		t.Errorf("skip: %q, want %q", got, want)
+	}
+
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	failed := filepath.Join(dir, "error.zip")
+	if err := mergeArchives([]string{first, second}, failed, "error", opts); err == nil || !strings.Contains(err.Error(), "a.txt") {
+		t.Errorf("error policy: %v", err)
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Errorf("output written after a conflict: %v", err)
+	}
+	for _, tt := range []struct {
+		name     string
+		archives []string
+		output   string
+		conflict string
+	}{
+		{"one archive", []string{first}, failed, "rename"},
+		{"output is an input", []string{first, second}, second, "rename"},
+		{"output exists", []string{first, second}, skipped, "rename"},
+		{"bad policy", []string{first, second}, failed, "keep"},
+	} {
+		if err := mergeArchives(tt.archives, tt.output, tt.conflict, opts); err == nil {
+			t.Errorf("%s: merge succeeded", tt.name)
+		}
+	}
+}
+
+func TestUniqueEntryName(t *testing.T) {
+	taken := map[string]bool{"d/a.txt": true, "d/a_2.txt": true, "b": true}
+	if got := uniqueEntryName("d/a.txt", taken); got != "d/a_3.txt" {
+		t.Errorf("got %q", got)
+	}
+	if got := uniqueEntryName("b", taken); got != "b_2" {
+		t.Errorf("got %q", got)
+	}
+}
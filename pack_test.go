@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// memFS 内存中的 writableFS，读取交给 fstest.MapFS，写入在 Close 时才生效
+type memFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+	temps int
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: fstest.MapFS{}}
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(name)
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadDir(name)
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Stat(name)
+}
+
+func (m *memFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Lstat(name)
+}
+
+func (m *memFS) ReadLink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadLink(name)
+}
+
+// memWriter 写入内存文件，Close 时保存内容
+type memWriter struct {
+	fsys *memFS
+	name string
+	perm fs.FileMode
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.fsys.mu.Lock()
+	defer w.fsys.mu.Unlock()
+	w.fsys.files[w.name] = &fstest.MapFile{Data: bytes.Clone(w.buf.Bytes()), Mode: w.perm, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) Create(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	if file, ok := m.files[name]; ok {
+		if file.Mode.IsDir() {
+			return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("is a directory")}
+		}
+		perm = file.Mode.Perm()
+	}
+	m.files[name] = &fstest.MapFile{Mode: perm, ModTime: time.Now()}
+	return &memWriter{fsys: m, name: name, perm: perm}, nil
+}
+
+func (m *memFS) CreateTemp(dir, pattern string, perm fs.FileMode) (io.WriteCloser, string, error) {
+	m.mu.Lock()
+	m.temps++
+	before, after, _ := strings.Cut(pattern, "*")
+	name := path.Join(dir, before+strconv.Itoa(m.temps)+after)
+	m.mu.Unlock()
+	w, err := m.Create(name, perm)
+	return w, name, err
+}
+
+func (m *memFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir := name; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if file, ok := m.files[dir]; ok && !file.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+		if _, ok := m.files[dir]; !ok {
+			m.files[dir] = &fstest.MapFile{Mode: fs.ModeDir | perm, ModTime: time.Now()}
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	moved := false
+	for name, file := range m.files {
+		if name == oldname || strings.HasPrefix(name, oldname+"/") {
+			delete(m.files, name)
+			m.files[newname+strings.TrimPrefix(name, oldname)] = file
+			moved = true
+		}
+	}
+	if !moved {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for other := range m.files {
+		if strings.HasPrefix(other, name+"/") {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for other := range m.files {
+		if other == name || strings.HasPrefix(other, name+"/") {
+			delete(m.files, other)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[newname]; ok {
+		return &fs.PathError{Op: "symlink", Path: newname, Err: fs.ErrExist}
+	}
+	m.files[newname] = &fstest.MapFile{Data: []byte(oldname), Mode: fs.ModeSymlink | 0o777, ModTime: time.Now()}
+	return nil
+}
+
+// names 返回根目录中的所有名称
+func (m *memFS) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.files {
+		if !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// archiveEntryNames 返回 fsys 中压缩包的条目名
+func archiveEntryNames(t *testing.T, fsys fs.FS, name string) []string {
+	t.Helper()
+	reader, closer, err := openZipFS(fsys, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// TestPackMemFS 在内存文件系统中完整地打包：去重、清单、校验和、增量状态和删除源文件，
+// 第二次运行跳过已打包的文件并把新文件补充到未满的压缩包
+func TestPackMemFS(t *testing.T) {
+	fsys := newMemFS()
+	modified := time.Date(2024, 9, 30, 12, 0, 0, 0, time.UTC)
+	for name, data := range map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "alpha", "d.txt": "delta"} {
+		fsys.files[name] = &fstest.MapFile{Data: []byte(data), Mode: 0o644, ModTime: modified}
+	}
+
+	opts := defaultPackOptions()
+	opts.Prefix = "P_"
+	opts.MaxFiles = 4
+	opts.Manifest = true
+	opts.Dedup = "alias"
+	opts.Incremental = true
+	opts.TopUp = true
+	opts.Checksums = "sums"
+	opts.DeletePolicy = "delete"
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsys.names(), []string{stateFileName, "P_1.zip", "P_1.zip" + manifestSuffix, "SHA256SUMS"}; !slices.Equal(got, want) {
+		t.Fatalf("after first pack: %q, want %q", got, want)
+	}
+	if got, want := archiveEntryNames(t, fsys, "P_1.zip"), []string{"P_1/", "a.txt", "b.txt", "d.txt"}; !slices.Equal(got, want) {
+		t.Errorf("P_1.zip entries = %q, want %q", got, want)
+	}
+	manifest, err := readManifest(fsys, "P_1.zip")
+	if err != nil || manifest == nil {
+		t.Fatalf("manifest: %v, %v", manifest, err)
+	}
+	aliased := false
+	for _, entry := range manifest.Entries {
+		aliased = aliased || entry.Name == "c.txt" && entry.AliasOf == "a.txt"
+	}
+	if !aliased {
+		t.Errorf("manifest does not record c.txt as an alias of a.txt: %+v", manifest.Entries)
+	}
+	checkSums := func() {
+		t.Helper()
+		entries, err := readChecksumFile(fsys, "SHA256SUMS", checksumAlgorithms["sha256"], "P_1.zip")
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("SHA256SUMS: %v, %v", entries, err)
+		}
+		sum, err := fileChecksum(fsys, "P_1.zip", checksumAlgorithms["sha256"].newHash)
+		if err != nil || sum != entries[0].sum {
+			t.Errorf("SHA256SUMS records %s, archive is %s (%v)", entries[0].sum, sum, err)
+		}
+	}
+	checkSums()
+
+	// 重新放入已打包的文件和一个新文件：已打包的跳过，新文件补充到 P_1.zip
+	fsys.files["a.txt"] = &fstest.MapFile{Data: []byte("alpha"), Mode: 0o644, ModTime: modified}
+	fsys.files["e.txt"] = &fstest.MapFile{Data: []byte("echo"), Mode: 0o600, ModTime: modified}
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsys.names(), []string{stateFileName, "P_1.zip", "P_1.zip" + manifestSuffix, "SHA256SUMS", "a.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("after second pack: %q, want %q", got, want)
+	}
+	if got, want := archiveEntryNames(t, fsys, "P_1.zip"), []string{"P_1/", "a.txt", "b.txt", "d.txt", "e.txt"}; !slices.Equal(got, want) {
+		t.Errorf("P_1.zip entries after top-up = %q, want %q", got, want)
+	}
+	checkSums()
+	if err := verifyZip(fsys, "P_1.zip", 4); err != nil {
+		t.Error(err)
+	}
+	state, err := loadState(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		if state.Files[name].Archive != "P_1.zip" {
+			t.Errorf("state for %s = %+v, want archive P_1.zip", name, state.Files[name])
+		}
+	}
+}
+
+// TestPackMemFSLocalOnly 不是本地目录时，移入回收站、上传和推送在移动文件之前报错
+func TestPackMemFSLocalOnly(t *testing.T) {
+	fsys := newMemFS()
+	fsys.files["a.txt"] = &fstest.MapFile{Data: []byte("alpha"), Mode: 0o644}
+	opts := defaultPackOptions()
+	opts.DeletePolicy = "trash"
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	if _, err := organizeFilesAndCompress(fsys, opts); err == nil || !strings.Contains(err.Error(), "local source directory") {
+		t.Fatalf("err = %v, want local-only error", err)
+	}
+	if got := fsys.names(); !slices.Equal(got, []string{"a.txt"}) {
+		t.Errorf("files were moved: %q", got)
+	}
+}
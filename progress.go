@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressEventType 进度事件类型
+type progressEventType int
+
+const (
+	progressBatchStarted  progressEventType = iota // 开始处理一个批次
+	progressFileAdded                              // 一个文件已写入压缩包
+	progressBytesWritten                           // 写入了一段文件内容
+	progressBatchVerified                          // 压缩包校验通过
+	progressBatchDeleted                           // 批次文件夹已删除
+)
+
+// progressEvent 压缩过程中发布的进度事件
+type progressEvent struct {
+	Type         progressEventType
+	Batch        int    // 当前批次序号，从1开始
+	TotalBatches int    // 本次运行的总批次数
+	Folder       string // 当前批次的文件夹名
+	File         string // 相关文件名（仅 progressFileAdded）
+	Bytes        int64  // 本次写入的字节数（仅 progressBytesWritten）
+	TotalBytes   int64  // 本次运行需要写入的总字节数
+}
+
+// progressHandler 进度事件回调，为 nil 时不发布进度
+var progressHandler func(progressEvent)
+
+// emitProgress 发布进度事件
+func emitProgress(ev progressEvent) {
+	if progressHandler != nil {
+		progressHandler(ev)
+	}
+}
+
+// progressWriter 统计写入的字节数并上报
+type progressWriter struct {
+	w      io.Writer
+	report func(n int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	if n > 0 {
+		pw.report(int64(n))
+	}
+	return n, err
+}
+
+// progressBar 在终端中显示进度条、吞吐量、剩余时间和批次
+type progressBar struct {
+	mu           sync.Mutex
+	out          io.Writer
+	start        time.Time
+	lastDraw     time.Time
+	doneBytes    int64
+	totalBytes   int64
+	batch        int
+	totalBatches int
+	visible      bool
+}
+
+// newProgressBar 创建进度条
+func newProgressBar(out io.Writer) *progressBar {
+	return &progressBar{out: out, start: time.Now()}
+}
+
+// handle 处理进度事件，可直接作为 progressHandler 使用
+func (b *progressBar) handle(ev progressEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.totalBytes = ev.TotalBytes
+	b.totalBatches = ev.TotalBatches
+	b.batch = ev.Batch
+	if ev.Type == progressBytesWritten {
+		b.doneBytes += ev.Bytes
+		// 限制刷新频率，避免大量小写入拖慢终端
+		if time.Since(b.lastDraw) < 100*time.Millisecond {
+			return
+		}
+	}
+	b.draw()
+}
+
+// draw 重绘进度条，调用者需持有锁
+func (b *progressBar) draw() {
+	const width = 30
+	ratio := 1.0
+	if b.totalBytes > 0 {
+		ratio = float64(b.doneBytes) / float64(b.totalBytes)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * width)
+	elapsed := time.Since(b.start).Seconds()
+	var speed float64
+	if elapsed > 0 {
+		speed = float64(b.doneBytes) / elapsed
+	}
+	eta := "--:--:--"
+	if speed > 0 {
+		eta = formatDuration(time.Duration(float64(b.totalBytes-b.doneBytes) / speed * float64(time.Second)))
+	}
+	fmt.Fprintf(b.out, "\r[%s%s] %5.1f%% %s/s %s ",
+		strings.Repeat("#", filled), strings.Repeat("-", width-filled),
+		ratio*100, formatBytes(int64(speed)), msg("progress.line", eta, b.batch, b.totalBatches))
+	b.lastDraw = time.Now()
+	b.visible = true
+}
+
+// clear 清除当前行上的进度条，调用者需持有锁
+func (b *progressBar) clear() {
+	if b.visible {
+		fmt.Fprintf(b.out, "\r%s\r", strings.Repeat(" ", 80))
+		b.visible = false
+	}
+}
+
+// println 在进度条上方输出一行文字，然后重绘进度条
+func (b *progressBar) println(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasVisible := b.visible
+	b.clear()
+	fmt.Fprintln(b.out, line)
+	if wasVisible {
+		b.draw()
+	}
+}
+
+// finish 绘制最终状态并换行
+func (b *progressBar) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.visible {
+		b.draw()
+		fmt.Fprintln(b.out)
+		b.visible = false
+	}
+}
+
+// activeProgressBar 当前显示中的进度条，为 nil 时直接输出
+var activeProgressBar *progressBar
+
+// statusOut 状态信息和进度条的输出位置，压缩包写到标准输出时改为标准错误
+var statusOut io.Writer = os.Stdout
+
+// statusf 输出一行状态信息，不会打乱正在显示的进度条
+func statusf(format string, args ...interface{}) {
+	line := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	if activeProgressBar != nil {
+		activeProgressBar.println(line)
+		return
+	}
+	fmt.Fprintln(statusOut, line)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestProgressEvents 打包时每批依次发布开始、写入、添加文件、校验和删除事件，写入的字节数合计等于总字节数
+func TestProgressEvents(t *testing.T) {
+	fsys := newMemFS()
+	for name, data := range map[string]string{"a.txt": "alpha", "b.txt": "bravo!", "c.txt": strings.Repeat("c", 100)} {
+		fsys.files[name] = &fstest.MapFile{Data: []byte(data), Mode: 0o644}
+	}
+	var events []progressEvent
+	defer func(h func(progressEvent)) { progressHandler = h }(progressHandler)
+	progressHandler = func(ev progressEvent) { events = append(events, ev) }
+
+	opts := defaultPackOptions()
+	opts.MaxFiles = 2
+	opts.DeletePolicy = "delete"
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var written int64
+	counts := make(map[progressEventType]int)
+	var added []string
+	for _, ev := range events {
+		counts[ev.Type]++
+		if ev.TotalBatches != 2 || ev.TotalBytes != 111 {
+			t.Errorf("event %+v: want 2 batches and 111 bytes in total", ev)
+		}
+		if want := opts.Prefix + string(rune('0'+ev.Batch)); ev.Folder != want {
+			t.Errorf("event %+v: folder %q, want %q", ev, ev.Folder, want)
+		}
+		switch ev.Type {
+		case progressBytesWritten:
+			written += ev.Bytes
+		case progressFileAdded:
+			added = append(added, ev.File)
+		}
+	}
+	if written != 111 {
+		t.Errorf("bytes written = %d, want 111", written)
+	}
+	if got := strings.Join(added, ","); got != "a.txt,b.txt,c.txt" {
+		t.Errorf("files added = %s", got)
+	}
+	for typ, want := range map[progressEventType]int{progressBatchStarted: 2, progressFileAdded: 3, progressBatchVerified: 2, progressBatchDeleted: 2} {
+		if counts[typ] != want {
+			t.Errorf("%d events of type %d, want %d", counts[typ], typ, want)
+		}
+	}
+	if first, last := events[0], events[len(events)-1]; first.Type != progressBatchStarted || first.Batch != 1 || last.Type != progressBatchDeleted || last.Batch != 2 {
+		t.Errorf("first event %+v, last event %+v", first, last)
+	}
+}
+
+// TestProgressBar 进度条显示完成比例和批次，在进度条上方输出的文字不会与进度条混在一行
+func TestProgressBar(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	var out bytes.Buffer
+	bar := newProgressBar(&out)
+	bar.handle(progressEvent{Type: progressBatchStarted, Batch: 1, TotalBatches: 2, TotalBytes: 200})
+	bar.handle(progressEvent{Type: progressBytesWritten, Batch: 1, TotalBatches: 2, TotalBytes: 200, Bytes: 100})
+	if !strings.Contains(out.String(), "  0.0%") {
+		t.Errorf("initial bar: %q", out.String())
+	}
+	bar.println("hello")
+	if !strings.Contains(out.String(), "\rhello\n") {
+		t.Errorf("line not printed on its own: %q", out.String())
+	}
+	bar.handle(progressEvent{Type: progressBatchVerified, Batch: 2, TotalBatches: 2, TotalBytes: 200})
+	bar.finish()
+	last := out.String()[strings.LastIndex(out.String(), "\r"):]
+	if !strings.Contains(last, " 50.0%") || !strings.Contains(last, "2/2") || !strings.HasSuffix(last, "\n") {
+		t.Errorf("final bar: %q", last)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSFTPQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"P_1.zip", `"P_1.zip"`},
+		{"my archive.zip", `"my archive.zip"`},
+		{`say "hi".zip`, `"say \"hi\".zip"`},
+		{"it's.zip", `"it's.zip"`},
+		{`C:\data\P_1.zip`, `"C:\\data\\P_1.zip"`},
+		{`\"`, `"\\\""`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := sftpQuote(tt.in); got != tt.want {
+			t.Errorf("sftpQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSFTPListedSize(t *testing.T) {
+	// OpenSSH sftp 批处理模式的输出，命令行以 sftp> 回显
+	output := strings.Join([]string{
+		`sftp> -mkdir "incoming"`,
+		`sftp> ls -ln "incoming/AP_1.zip"`,
+		`-rw-r--r--    1 1000     1000            5 Oct 18 23:28 incoming/AP_1.zip`,
+		`sftp> ls -ln "incoming/P_1.zip"`,
+		`-rw-r--r--    1 1000     1000          529 Oct 18 23:28 incoming/P_1.zip`,
+		`sftp> ls -ln "my archive.zip"`,
+		`-rw-r--r--    ? 0        0          123456 Oct 18  2025 my archive.zip`,
+		`sftp> ls -ln "say \"hi\".zip"`,
+		"-rw-r--r--    1 1000     1000           42 Oct 18 23:28 say \"hi\".zip\r",
+		`sftp> ls -ln "incoming/dir.zip"`,
+		`drwxr-xr-x    2 1000     1000         4096 Oct 18 23:28 incoming/dir.zip`,
+	}, "\n")
+	tests := []struct {
+		name string
+		size int64
+		ok   bool
+	}{
+		{"P_1.zip", 529, true},
+		{"AP_1.zip", 5, true},
+		{"my archive.zip", 123456, true},
+		{"archive.zip", 0, false},
+		{`say "hi".zip`, 42, true},
+		{"dir.zip", 0, false},
+		{"1.zip", 0, false},
+		{"missing.zip", 0, false},
+	}
+	for _, tt := range tests {
+		size, ok := sftpListedSize(output, tt.name)
+		if size != tt.size || ok != tt.ok {
+			t.Errorf("sftpListedSize(%q) = %d, %v, want %d, %v", tt.name, size, ok, tt.size, tt.ok)
+		}
+	}
+}
+
+// TestPushSSHD 把名称带空格和引号的压缩包推送到真实的 SSH 服务器，再下载回来比较内容。
+// 设置 MARSZIP_TEST_SFTP_TARGET（例如 sftp://user@127.0.0.1:2222/~/marszip-test）后运行，
+// 可用 MARSZIP_TEST_SFTP_IDENTITY 指定私钥。与正常推送一样只用密钥认证，主机密钥需要已在 known_hosts 中
+// 或在 ~/.ssh/config 中设置。本地可以这样启动一个只接受该密钥的 sshd：
+//
+//	ssh-keygen -t ed25519 -N "" -f /tmp/key && cp /tmp/key.pub ~/.ssh/authorized_keys
+//	/usr/sbin/sshd -D -p 2222 -o AuthorizedKeysFile=.ssh/authorized_keys
+func TestPushSSHD(t *testing.T) {
+	targetURL := os.Getenv("MARSZIP_TEST_SFTP_TARGET")
+	if targetURL == "" {
+		t.Skip("MARSZIP_TEST_SFTP_TARGET not set")
+	}
+	target, err := parsePushTarget(targetURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := defaultPackOptions()
+	opts.PushTarget, opts.PushIdentity, opts.PushRetries = targetURL, os.Getenv("MARSZIP_TEST_SFTP_IDENTITY"), 1
+
+	dir := t.TempDir()
+	for _, name := range []string{"P_1.zip", "my archive.zip", `say "hi" it's.zip`} {
+		zipFilePath := filepath.Join(dir, name)
+		content := strings.Repeat(name, 1000)
+		if err := os.WriteFile(zipFilePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(zipFilePath+".sha256", []byte("x  "+name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := pushArchive(zipFilePath, opts); err != nil {
+			t.Fatalf("push %q: %v", name, err)
+		}
+
+		back := filepath.Join(t.TempDir(), "back")
+		remote := path.Join(target.dir, name)
+		script := "get " + sftpQuote(remote) + " " + sftpQuote(back) + "\n" +
+			"get " + sftpQuote(remote+".sha256") + " " + sftpQuote(back+".sha256") + "\n" +
+			"rm " + sftpQuote(remote) + "\n" +
+			"rm " + sftpQuote(remote+".sha256") + "\n"
+		if _, err := runSFTP(target, opts.PushIdentity, script); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(back); err != nil || string(data) != content {
+			t.Errorf("%q: downloaded %d bytes, %v", name, len(data), err)
+		}
+		if _, err := os.Stat(back + ".sha256"); err != nil {
+			t.Errorf("%q: checksum sidecar not pushed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// repackEntry 重新打包、合并或拆分时的一个文件条目，记录其所在的原压缩包和位置
+type repackEntry struct {
+	archive string
+	index   int
+	name    string
+	target  string // 在新压缩包中的名称，为空时与 name 相同
+	size    uint64
+	crc32   uint32
+}
+
+// targetName 返回条目在新压缩包中的名称
+func (e repackEntry) targetName() string {
+	if e.target != "" {
+		return e.target
+	}
+	return e.name
+}
+
+// numberedArchives 返回目录中以 prefix 加编号命名的压缩包，按编号排序
+func numberedArchives(dir, prefix string) ([]string, error) {
+	_, _, err, entries := findMaxPrefixNumber(dirFS(dir), ".", prefix)
+	if err != nil {
+		return nil, err
+	}
+	nums := make(map[string]int)
+	var archives []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".zip") || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		num, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSuffix(name, ".zip"), prefix))
+		if err != nil {
+			continue
+		}
+		nums[name] = num
+		archives = append(archives, filepath.Join(dir, name))
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return nums[filepath.Base(archives[i])] < nums[filepath.Base(archives[j])]
+	})
+	return archives, nil
+}
+
+// readRepackEntries 读取压缩包中央目录中的文件条目，不解压数据
+func readRepackEntries(archives []string) ([]repackEntry, error) {
+	var entries []repackEntry
+	for _, archive := range archives {
+		reader, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", archive, err)
+		}
+		for i, file := range reader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			entries = append(entries, repackEntry{archive: archive, index: i, name: file.Name, size: file.UncompressedSize64, crc32: file.CRC32})
+		}
+		reader.Close()
+	}
+	return entries, nil
+}
+
+// planRepack 按新的分批设置把条目分批，同名的条目放入不同的批次
+func planRepack(entries []repackEntry, opts packOptions) [][]repackEntry {
+	var batches [][]repackEntry
+	var current []repackEntry
+	var currentSize int64
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		full := len(current) >= opts.MaxFiles
+		if opts.BatchBy == "size" {
+			full = currentSize+int64(entry.size) > opts.MaxBatchBytes
+		}
+		if len(current) > 0 && (full || names[entry.targetName()]) {
+			batches = append(batches, current)
+			current, currentSize, names = nil, 0, make(map[string]bool)
+		}
+		current = append(current, entry)
+		currentSize += int64(entry.size)
+		names[entry.targetName()] = true
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// writeRepacked 把一批条目从原压缩包直接写入新的压缩包，不经过磁盘上的临时文件。
+// level 小于 0 时原样复制压缩后的数据，否则解压后以该 Deflate 级别重新压缩
+func writeRepacked(zipFilePath, folderName string, batch []repackEntry, level int, report func(progressEvent)) error {
+	zipFile, err := os.Create(zipFilePath)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+	zipWriter := zip.NewWriter(zipFile)
+	if level >= 0 {
+		zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+
+	// 与 compressFolder 一样先写入以批次命名的目录条目
+	dirHeader := &zip.FileHeader{Name: folderName + "/", Modified: time.Now()}
+	dirHeader.SetMode(os.ModeDir | 0755)
+	if _, err := zipWriter.CreateHeader(dirHeader); err != nil {
+		return err
+	}
+
+	readers := make(map[string]*zip.ReadCloser)
+	defer func() {
+		for _, reader := range readers {
+			reader.Close()
+		}
+	}()
+	for _, entry := range batch {
+		reader, ok := readers[entry.archive]
+		if !ok {
+			reader, err = zip.OpenReader(entry.archive)
+			if err != nil {
+				return err
+			}
+			readers[entry.archive] = reader
+		}
+		file := reader.File[entry.index]
+		if err := copyZipEntry(zipWriter, file, entry.targetName(), level >= 0, report); err != nil {
+			return fmt.Errorf("%s: %s: %w", filepath.Base(entry.archive), entry.name, err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return zipFile.Close()
+}
+
+// copyZipEntry 把一个条目以 name 为名写入压缩包，recompress 为 false 时原样复制压缩后的数据
+func copyZipEntry(zipWriter *zip.Writer, file *zip.File, name string, recompress bool, report func(progressEvent)) error {
+	if !recompress && name == file.Name {
+		if err := zipWriter.Copy(file); err != nil {
+			return err
+		}
+		if report != nil {
+			report(progressEvent{Type: progressBytesWritten, Bytes: int64(file.UncompressedSize64)})
+		}
+	} else if !recompress {
+		// 改名时复制原有的文件头，只替换名称，压缩数据仍原样复制
+		header := file.FileHeader
+		header.Name = name
+		writer, err := zipWriter.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		raw, err := file.OpenRaw()
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(writer, raw); err != nil {
+			return err
+		}
+		if report != nil {
+			report(progressEvent{Type: progressBytesWritten, Bytes: int64(file.UncompressedSize64)})
+		}
+	} else {
+		header := &zip.FileHeader{Name: name, Comment: file.Comment, Method: zip.Deflate, Modified: file.Modified}
+		header.SetMode(file.Mode())
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if report != nil {
+			writer = &progressWriter{w: writer, report: func(n int64) {
+				report(progressEvent{Type: progressBytesWritten, Bytes: n})
+			}}
+		}
+		if _, err := io.Copy(writer, rc); err != nil {
+			return err
+		}
+	}
+	if report != nil {
+		report(progressEvent{Type: progressFileAdded, File: name})
+	}
+	return nil
+}
+
+// checkRepacked 完整读取新的压缩包，并确认每个条目的大小和 CRC32 与原压缩包中的一致
+func checkRepacked(zipFilePath string, batch []repackEntry) error {
+	dir, name := localFile(zipFilePath)
+	if err := verifyZip(dir, name, len(batch)); err != nil {
+		return err
+	}
+	reader, err := zip.OpenReader(zipFilePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	written := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		written[file.Name] = file
+	}
+	for _, entry := range batch {
+		file, ok := written[entry.targetName()]
+		if !ok {
+			return fmt.Errorf("%s: %s", entry.targetName(), msg("error.repackMissing"))
+		}
+		if file.UncompressedSize64 != entry.size || file.CRC32 != entry.crc32 {
+			return fmt.Errorf("%s: %s", entry.targetName(), msg("error.repackChanged"))
+		}
+	}
+	return nil
+}
+
+// removeArchive 按删除方式处理原压缩包及其清单和校验和文件，并从汇总文件中去掉它的记录。
+// storedPath 为压缩包当前所在的路径，替换同名压缩包时原压缩包已被移到一旁，其余情况与 zipFilePath 相同
+func removeArchive(sourceDir, zipFilePath, storedPath string, opts packOptions) error {
+	paths := []string{storedPath, zipFilePath + manifestSuffix}
+	for _, algo := range checksumAlgorithms {
+		paths = append(paths, zipFilePath+algo.ext)
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if opts.DeletePolicy == "trash" {
+			trashDir := resolveTrashDir(sourceDir, opts)
+			dst, err := moveToTrash(trashDir, path)
+			if err != nil {
+				return err
+			}
+			logger.Info("trash file", "src", path, "dst", dst)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		logger.Info("delete file", "src", path)
+	}
+	dir, name := localFile(zipFilePath)
+	for _, algo := range checksumAlgorithms {
+		if listed, _ := readChecksumFile(dir, algo.sumsFile, algo, name); len(listed) > 0 {
+			if err := updateSumsFile(dir, algo.sumsFile, name, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeArchives 把每批条目写入对应压缩包同目录下的临时文件 <名称>.<tag>.zip 并逐个校验，
+// 出错时删除已写入的临时文件。返回临时文件的路径
+func writeArchives(zipFilePaths []string, batches [][]repackEntry, tag string, level int) ([]string, error) {
+	var totalBytes int64
+	for _, batch := range batches {
+		for _, entry := range batch {
+			totalBytes += int64(entry.size)
+		}
+	}
+	var tmpPaths []string
+	cleanup := func() {
+		for _, path := range tmpPaths {
+			os.Remove(path)
+		}
+	}
+	for i, batch := range batches {
+		folderName := strings.TrimSuffix(filepath.Base(zipFilePaths[i]), ".zip")
+		tmpPath := strings.TrimSuffix(zipFilePaths[i], ".zip") + "." + tag + ".zip"
+		tmpPaths = append(tmpPaths, tmpPath)
+		report := func(ev progressEvent) {
+			ev.Batch = i + 1
+			ev.TotalBatches = len(batches)
+			ev.Folder = folderName
+			ev.TotalBytes = totalBytes
+			emitProgress(ev)
+		}
+		report(progressEvent{Type: progressBatchStarted})
+		begin := time.Now()
+		if err := writeRepacked(tmpPath, folderName, batch, level, report); err != nil {
+			cleanup()
+			return nil, err
+		}
+		if err := checkRepacked(tmpPath, batch); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("%s: %w", tmpPath, err)
+		}
+		report(progressEvent{Type: progressBatchVerified})
+		logger.Info(tag+" zip", "dst", tmpPath, "files", len(batch), "duration", time.Since(begin))
+	}
+	return tmpPaths, nil
+}
+
+// removeArchives 按删除方式处理原压缩包，keep 时不做任何处理。movedTo 记录已被移到一旁的原压缩包的当前路径
+func removeArchives(sourceDir string, archives []string, movedTo map[string]string, opts packOptions) error {
+	if opts.DeletePolicy == "keep" {
+		return nil
+	}
+	for _, archive := range archives {
+		storedPath := archive
+		if moved, ok := movedTo[archive]; ok {
+			storedPath = moved
+		}
+		if err := removeArchive(sourceDir, archive, storedPath, opts); err != nil {
+			return fmt.Errorf("%s: %w", archive, err)
+		}
+	}
+	if opts.DeletePolicy == "trash" {
+		trashDir := resolveTrashDir(sourceDir, opts)
+		if err := purgeTrash(trashDir, opts.TrashDays, opts.TrashMaxBytes); err != nil {
+			logger.Error("purge trash failed", "trash", trashDir, "err", err)
+		}
+	}
+	return nil
+}
+
+// replaceArchives 用校验通过的临时文件替换原压缩包 archives。
+// 与新压缩包同名的原压缩包先改名为 <名称>.orig.zip 移到一旁，全部临时文件改为正式名称后才按删除方式处理原压缩包，
+// 最后按设置生成新压缩包的清单和校验和文件。改名失败时撤回已就位的新压缩包并把原压缩包放回原处，不丢失任何内容
+func replaceArchives(sourceDir string, archives, tmpPaths, zipFilePaths []string, opts packOptions) error {
+	targets := make(map[string]bool)
+	for _, zipFilePath := range zipFilePaths {
+		abs, _ := filepath.Abs(zipFilePath)
+		targets[abs] = true
+	}
+	movedTo := make(map[string]string)
+	installed := 0
+	rollback := func() {
+		for i := installed - 1; i >= 0; i-- {
+			if err := os.Rename(zipFilePaths[i], tmpPaths[i]); err != nil {
+				logger.Error("roll back archive failed", "src", zipFilePaths[i], "dst", tmpPaths[i], "err", err)
+			}
+		}
+		for archive, moved := range movedTo {
+			if err := os.Rename(moved, archive); err != nil {
+				logger.Error("restore archive failed", "src", moved, "dst", archive, "err", err)
+			}
+		}
+	}
+
+	if opts.DeletePolicy != "keep" {
+		for _, archive := range archives {
+			if abs, _ := filepath.Abs(archive); !targets[abs] {
+				continue
+			}
+			moved := strings.TrimSuffix(archive, ".zip") + ".orig.zip"
+			if _, err := os.Stat(moved); err == nil {
+				rollback()
+				return fmt.Errorf("%s: %w", moved, os.ErrExist)
+			}
+			if err := os.Rename(archive, moved); err != nil {
+				rollback()
+				return err
+			}
+			movedTo[archive] = moved
+		}
+	}
+	for i, tmpPath := range tmpPaths {
+		if _, err := os.Stat(zipFilePaths[i]); err == nil {
+			rollback()
+			return fmt.Errorf("%s: %w", zipFilePaths[i], os.ErrExist)
+		}
+		if err := os.Rename(tmpPath, zipFilePaths[i]); err != nil {
+			rollback()
+			return err
+		}
+		installed++
+	}
+
+	// 新压缩包已全部就位，处理原压缩包时出错只会留下原压缩包，不会丢失内容
+	if err := removeArchives(sourceDir, archives, movedTo, opts); err != nil {
+		return err
+	}
+	for _, zipFilePath := range zipFilePaths {
+		dir, name := localFile(zipFilePath)
+		if opts.Manifest {
+			if err := writeManifest(dir, name, nil); err != nil {
+				return err
+			}
+		}
+		if opts.Checksums != "none" {
+			if _, err := writeChecksum(dir, name, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// repackArchives 把 opts.Prefix 开头的编号压缩包按新的分批设置重新打包为 toPrefix 开头的压缩包。
+// 新压缩包先写入临时文件并全部校验通过，再替换原压缩包，见 replaceArchives。
+// 返回新压缩包的数量
+func repackArchives(sourceDir, toPrefix string, level int, opts packOptions) (int, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+	if level < -1 || level > 9 {
+		return 0, errors.New(msg("error.level", level))
+	}
+	if toPrefix == "" {
+		toPrefix = opts.Prefix
+	}
+	if opts.DeletePolicy == "keep" && toPrefix == opts.Prefix {
+		return 0, errors.New(msg("error.repackKeep"))
+	}
+	archives, err := numberedArchives(sourceDir, opts.Prefix)
+	if err != nil {
+		return 0, err
+	}
+	if len(archives) == 0 {
+		logger.Info("no archives to repack", "dir", sourceDir, "prefix", opts.Prefix)
+		return 0, nil
+	}
+	entries, err := readRepackEntries(archives)
+	if err != nil {
+		return 0, err
+	}
+	batches := planRepack(entries, opts)
+
+	// 使用其他前缀时接着该前缀已有的编号
+	start := 0
+	if toPrefix != opts.Prefix {
+		maxNum, exists, err, _ := findMaxPrefixNumber(dirFS(sourceDir), ".", toPrefix)
+		if err != nil {
+			return 0, err
+		}
+		if exists {
+			start = maxNum
+		}
+	}
+
+	var zipFilePaths []string
+	for i := range batches {
+		zipFilePaths = append(zipFilePaths, filepath.Join(sourceDir, fmt.Sprintf("%s%d.zip", toPrefix, start+1+i)))
+	}
+	tmpPaths, err := writeArchives(zipFilePaths, batches, "repack", level)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := replaceArchives(sourceDir, archives, tmpPaths, zipFilePaths, opts); err != nil {
+		return 0, err
+	}
+	logger.Info("repack finished", "dir", sourceDir, "archives", len(archives), "repacked", len(batches), "files", len(entries))
+	return len(batches), nil
+}
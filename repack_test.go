@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReplaceArchives 同名替换时先把原压缩包移到一旁，改名失败后原压缩包和临时文件都恢复原样
+func TestReplaceArchives(t *testing.T) {
+	setup := func(t *testing.T) (string, []string, []string, []string) {
+		dir := t.TempDir()
+		var archives, tmpPaths, zipFilePaths []string
+		for i := 1; i <= 3; i++ {
+			zipFilePath := filepath.Join(dir, fmt.Sprintf("p_%d.zip", i))
+			tmpPath := filepath.Join(dir, fmt.Sprintf("p_%d.repack.zip", i))
+			zipFilePaths = append(zipFilePaths, zipFilePath)
+			tmpPaths = append(tmpPaths, tmpPath)
+			if err := os.WriteFile(tmpPath, []byte(fmt.Sprint("new", i)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if i <= 2 {
+				archives = append(archives, zipFilePath)
+				if err := os.WriteFile(zipFilePath, []byte(fmt.Sprint("old", i)), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return dir, archives, tmpPaths, zipFilePaths
+	}
+	contents := func(t *testing.T, dir string) string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, entry := range entries {
+			data, _ := os.ReadFile(filepath.Join(dir, entry.Name()))
+			out = append(out, entry.Name()+"="+string(data))
+		}
+		return strings.Join(out, " ")
+	}
+	opts := defaultPackOptions()
+	opts.DeletePolicy, opts.Checksums = "delete", "none"
+
+	t.Run("replace", func(t *testing.T) {
+		dir, archives, tmpPaths, zipFilePaths := setup(t)
+		if err := replaceArchives(dir, archives, tmpPaths, zipFilePaths, opts); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := contents(t, dir), "p_1.zip=new1 p_2.zip=new2 p_3.zip=new3"; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+	t.Run("rollback", func(t *testing.T) {
+		dir, archives, tmpPaths, zipFilePaths := setup(t)
+		// 第三个新压缩包的名称被占用，前两个已改名的新压缩包需要撤回
+		if err := os.WriteFile(zipFilePaths[2], []byte("other"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := replaceArchives(dir, archives, tmpPaths, zipFilePaths, opts); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("err = %v, want ErrExist", err)
+		}
+		want := "p_1.repack.zip=new1 p_1.zip=old1 p_2.repack.zip=new2 p_2.zip=old2 p_3.repack.zip=new3 p_3.zip=other"
+		if got := contents(t, dir); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+}
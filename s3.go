@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uploadStateSuffix 分段上传的续传记录相对于压缩包路径的后缀，上传确认后删除
+const uploadStateSuffix = ".upload.json"
+
+// minPartSize S3 要求除最后一段外每段至少 5 MiB
+const minPartSize = 5 << 20
+
+// s3Client 基于标准库实现的最小 S3 兼容客户端，使用 AWS Signature Version 4 签名
+type s3Client struct {
+	endpoint     *url.URL
+	region       string
+	bucket       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	virtualHost  bool
+	http         *http.Client
+}
+
+// s3ResponseError 服务端返回的错误
+type s3ResponseError struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("HTTP %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// newS3Client 根据上传设置创建客户端，访问密钥未配置时从 AWS_ACCESS_KEY_ID 等环境变量读取
+func newS3Client(opts packOptions) (*s3Client, error) {
+	endpoint, err := url.Parse(opts.UploadEndpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.New(msg("error.uploadEndpoint", opts.UploadEndpoint))
+	}
+	c := &s3Client{
+		endpoint:     endpoint,
+		region:       opts.UploadRegion,
+		bucket:       opts.UploadBucket,
+		accessKey:    opts.UploadAccessKey,
+		secretKey:    opts.UploadSecretKey,
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		virtualHost:  opts.UploadVirtualHost,
+		http:         &http.Client{Timeout: 10 * time.Minute},
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.accessKey == "" {
+		c.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if c.secretKey == "" {
+		c.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, errors.New(msg("error.uploadCredentials"))
+	}
+	return c, nil
+}
+
+// s3Escape 按 SigV4 的规则进行 URI 编码，只保留字母、数字和 -_.~，encodeSlash 为 false 时保留 /
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery 返回按键排序并编码的查询字符串
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign 为请求添加 SigV4 签名，签名覆盖 host、x-amz-*、content-md5、content-type 和 range 请求头
+func (c *s3Client) sign(req *http.Request, canonicalURI, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.Host}
+	if req.Host == "" {
+		headers["host"] = req.URL.Host
+	}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-md5" || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, canonicalURI, canonicalQuery(req.URL.Query()), canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+c.secretKey), date), c.region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.accessKey, scope, signedHeaders, signature))
+}
+
+// do 发送一个签名的请求，网络错误和 5xx 响应最多重试 3 次
+func (c *s3Client) do(method, key string, query url.Values, body []byte, header http.Header) (*http.Response, []byte, error) {
+	host := c.endpoint.Host
+	canonicalURI := "/" + s3Escape(key, false)
+	if c.virtualHost {
+		host = c.bucket + "." + host
+	} else {
+		canonicalURI = "/" + c.bucket + canonicalURI
+	}
+	rawURL := c.endpoint.Scheme + "://" + host + canonicalURI
+	if len(query) > 0 {
+		rawURL += "?" + canonicalQuery(query)
+	}
+	payloadHash := sha256.Sum256(body)
+
+	var lastErr error
+	for attempt := 1; attempt <= 3; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 2 * time.Second)
+		}
+		req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		c.sign(req, canonicalURI, hex.EncodeToString(payloadHash[:]), time.Now())
+		resp, err := c.http.Do(req)
+		if err != nil {
+			lastErr = err
+			logger.Warn("s3 request failed", "method", method, "key", key, "attempt", attempt, "err", err)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode < 300 {
+			return resp, data, nil
+		}
+		respErr := &s3ResponseError{Status: resp.StatusCode}
+		xml.Unmarshal(data, respErr)
+		if resp.StatusCode < 500 {
+			return resp, data, respErr
+		}
+		lastErr = respErr
+		logger.Warn("s3 request failed", "method", method, "key", key, "attempt", attempt, "err", respErr)
+	}
+	return nil, nil, fmt.Errorf("%s %s: %w", method, key, lastErr)
+}
+
+// putObject 以单个请求上传对象，由服务端按 Content-MD5 校验内容，返回 ETag
+func (c *s3Client) putObject(key string, body []byte) (string, error) {
+	sum := md5.Sum(body)
+	header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}}
+	resp, _, err := c.do(http.MethodPut, key, nil, body, header)
+	if err != nil {
+		return "", err
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if err := checkETag(resp.Header, etag, hex.EncodeToString(sum[:])); err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return etag, nil
+}
+
+// checkETag 比较服务端返回的 ETag 与按内容的 MD5 计算出的 want。
+// 使用 SSE-KMS 或 SSE-C 加密的对象的 ETag 不是内容的 MD5，这时内容已由服务端按 Content-MD5 校验，不再比较
+func checkETag(header http.Header, etag, want string) error {
+	if strings.HasPrefix(header.Get("X-Amz-Server-Side-Encryption"), "aws:kms") || header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		logger.Debug("upload etag not md5", "etag", etag, "encryption", header.Get("X-Amz-Server-Side-Encryption")+header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+		return nil
+	}
+	if etag != want {
+		return errors.New(msg("error.uploadETag", etag, want))
+	}
+	return nil
+}
+
+// headObject 返回对象的大小和 ETag
+func (c *s3Client) headObject(key string) (int64, string, error) {
+	resp, _, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.ContentLength, strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+// s3Part 分段上传中已上传的一段
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size,omitempty"`
+}
+
+// createMultipartUpload 开始分段上传，返回 UploadId
+func (c *s3Client) createMultipartUpload(key string) (string, error) {
+	_, data, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("%s: %s", key, msg("error.uploadResponse"))
+	}
+	return result.UploadID, nil
+}
+
+// listParts 列出服务端已收到的分段
+func (c *s3Client) listParts(key, uploadID string) (map[int]s3Part, error) {
+	parts := make(map[int]s3Part)
+	marker := 0
+	for {
+		query := url.Values{"uploadId": {uploadID}}
+		if marker > 0 {
+			query.Set("part-number-marker", strconv.Itoa(marker))
+		}
+		_, data, err := c.do(http.MethodGet, key, query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			IsTruncated          bool     `xml:"IsTruncated"`
+			NextPartNumberMarker int      `xml:"NextPartNumberMarker"`
+			Parts                []s3Part `xml:"Part"`
+		}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		for _, part := range result.Parts {
+			part.ETag = strings.Trim(part.ETag, `"`)
+			parts[part.PartNumber] = part
+		}
+		if !result.IsTruncated || result.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// uploadPart 上传一段并校验返回的 ETag 与该段的 MD5 一致
+func (c *s3Client) uploadPart(key, uploadID string, number int, body []byte) (string, error) {
+	sum := md5.Sum(body)
+	header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}}
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	resp, _, err := c.do(http.MethodPut, key, query, body, header)
+	if err != nil {
+		return "", err
+	}
+	etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	if err := checkETag(resp.Header, etag, hex.EncodeToString(sum[:])); err != nil {
+		return "", fmt.Errorf("%s #%d: %w", key, number, err)
+	}
+	return etag, nil
+}
+
+// completeMultipartUpload 合并所有分段，校验对象的 ETag 后返回。
+// 分段上传的 ETag 是各段 MD5 拼接（md5s）后的 MD5 加上段数
+func (c *s3Client) completeMultipartUpload(key, uploadID string, parts []s3Part, md5s []byte) (string, error) {
+	request := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts}
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	resp, data, err := c.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		return "", err
+	}
+	// 合并失败时服务端也可能返回 200，错误在响应内容中
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return "", err
+	}
+	if result.XMLName.Local == "Error" {
+		return "", &s3ResponseError{Status: http.StatusOK, Code: result.Code, Message: result.Message}
+	}
+	etag := strings.Trim(result.ETag, `"`)
+	sum := md5.Sum(md5s)
+	if err := checkETag(resp.Header, etag, fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(parts))); err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return etag, nil
+}
+
+// abortMultipartUpload 放弃分段上传，释放服务端已保存的分段
+func (c *s3Client) abortMultipartUpload(key, uploadID string) error {
+	_, _, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	return err
+}
+
+// uploadState 分段上传的续传记录，压缩包的大小和修改时间变化后作废
+type uploadState struct {
+	Key      string    `json:"key"`
+	UploadID string    `json:"uploadId"`
+	PartSize int64     `json:"partSize"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+}
+
+// uploadKey 根据模板生成对象键，支持 {name}、{prefix}、{date}、{year}、{month}、{day} 和 {host}
+func uploadKey(template, zipFilePath string, opts packOptions) string {
+	if template == "" {
+		template = "{name}"
+	}
+	now := time.Now()
+	host, _ := os.Hostname()
+	return strings.NewReplacer(
+		"{name}", filepath.Base(zipFilePath),
+		"{prefix}", opts.Prefix,
+		"{date}", now.Format("2006-01-02"),
+		"{year}", now.Format("2006"),
+		"{month}", now.Format("01"),
+		"{day}", now.Format("02"),
+		"{host}", host,
+	).Replace(template)
+}
+
+// uploadArchive 把压缩包及其清单和附属校验和文件上传到对象存储，确认对象大小和 ETag 后返回对象键。
+// 大于分段大小的压缩包使用分段上传，中断后再次上传时根据续传记录跳过服务端已有且 MD5 一致的分段
+func uploadArchive(client *s3Client, zipFilePath string, opts packOptions) (string, error) {
+	info, err := os.Stat(zipFilePath)
+	if err != nil {
+		return "", err
+	}
+	key := uploadKey(opts.UploadKey, zipFilePath, opts)
+	start := time.Now()
+	var etag string
+	if info.Size() <= opts.UploadPartBytes {
+		data, err := os.ReadFile(zipFilePath)
+		if err != nil {
+			return "", err
+		}
+		if etag, err = client.putObject(key, data); err != nil {
+			return "", err
+		}
+	} else if etag, err = uploadMultipart(client, zipFilePath, key, info, opts.UploadPartBytes); err != nil {
+		return "", err
+	}
+
+	// 确认服务端的对象与本地一致
+	size, remoteETag, err := client.headObject(key)
+	if err != nil {
+		return "", err
+	}
+	if size != info.Size() {
+		return "", fmt.Errorf("%s: %s", key, msg("error.uploadSize", size, info.Size()))
+	}
+	if remoteETag != etag {
+		return "", fmt.Errorf("%s: %s", key, msg("error.uploadETag", remoteETag, etag))
+	}
+	logger.Info("upload archive", "src", zipFilePath, "bucket", opts.UploadBucket, "key", key, "size", info.Size(), "etag", etag, "duration", time.Since(start))
+
+	// 附属文件与压缩包使用相同的对象键前缀
+	sidecars := []string{manifestSuffix}
+	for _, algo := range checksumAlgorithms {
+		sidecars = append(sidecars, algo.ext)
+	}
+	for _, suffix := range sidecars {
+		data, err := os.ReadFile(zipFilePath + suffix)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := client.putObject(key+suffix, data); err != nil {
+			return "", err
+		}
+		logger.Info("upload file", "src", zipFilePath+suffix, "key", key+suffix)
+	}
+	return key, nil
+}
+
+// uploadMultipart 分段上传压缩包，返回合并后对象的 ETag
+func uploadMultipart(client *s3Client, zipFilePath, key string, info os.FileInfo, partSize int64) (string, error) {
+	statePath := zipFilePath + uploadStateSuffix
+	state := uploadState{Key: key, PartSize: partSize, Size: info.Size(), ModTime: info.ModTime()}
+	remote := make(map[int]s3Part)
+
+	// 续传记录与当前压缩包一致时继续之前的上传，否则放弃旧的上传
+	var saved uploadState
+	if data, err := os.ReadFile(statePath); err == nil && json.Unmarshal(data, &saved) == nil {
+		if saved.Key == key && saved.PartSize == partSize && saved.Size == info.Size() && saved.ModTime.Equal(info.ModTime()) {
+			parts, err := client.listParts(key, saved.UploadID)
+			var respErr *s3ResponseError
+			if err != nil && !(errors.As(err, &respErr) && respErr.Code == "NoSuchUpload") {
+				return "", err
+			}
+			if err == nil {
+				state.UploadID, remote = saved.UploadID, parts
+				logger.Info("upload resume", "src", zipFilePath, "key", key, "upload_id", saved.UploadID, "parts", len(parts))
+			}
+		} else if err := client.abortMultipartUpload(saved.Key, saved.UploadID); err != nil {
+			logger.Warn("upload abort failed", "key", saved.Key, "upload_id", saved.UploadID, "err", err)
+		}
+	}
+	if state.UploadID == "" {
+		uploadID, err := client.createMultipartUpload(key)
+		if err != nil {
+			return "", err
+		}
+		state.UploadID = uploadID
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(statePath, data, 0644); err != nil {
+			return "", err
+		}
+	}
+
+	file, err := os.Open(zipFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	var parts []s3Part
+	var md5s []byte
+	buf := make([]byte, partSize)
+	for number, offset := 1, int64(0); offset < info.Size(); number, offset = number+1, offset+partSize {
+		n, err := file.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		body := buf[:n]
+		sum := md5.Sum(body)
+		md5s = append(md5s, sum[:]...)
+		etag := hex.EncodeToString(sum[:])
+		if part, ok := remote[number]; ok && part.ETag == etag && part.Size == int64(n) {
+			logger.Debug("upload part skipped", "key", key, "part", number)
+		} else {
+			if etag, err = client.uploadPart(key, state.UploadID, number, body); err != nil {
+				return "", err
+			}
+			logger.Debug("upload part", "key", key, "part", number, "size", n)
+		}
+		parts = append(parts, s3Part{PartNumber: number, ETag: `"` + etag + `"`})
+	}
+
+	etag, err := client.completeMultipartUpload(key, state.UploadID, parts, md5s)
+	if err != nil {
+		return "", err
+	}
+	os.Remove(statePath)
+	return etag, nil
+}
+
+// deleteUploaded 上传确认后删除本地的压缩包、附属文件和续传记录
+func deleteUploaded(sourceDir, zipFilePath string, opts packOptions) error {
+	opts.DeletePolicy = "delete"
+	if err := removeArchive(sourceDir, zipFilePath, zipFilePath, opts); err != nil {
+		return err
+	}
+	if err := os.Remove(zipFilePath + uploadStateSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pushTarget 解析后的 SFTP 目标，例如 sftp://user@host:2222/incoming
+type pushTarget struct {
+	user string
+	host string
+	port string
+	dir  string // 远程目录，为空时使用登录后的默认目录
+}
+
+// parsePushTarget 解析 sftp://[user@]host[:port][/dir] 形式的目标，/~/dir 表示相对于远程用户主目录
+func parsePushTarget(s string) (pushTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "sftp" || u.Hostname() == "" {
+		return pushTarget{}, errors.New(msg("error.pushTarget", s))
+	}
+	target := pushTarget{host: u.Hostname(), port: u.Port(), dir: u.Path}
+	if u.User != nil {
+		target.user = u.User.Username()
+	}
+	if target.dir == "/~" || strings.HasPrefix(target.dir, "/~/") {
+		target.dir = strings.TrimPrefix(strings.TrimPrefix(target.dir, "/~"), "/")
+	}
+	return target, nil
+}
+
+// sftpQuote 为 sftp 批处理命令的参数加上引号
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// runSFTP 以批处理模式运行外部的 sftp 程序执行 script，只使用密钥认证，不会提示输入密码。
+// 标准库没有 SSH 实现，认证和主机密钥检查沿用本机 OpenSSH 的配置
+func runSFTP(target pushTarget, identity, script string) (string, error) {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if identity != "" {
+		args = append(args, "-i", identity)
+	}
+	if target.port != "" {
+		args = append(args, "-P", target.port)
+	}
+	dest := target.host
+	if target.user != "" {
+		dest = target.user + "@" + dest
+	}
+	cmd := exec.Command("sftp", append(args, dest)...)
+	cmd.Stdin = strings.NewReader(script)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("sftp: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// sftpListedSize 从 sftp 的 ls -ln 输出中找出 name 的大小。
+// 每行前 8 列为权限、链接数、属主、属组、大小和时间，之后隔一个空格直到行尾是路径，路径中可以有空格
+func sftpListedSize(output, name string) (int64, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		fields := strings.Fields(line)
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		listed := line
+		for i := 0; i < 8; i++ {
+			listed = strings.TrimLeft(listed, " \t")
+			listed = listed[strings.IndexAny(listed, " \t"):]
+		}
+		listed = strings.TrimPrefix(listed, " ")
+		if listed != name && !strings.HasSuffix(listed, "/"+name) {
+			continue
+		}
+		if size, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// pushFiles 在一个 sftp 会话中把文件以 .<名称>.partial 的临时名称上传后重命名，再列出远程文件核对大小
+func pushFiles(target pushTarget, identity string, paths []string) error {
+	var script strings.Builder
+	if target.dir != "" {
+		fmt.Fprintf(&script, "-mkdir %s\n", sftpQuote(target.dir)) // 以 - 开头的命令失败时不中止，目录已存在是正常的
+	}
+	for _, local := range paths {
+		name := filepath.Base(local)
+		remote := path.Join(target.dir, name)
+		tmp := path.Join(target.dir, "."+name+".partial")
+		fmt.Fprintf(&script, "put %s %s\n", sftpQuote(local), sftpQuote(tmp))
+		fmt.Fprintf(&script, "rename %s %s\n", sftpQuote(tmp), sftpQuote(remote))
+	}
+	for _, local := range paths {
+		fmt.Fprintf(&script, "ls -ln %s\n", sftpQuote(path.Join(target.dir, filepath.Base(local))))
+	}
+	output, err := runSFTP(target, identity, script.String())
+	if err != nil {
+		return err
+	}
+	for _, local := range paths {
+		info, err := os.Stat(local)
+		if err != nil {
+			return err
+		}
+		size, ok := sftpListedSize(output, filepath.Base(local))
+		if !ok {
+			return fmt.Errorf("%s: %s", local, msg("error.pushMissing"))
+		}
+		if size != info.Size() {
+			return fmt.Errorf("%s: %s", local, msg("error.pushSize", size, info.Size()))
+		}
+	}
+	return nil
+}
+
+// pushArchive 把压缩包及其清单和附属校验和文件推送到 SFTP 服务器，失败时按设置的次数重试。
+// 附属文件先于压缩包上传，远程出现压缩包时其附属文件已经就绪
+func pushArchive(zipFilePath string, opts packOptions) error {
+	target, err := parsePushTarget(opts.PushTarget)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	sidecars := []string{manifestSuffix}
+	for _, algo := range checksumAlgorithms {
+		sidecars = append(sidecars, algo.ext)
+	}
+	for _, suffix := range sidecars {
+		if _, err := os.Stat(zipFilePath + suffix); err == nil {
+			paths = append(paths, zipFilePath+suffix)
+		}
+	}
+	paths = append(paths, zipFilePath)
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err = pushFiles(target, opts.PushIdentity, paths)
+		if err == nil {
+			logger.Info("push archive", "src", zipFilePath, "host", target.host, "dir", target.dir, "files", len(paths), "attempts", attempt, "duration", time.Since(start))
+			return nil
+		}
+		if attempt >= opts.PushRetries {
+			return err
+		}
+		logger.Warn("push failed, retrying", "src", zipFilePath, "attempt", attempt, "err", err)
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+}
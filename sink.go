@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// archiveSink 压缩包的写入目标，打包流程通过它创建压缩包，不关心压缩包最终写到哪里
+type archiveSink interface {
+	// Create 开始写入名为 name 的压缩包，写入器 Close 成功后压缩包才算写入完成
+	Create(name string) (sinkWriter, error)
+	// Location 返回名为 name 的压缩包的位置，用于日志
+	Location(name string) string
+	// Local 返回压缩包是否写入本地目录，只有本地的压缩包可以再读取校验、生成清单和校验和
+	Local() bool
+}
+
+// sinkWriter 写入一个压缩包
+type sinkWriter interface {
+	io.Writer
+	// Close 完成写入，远程目标在服务端确认收到完整内容后才返回 nil
+	Close() error
+	// Abort 放弃写入并尽量丢弃已写入的内容
+	Abort()
+}
+
+// errSinkAborted 放弃写入时用于中断远程请求
+var errSinkAborted = errors.New("archive write aborted")
+
+// newArchiveSink 按 opts.Sink 创建写入目标：为空时写入 fsys 的根目录，- 写到标准输出，
+// http(s):// 地址用 PUT 流式上传，s3 流式写入 Upload* 设置的存储桶
+func newArchiveSink(fsys writableFS, opts packOptions) (archiveSink, error) {
+	switch {
+	case opts.Sink == "":
+		return fileSink{fsys: fsys}, nil
+	case opts.Sink == "-":
+		return &stdoutSink{}, nil
+	case opts.Sink == "s3":
+		client, err := newS3Client(opts)
+		if err != nil {
+			return nil, err
+		}
+		return s3Sink{client: client, opts: opts}, nil
+	case strings.HasPrefix(opts.Sink, "http://") || strings.HasPrefix(opts.Sink, "https://"):
+		return httpSink{url: opts.Sink, client: &http.Client{}}, nil
+	}
+	return nil, errors.New(msg("error.sink", opts.Sink))
+}
+
+// writeToSink 在 sink 中创建名为 name 的压缩包并由 write 写入内容，返回写入的字节数；
+// 写入失败时放弃该压缩包
+func writeToSink(sink archiveSink, name string, write func(io.Writer) error) (int64, error) {
+	w, err := sink.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	if err := write(&progressWriter{w: w, report: func(n int64) { size += n }}); err != nil {
+		w.Abort()
+		return 0, err
+	}
+	return size, w.Close()
+}
+
+// fileSink 把压缩包写入文件系统的根目录
+type fileSink struct {
+	fsys writableFS
+}
+
+func (s fileSink) Create(name string) (sinkWriter, error) {
+	file, err := s.fsys.Create(name, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return fileSinkWriter{WriteCloser: file, fsys: s.fsys, name: name}, nil
+}
+
+func (s fileSink) Location(name string) string {
+	return fsPath(s.fsys, name)
+}
+
+func (fileSink) Local() bool {
+	return true
+}
+
+// fileSinkWriter 写入文件，放弃时删除写了一半的文件
+type fileSinkWriter struct {
+	io.WriteCloser
+	fsys writableFS
+	name string
+}
+
+func (w fileSinkWriter) Abort() {
+	w.Close()
+	w.fsys.Remove(w.name)
+}
+
+// stdoutSink 把压缩包写到标准输出，多个压缩包首尾相接无法区分，所以只能写一个
+type stdoutSink struct {
+	used bool
+}
+
+func (s *stdoutSink) Create(name string) (sinkWriter, error) {
+	if s.used {
+		return nil, errors.New(msg("error.sinkStdoutOnce"))
+	}
+	s.used = true
+	return stdoutSinkWriter{bufio.NewWriterSize(os.Stdout, 1<<20)}, nil
+}
+
+func (stdoutSink) Location(name string) string {
+	return "stdout"
+}
+
+func (stdoutSink) Local() bool {
+	return false
+}
+
+// stdoutSinkWriter 带缓冲地写到标准输出，已写出的内容无法撤回，放弃时只丢弃缓冲区
+type stdoutSinkWriter struct {
+	*bufio.Writer
+}
+
+func (w stdoutSinkWriter) Close() error {
+	return w.Flush()
+}
+
+func (w stdoutSinkWriter) Abort() {
+	w.Reset(io.Discard)
+}
+
+// httpSink 用 PUT 请求把压缩包流式上传到 url，不预先知道长度所以使用分块传输。
+// url 中含 {name} 时替换为压缩包文件名，以 / 结尾时追加文件名，否则所有压缩包都写到该地址；
+// url 中的用户名和密码用于 Basic 认证
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpSink) Location(name string) string {
+	switch {
+	case strings.Contains(s.url, "{name}"):
+		return strings.ReplaceAll(s.url, "{name}", url.PathEscape(name))
+	case strings.HasSuffix(s.url, "/"):
+		return s.url + url.PathEscape(name)
+	}
+	return s.url
+}
+
+func (httpSink) Local() bool {
+	return false
+}
+
+func (s httpSink) Create(name string) (sinkWriter, error) {
+	target := s.Location(name)
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, target, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/zip")
+	w := &httpSinkWriter{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			pr.CloseWithError(err)
+			w.err = err
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			w.err = errors.New(msg("error.sinkHTTP", target, resp.Status, strings.TrimSpace(string(body))))
+			pr.CloseWithError(w.err)
+		}
+	}()
+	return w, nil
+}
+
+// httpSinkWriter 把写入的内容经管道交给后台的 PUT 请求，请求结束后 err 记录其结果
+type httpSinkWriter struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+func (w *httpSinkWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	if err != nil {
+		// 请求提前结束时返回请求的错误，而不是管道已关闭
+		<-w.done
+		if w.err != nil {
+			err = w.err
+		}
+	}
+	return n, err
+}
+
+func (w *httpSinkWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+func (w *httpSinkWriter) Abort() {
+	w.pw.CloseWithError(errSinkAborted)
+	<-w.done
+}
+
+// s3Sink 把压缩包流式写入对象存储：内容先积攒到一段大小，超过一段时改用分段上传，
+// 内存中最多保留一段；对象键按 UploadKey 模板生成
+type s3Sink struct {
+	client *s3Client
+	opts   packOptions
+}
+
+func (s s3Sink) Location(name string) string {
+	return "s3://" + s.client.bucket + "/" + uploadKey(s.opts.UploadKey, name, s.opts)
+}
+
+func (s3Sink) Local() bool {
+	return false
+}
+
+func (s s3Sink) Create(name string) (sinkWriter, error) {
+	return &s3SinkWriter{
+		client: s.client,
+		key:    uploadKey(s.opts.UploadKey, name, s.opts),
+		buf:    make([]byte, 0, s.opts.UploadPartBytes),
+	}, nil
+}
+
+// s3SinkWriter 写入一个对象，uploadID 为空表示还没有开始分段上传
+type s3SinkWriter struct {
+	client   *s3Client
+	key      string
+	buf      []byte
+	uploadID string
+	parts    []s3Part
+	md5s     []byte
+}
+
+func (w *s3SinkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) && len(p) > 0 {
+			if err := w.flushPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flushPart 把缓冲区作为下一段上传，需要时先开始分段上传
+func (w *s3SinkWriter) flushPart() error {
+	if w.uploadID == "" {
+		uploadID, err := w.client.createMultipartUpload(w.key)
+		if err != nil {
+			return err
+		}
+		w.uploadID = uploadID
+	}
+	number := len(w.parts) + 1
+	etag, err := w.client.uploadPart(w.key, w.uploadID, number, w.buf)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(w.buf)
+	w.md5s = append(w.md5s, sum[:]...)
+	w.parts = append(w.parts, s3Part{PartNumber: number, ETag: `"` + etag + `"`})
+	logger.Debug("upload part", "key", w.key, "part", number, "size", len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *s3SinkWriter) Close() error {
+	// 不足一段的对象直接上传
+	if w.uploadID == "" {
+		_, err := w.client.putObject(w.key, w.buf)
+		return err
+	}
+	if err := w.flushPart(); err != nil {
+		w.Abort()
+		return err
+	}
+	_, err := w.client.completeMultipartUpload(w.key, w.uploadID, w.parts, w.md5s)
+	if err != nil {
+		w.Abort()
+	}
+	return err
+}
+
+func (w *s3SinkWriter) Abort() {
+	if w.uploadID == "" {
+		return
+	}
+	if err := w.client.abortMultipartUpload(w.key, w.uploadID); err != nil {
+		logger.Warn("upload abort failed", "key", w.key, "upload_id", w.uploadID, "err", err)
+	}
+	w.uploadID = ""
+}
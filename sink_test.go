@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// putRecorder 记录收到的 PUT 请求，status 不为 0 时返回该状态码
+type putRecorder struct {
+	mu      sync.Mutex
+	status  int
+	bodies  map[string][]byte
+	chunked bool
+	auth    string
+}
+
+func (p *putRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if p.status != 0 {
+		w.WriteHeader(p.status)
+		io.WriteString(w, "boom")
+		return
+	}
+	if p.bodies == nil {
+		p.bodies = make(map[string][]byte)
+	}
+	p.bodies[r.URL.Path] = body
+	p.chunked = slices.Contains(r.TransferEncoding, "chunked") && r.Header.Get("Content-Type") == "application/zip"
+	user, pass, _ := r.BasicAuth()
+	p.auth = user + ":" + pass
+}
+
+// TestHTTPSinkPack 打包时每个压缩包分块 PUT 到 {name} 替换后的地址，URL 中的用户名和密码用于认证，
+// 上传成功后按删除方式删除批次文件夹，源目录中不留下压缩包
+func TestHTTPSinkPack(t *testing.T) {
+	recorder := &putRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	fsys := newMemFS()
+	fsys.files["a.txt"] = &fstest.MapFile{Data: []byte("alpha"), Mode: 0o644}
+	fsys.files["b.txt"] = &fstest.MapFile{Data: []byte("bravo"), Mode: 0o644}
+	opts := defaultPackOptions()
+	opts.Prefix = "P_"
+	opts.MaxFiles = 1
+	opts.DeletePolicy = "delete"
+	opts.Sink = strings.Replace(server.URL, "://", "://u:p@", 1) + "/up/{name}"
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.names(); len(got) != 0 {
+		t.Errorf("files left in the source directory: %q", got)
+	}
+	if !recorder.chunked || recorder.auth != "u:p" {
+		t.Errorf("chunked = %v, auth = %q", recorder.chunked, recorder.auth)
+	}
+	for name, want := range map[string]string{"/up/P_1.zip": "a.txt", "/up/P_2.zip": "b.txt"} {
+		body := recorder.bodies[name]
+		reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(reader.File) != 2 || reader.File[1].Name != want {
+			t.Errorf("%s entries %v", name, reader.File)
+		}
+	}
+}
+
+// TestHTTPSinkFailure 服务端返回错误时报告状态和响应内容，批次文件夹保留
+func TestHTTPSinkFailure(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	server := httptest.NewServer(&putRecorder{status: http.StatusInternalServerError})
+	defer server.Close()
+	sink := httpSink{url: server.URL + "/", client: server.Client()}
+	_, err := writeToSink(sink, "P_1.zip", func(w io.Writer) error {
+		_, err := w.Write(make([]byte, 1<<16))
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v", err)
+	}
+
+	fsys := newMemFS()
+	fsys.files["a.txt"] = &fstest.MapFile{Data: []byte("alpha"), Mode: 0o644}
+	opts := defaultPackOptions()
+	opts.Prefix = "P_"
+	opts.DeletePolicy = "delete"
+	opts.Sink = server.URL + "/"
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("P_1/a.txt"); err != nil {
+		t.Errorf("batch folder removed after a failed upload: %v", err)
+	}
+}
+
+// TestHTTPSinkAbort 写入失败时中断请求，服务端收不到完整的内容
+func TestHTTPSinkAbort(t *testing.T) {
+	recorder := &putRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+	failed := errors.New("disk error")
+	sink := httpSink{url: server.URL + "/x.zip", client: server.Client()}
+	if _, err := writeToSink(sink, "P_1.zip", func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failed
+	}); err != failed {
+		t.Errorf("err = %v, want the write error", err)
+	}
+	server.Close() // 等待服务端处理完请求
+	if len(recorder.bodies) != 0 {
+		t.Errorf("server received %v", recorder.bodies)
+	}
+}
+
+func TestHTTPSinkLocation(t *testing.T) {
+	for url, want := range map[string]string{
+		"http://h/a/{name}?x=1": "http://h/a/P%201.zip?x=1",
+		"http://h/a/":           "http://h/a/P%201.zip",
+		"http://h/a.zip":        "http://h/a.zip",
+	} {
+		if got := (httpSink{url: url}).Location("P 1.zip"); got != want {
+			t.Errorf("Location(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+// TestS3Sink 小于一段的压缩包直接上传，超过一段时分段上传，放弃时取消分段上传
+func TestS3Sink(t *testing.T) {
+	store := newFakeS3()
+	server := httptest.NewServer(store)
+	defer server.Close()
+	opts := defaultPackOptions()
+	opts.UploadEndpoint, opts.UploadBucket, opts.UploadAccessKey, opts.UploadSecretKey = server.URL, "bucket", "AK", "SK"
+	opts.UploadKey = "{name}"
+	opts.UploadPartBytes = 1024
+	sink, err := newArchiveSink(newMemFS(), withSink(opts, "s3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.Location("P_1.zip"); got != "s3://bucket/P_1.zip" {
+		t.Errorf("Location = %q", got)
+	}
+
+	for name, size := range map[string]int{"small.zip": 100, "large.zip": 2*1024 + 100} {
+		data := bytes.Repeat([]byte{7}, size)
+		if n, err := writeToSink(sink, name, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		}); err != nil || n != int64(size) {
+			t.Fatalf("%s: wrote %d, %v", name, n, err)
+		}
+		if got := store.objects["/bucket/"+name]; !bytes.Equal(got, data) {
+			t.Errorf("%s: stored %d bytes, want %d", name, len(got), size)
+		}
+	}
+	if !strings.HasSuffix(store.etags["/bucket/large.zip"], "-3") {
+		t.Errorf("large.zip etag %q, want a 3-part upload", store.etags["/bucket/large.zip"])
+	}
+
+	if _, err := writeToSink(sink, "aborted.zip", func(w io.Writer) error {
+		w.Write(make([]byte, 3000))
+		return errors.New("disk error")
+	}); err == nil {
+		t.Fatal("aborted write succeeded")
+	}
+	if _, ok := store.objects["/bucket/aborted.zip"]; ok || len(store.uploads) != 0 {
+		t.Errorf("aborted upload left data: %d uploads", len(store.uploads))
+	}
+}
+
+// withSink 返回设置了写入目标的选项
+func withSink(opts packOptions, sink string) packOptions {
+	opts.Sink = sink
+	return opts
+}
+
+// TestFileSinkAbort 放弃写入时删除写了一半的文件
+func TestFileSinkAbort(t *testing.T) {
+	fsys := newMemFS()
+	if _, err := writeToSink(fileSink{fsys: fsys}, "P_1.zip", func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return errors.New("disk error")
+	}); err == nil {
+		t.Fatal("aborted write succeeded")
+	}
+	if got := fsys.names(); len(got) != 0 {
+		t.Errorf("files left: %q", got)
+	}
+}
+
+// TestStdoutSink 标准输出只能写一个压缩包，文件分成多批时在移动文件之前报错
+func TestStdoutSink(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	sink := &stdoutSink{}
+	w, err := sink.Create("P_1.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if _, err := sink.Create("P_2.zip"); err == nil {
+		t.Error("second archive to stdout accepted")
+	}
+
+	fsys := newMemFS()
+	fsys.files["a.txt"] = &fstest.MapFile{Data: []byte("alpha"), Mode: 0o644}
+	fsys.files["b.txt"] = &fstest.MapFile{Data: []byte("bravo"), Mode: 0o644}
+	opts := defaultPackOptions()
+	opts.MaxFiles = 1
+	opts.Sink = "-"
+	if _, err := organizeFilesAndCompress(fsys, opts); err == nil || !strings.Contains(err.Error(), "2 batches") {
+		t.Errorf("err = %v", err)
+	}
+	if got := fsys.names(); !slices.Equal(got, []string{"a.txt", "b.txt"}) {
+		t.Errorf("files were moved: %q", got)
+	}
+}
+
+// TestValidateSink 无效的目标报错，远程目标不能与需要本地压缩包的功能同时使用
+func TestValidateSink(t *testing.T) {
+	defer func(l string) { locale = l }(locale)
+	locale = "en"
+	opts := defaultPackOptions()
+	for _, sink := range []string{"", "-", "http://h/", "https://h/{name}"} {
+		if err := withSink(opts, sink).validateSink(); err != nil {
+			t.Errorf("%q: %v", sink, err)
+		}
+	}
+	if err := withSink(opts, "ftp://h/").validateSink(); err == nil {
+		t.Error("ftp sink accepted")
+	}
+	if err := withSink(opts, "s3").validateSink(); err == nil {
+		t.Error("s3 sink without an endpoint accepted")
+	}
+	opts.Manifest = true
+	if err := withSink(opts, "-").validateSink(); err == nil || !strings.Contains(err.Error(), "-manifest") {
+		t.Errorf("manifest with stdout: %v", err)
+	}
+	if err := opts.validateSink(); err != nil {
+		t.Errorf("manifest with a local archive: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+// stateFileName 增量模式的状态文件，保存在源目录中，记录已打包过的文件
+const stateFileName = ".marszip-state.json"
+
+// archivedFile 状态文件中一个已打包文件的记录
+type archivedFile struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	SHA256   string    `json:"sha256"`
+	Archive  string    `json:"archive"`
+	Archived time.Time `json:"archived"`
+}
+
+// archiveState 增量模式的状态，Files 以相对于源目录的路径为键
+type archiveState struct {
+	Version int                     `json:"version"`
+	Files   map[string]archivedFile `json:"files"`
+
+	fsys   writableFS        // 源目录，状态文件和待检查的文件都在其中
+	byHash map[string]string // SHA-256 -> 已打包的文件名
+}
+
+// loadState 读取源目录 fsys 中的状态文件，文件不存在时返回空状态
+func loadState(fsys writableFS) (*archiveState, error) {
+	state := &archiveState{Version: 1, Files: make(map[string]archivedFile), fsys: fsys}
+	data, err := fs.ReadFile(fsys, stateFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		state.byHash = make(map[string]string)
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("%s: %w", fsPath(fsys, stateFileName), err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]archivedFile)
+	}
+	state.byHash = make(map[string]string)
+	for name, file := range state.Files {
+		state.byHash[file.SHA256] = name
+	}
+	return state, nil
+}
+
+// save 先写入临时文件再重命名，避免中断时留下损坏的状态文件
+func (s *archiveState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(s.fsys, stateFileName, data, 0644)
+}
+
+// record 记录一个已打包的文件
+func (s *archiveState) record(name string, info os.FileInfo, sum, archive string) {
+	s.Files[name] = archivedFile{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum, Archive: archive, Archived: time.Now()}
+	s.byHash[sum] = name
+}
+
+// skipArchived 过滤掉已打包过的文件：路径、大小和修改时间都相同时直接跳过，
+// 否则在有相同大小的记录时计算 SHA-256，内容相同的文件也跳过并记下新的路径
+func (s *archiveState) skipArchived(fileEntries []os.DirEntry) ([]os.DirEntry, error) {
+	sizes := make(map[int64]bool)
+	for _, file := range s.Files {
+		sizes[file.Size] = true
+	}
+	var remaining []os.DirEntry
+	changed := false
+	for _, entry := range fileEntries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if known, ok := s.Files[entry.Name()]; ok && known.Size == info.Size() && known.ModTime.Equal(info.ModTime()) {
+			logger.Debug("skip archived file", "src", entry.Name(), "archive", known.Archive)
+			continue
+		}
+		if sizes[info.Size()] {
+			sum, err := fileChecksum(s.fsys, entry.Name(), sha256.New)
+			if err != nil {
+				return nil, err
+			}
+			if original, ok := s.byHash[sum]; ok {
+				archive := s.Files[original].Archive
+				logger.Info("skip archived file", "src", entry.Name(), "original", original, "archive", archive)
+				s.record(entry.Name(), info, sum, archive)
+				changed = true
+				continue
+			}
+		}
+		remaining = append(remaining, entry)
+	}
+	if changed {
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// recordBatch 在压缩包 zipName 校验通过后记录批次文件夹 folder 中的文件（包括只记录在清单中的重复文件）并保存状态
+func (s *archiveState) recordBatch(folder, zipName string, job batchJob) error {
+	archive := path.Base(zipName)
+	sums := make(map[string]string)
+	for _, entry := range job.files {
+		name := path.Join(folder, entry.Name())
+		info, err := s.fsys.Stat(name)
+		if err != nil {
+			return err
+		}
+		sum, err := fileChecksum(s.fsys, name, sha256.New)
+		if err != nil {
+			return err
+		}
+		sums[entry.Name()] = sum
+		s.record(entry.Name(), info, sum, archive)
+	}
+	for alias, original := range job.aliases {
+		info, err := s.fsys.Stat(path.Join(folder, alias))
+		if err != nil {
+			return err
+		}
+		s.record(alias, info, sums[original], archive)
+	}
+	return s.save()
+}
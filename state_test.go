@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestIncrementalState 打包后记录每个文件的大小、修改时间、SHA-256 和压缩包；再次打包时跳过路径和修改时间相同的文件，
+// 以及改名但内容相同的文件（记下新的路径），修改过的文件按内容比较后重新打包
+func TestIncrementalState(t *testing.T) {
+	fsys := newMemFS()
+	modified := time.Date(2024, 9, 30, 12, 0, 0, 0, time.UTC)
+	put := func(name, data string, modTime time.Time) {
+		fsys.files[name] = &fstest.MapFile{Data: []byte(data), Mode: 0o644, ModTime: modTime}
+	}
+	put("a.txt", "alpha", modified)
+	put("b.txt", "bravo", modified)
+	opts := defaultPackOptions()
+	opts.Prefix = "P_"
+	opts.Incremental = true
+	opts.DeletePolicy = "delete"
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadState(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("alpha"))
+	if a := state.Files["a.txt"]; a.Size != 5 || !a.ModTime.Equal(modified) || a.SHA256 != hex.EncodeToString(sum[:]) || a.Archive != "P_1.zip" || a.Archived.IsZero() {
+		t.Errorf("a.txt = %+v", a)
+	}
+
+	later := modified.Add(time.Hour)
+	put("a.txt", "alpha", modified) // 同一路径，未改动
+	put("f.txt", "alpha", later)    // 改名的副本
+	put("b.txt", "BRAVO", later)    // 大小相同但内容改变
+	put("g.txt", "golf", later)
+	if _, err := organizeFilesAndCompress(fsys, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsys.names(), []string{stateFileName, "P_1.zip", "P_2.zip", "a.txt", "f.txt"}; !slices.Equal(got, want) {
+		t.Errorf("after second pack: %q, want %q", got, want)
+	}
+	if got, want := archiveEntryNames(t, fsys, "P_2.zip"), []string{"P_2/", "b.txt", "g.txt"}; !slices.Equal(got, want) {
+		t.Errorf("P_2.zip entries %q, want %q", got, want)
+	}
+	state, err = loadState(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, archive := range map[string]string{"a.txt": "P_1.zip", "f.txt": "P_1.zip", "b.txt": "P_2.zip", "g.txt": "P_2.zip"} {
+		if got := state.Files[name].Archive; got != archive {
+			t.Errorf("%s archived in %q, want %q", name, got, archive)
+		}
+	}
+	if f := state.Files["f.txt"]; !f.ModTime.Equal(later) || f.SHA256 != state.Files["a.txt"].SHA256 {
+		t.Errorf("f.txt = %+v", f)
+	}
+}
+
+// TestLoadStateErrors 没有状态文件时返回空状态，状态文件损坏时报错并指出文件
+func TestLoadStateErrors(t *testing.T) {
+	fsys := newMemFS()
+	state, err := loadState(fsys)
+	if err != nil || len(state.Files) != 0 {
+		t.Fatalf("no state file: %+v, %v", state, err)
+	}
+	fsys.files[stateFileName] = &fstest.MapFile{Data: []byte(`{"files": [`)}
+	if _, err := loadState(fsys); err == nil || !strings.Contains(err.Error(), stateFileName) {
+		t.Errorf("broken state file: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// planTopUp 计算最后一个压缩包 prefixN.zip 还能容纳的文件，返回补充它的批次和剩余的文件。
+// 压缩包不存在、已满，或没有可放入的文件时返回 nil。
+// 与压缩包条目或批次文件夹中已有文件同名的文件（包括其重复文件）不会放入，避免覆盖
+func planTopUp(fsys writableFS, maxZipNum int, fileEntries []os.DirEntry, aliases map[string]string, opts packOptions) (*batchJob, []os.DirEntry, error) {
+	folderName := fmt.Sprintf("%s%d", opts.Prefix, maxZipNum)
+	zipName := folderName + ".zip"
+	reader, closer, err := openZipFS(fsys, zipName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fileEntries, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fsPath(fsys, zipName), err)
+	}
+	defer closer.Close()
+
+	taken := make(map[string]bool)
+	files := 0
+	var bytes int64
+	for _, file := range reader.File {
+		taken[file.Name] = true
+		if !file.FileInfo().IsDir() {
+			files++
+			bytes += int64(file.UncompressedSize64)
+		}
+	}
+	if opts.BatchBy == "count" && files >= opts.MaxFiles || opts.BatchBy == "size" && bytes >= opts.MaxBatchBytes {
+		return nil, fileEntries, nil
+	}
+	available := func(name string) bool {
+		if taken[name] {
+			return false
+		}
+		_, err := fs.Lstat(fsys, path.Join(folderName, name))
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	aliasesOf := make(map[string][]string)
+	for alias, original := range aliases {
+		aliasesOf[original] = append(aliasesOf[original], alias)
+	}
+
+	job := &batchJob{folderName: folderName, topUp: true}
+	var remaining []os.DirEntry
+	full := false
+	for _, entry := range fileEntries {
+		var size int64
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+		fits := !full && available(entry.Name())
+		for _, alias := range aliasesOf[entry.Name()] {
+			fits = fits && available(alias)
+		}
+		if fits && opts.BatchBy == "size" && bytes+size > opts.MaxBatchBytes {
+			fits, full = false, true // 保持文件顺序，放不下后剩余文件都进入新批次
+		}
+		if !fits {
+			remaining = append(remaining, entry)
+			continue
+		}
+		job.files = append(job.files, entry)
+		files++
+		bytes += size
+		if opts.BatchBy == "count" && files >= opts.MaxFiles {
+			full = true
+		}
+	}
+	if len(job.files) == 0 {
+		return nil, fileEntries, nil
+	}
+	return job, remaining, nil
+}
+
+// appendToZip 把 fsys 中文件夹 folder 里的文件追加到已有的压缩包 zipName：先将原有条目原样复制到同目录的临时文件，
+// 再按 opts 写入新文件，校验通过后用重命名原子地替换原压缩包。返回原有的文件条目数
+func appendToZip(fsys writableFS, folder, zipName string, files []os.DirEntry, opts packOptions, report func(progressEvent)) (int, error) {
+	reader, closer, err := openZipFS(fsys, zipName)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	info, err := fsys.Stat(zipName)
+	if err != nil {
+		return 0, err
+	}
+
+	// 临时文件以 .zip 结尾，不会被当作待打包的文件
+	tmpFile, tmpName, err := fsys.CreateTemp(path.Dir(zipName), strings.TrimSuffix(path.Base(zipName), ".zip")+".topup-*.zip", info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer fsys.Remove(tmpName) // 重命名成功后删除不会生效
+	defer tmpFile.Close()
+
+	existing := 0
+	zipWriter := zip.NewWriter(tmpFile)
+	for _, file := range reader.File {
+		if err := zipWriter.Copy(file); err != nil {
+			return 0, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		if !file.FileInfo().IsDir() {
+			existing++
+		}
+	}
+	for _, entry := range files {
+		if err := addZipEntry(zipWriter, fsys, path.Join(folder, entry.Name()), entry.Name(), opts, report); err != nil {
+			return 0, err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return 0, err
+	}
+	if syncer, ok := tmpFile.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	if err := tmpFile.Close(); err != nil {
+		return 0, err
+	}
+
+	// 替换前校验临时文件，失败时原压缩包保持不变
+	if err := verifyZip(fsys, tmpName, existing+len(files)); err != nil {
+		return 0, err
+	}
+	closer.Close() // Windows 上需要先关闭原压缩包才能替换
+	return existing, fsys.Rename(tmpName, zipName)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// writeMemZip 在 fsys 中写入压缩包 name，files 为条目名和内容交替的列表
+func writeMemZip(t *testing.T, fsys *memFS, name string, files ...string) {
+	t.Helper()
+	w, err := fsys.Create(name, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(w)
+	for i := 0; i < len(files); i += 2 {
+		fw, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, files[i+1])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+}
+
+// dirEntries 返回 fsys 中目录 dir 里的文件
+func dirEntries(t *testing.T, fsys fs.ReadDirFS, dir string) []os.DirEntry {
+	t.Helper()
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// TestAppendToZip 原有条目原样保留，新文件追加到末尾，压缩包的权限不变，临时文件不留下
+func TestAppendToZip(t *testing.T) {
+	fsys := newMemFS()
+	writeMemZip(t, fsys, "P_1.zip", "P_1/", "", "a.txt", "alpha", "b.txt", "bravo")
+	fsys.files["P_1/c.txt"] = &fstest.MapFile{Data: []byte("charlie"), Mode: 0o644}
+	fsys.files["P_1/d.txt"] = &fstest.MapFile{Data: []byte("delta"), Mode: 0o644}
+
+	existing, err := appendToZip(fsys, "P_1", "P_1.zip", dirEntries(t, fsys, "P_1"), defaultPackOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing != 2 {
+		t.Errorf("existing = %d, want 2", existing)
+	}
+	reader, closer, err := openZipFS(fsys, "P_1.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	var got []string
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		got = append(got, file.Name+"="+string(data))
+	}
+	if want := []string{"P_1/=", "a.txt=alpha", "b.txt=bravo", "c.txt=charlie", "d.txt=delta"}; !slices.Equal(got, want) {
+		t.Errorf("entries %q, want %q", got, want)
+	}
+	if info, _ := fsys.Stat("P_1.zip"); info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v", info.Mode())
+	}
+	if got := fsys.names(); !slices.Equal(got, []string{"P_1.zip"}) {
+		t.Errorf("files %q", got)
+	}
+}
+
+// TestAppendToZipFailure 追加失败时原压缩包保持不变，临时文件被删除
+func TestAppendToZipFailure(t *testing.T) {
+	fsys := newMemFS()
+	writeMemZip(t, fsys, "P_1.zip", "a.txt", "alpha")
+	before := fsys.files["P_1.zip"].Data
+	fsys.files["P_1/c.txt"] = &fstest.MapFile{Data: []byte("charlie"), Mode: 0o644}
+	entries := dirEntries(t, fsys, "P_1")
+	delete(fsys.files, "P_1/c.txt")
+
+	if _, err := appendToZip(fsys, "P_1", "P_1.zip", entries, defaultPackOptions(), nil); err == nil {
+		t.Fatal("appending a missing file succeeded")
+	}
+	if !slices.Equal(fsys.files["P_1.zip"].Data, before) {
+		t.Error("original archive changed")
+	}
+	for _, name := range fsys.names() {
+		if strings.Contains(name, "topup") {
+			t.Errorf("temporary file %s left behind", name)
+		}
+	}
+}
+
+// TestPlanTopUp 只补充未满的最后一个压缩包，与已有条目或批次文件夹中文件同名的文件及其重复文件不放入
+func TestPlanTopUp(t *testing.T) {
+	fsys := newMemFS()
+	writeMemZip(t, fsys, "P_2.zip", "P_2/", "", "a.txt", "alpha")
+	fsys.files["P_2/b.txt"] = &fstest.MapFile{Data: []byte("bravo")}
+	for name, data := range map[string]string{"a.txt": "x", "b.txt": "x", "c.txt": "x", "d.txt": "x", "e.txt": "x", "f.txt": "x"} {
+		fsys.files[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	var files []os.DirEntry
+	for _, entry := range dirEntries(t, fsys, ".") {
+		if !entry.IsDir() && entry.Name() != "P_2.zip" && entry.Name() != "e.txt" && entry.Name() != "f.txt" {
+			files = append(files, entry)
+		}
+	}
+	names := func(entries []os.DirEntry) string {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return strings.Join(names, ",")
+	}
+
+	opts := defaultPackOptions()
+	opts.Prefix = "P_"
+	opts.MaxFiles = 3
+	// e.txt、f.txt 是 c.txt、b.txt 的重复文件，随保留副本移动
+	job, remaining, err := planTopUp(fsys, 2, files, map[string]string{"f.txt": "b.txt", "e.txt": "c.txt"}, opts)
+	if err != nil || job == nil {
+		t.Fatalf("job = %v, err = %v", job, err)
+	}
+	if job.folderName != "P_2" || !job.topUp || names(job.files) != "c.txt,d.txt" {
+		t.Errorf("job = %s %v %s", job.folderName, job.topUp, names(job.files))
+	}
+	if got := names(remaining); got != "a.txt,b.txt" {
+		t.Errorf("remaining = %s", got)
+	}
+
+	opts.MaxFiles = 1
+	if job, remaining, _ := planTopUp(fsys, 2, files, nil, opts); job != nil || len(remaining) != len(files) {
+		t.Errorf("full archive: job = %v", job)
+	}
+	if job, remaining, _ := planTopUp(fsys, 3, files, nil, opts); job != nil || len(remaining) != len(files) {
+		t.Errorf("missing archive: job = %v", job)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trashDirName 非 Linux 系统上默认回收站的目录名，位于源目录下
+const trashDirName = ".marszip-trash"
+
+// trashItem 回收站中的一项
+type trashItem struct {
+	Name         string    // 回收站中的名称
+	OriginalPath string    // 原始路径
+	DeletedAt    time.Time // 移入回收站的时间
+	Size         int64     // 占用的字节数
+}
+
+// resolveTrashDir 确定回收站目录：优先使用设置中的目录（相对路径相对于源目录），
+// Linux 上默认使用 freedesktop 回收站，其他系统默认使用源目录下的 .marszip-trash
+func resolveTrashDir(sourceDir string, opts packOptions) string {
+	if opts.TrashDir != "" {
+		if filepath.IsAbs(opts.TrashDir) {
+			return opts.TrashDir
+		}
+		return filepath.Join(sourceDir, opts.TrashDir)
+	}
+	if runtime.GOOS == "linux" {
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				dataHome = filepath.Join(home, ".local", "share")
+			}
+		}
+		if dataHome != "" {
+			return filepath.Join(dataHome, "Trash")
+		}
+	}
+	return filepath.Join(sourceDir, trashDirName)
+}
+
+// moveToTrash 将文件或文件夹移入回收站，按 freedesktop 规范在 info 目录中记录原始路径和删除时间
+func moveToTrash(trashDir, path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(infoDir, 0700); err != nil {
+		return "", err
+	}
+
+	// 以独占方式创建 info 文件来占用一个不重复的名称
+	base := filepath.Base(absPath)
+	name := base
+	var info *os.File
+	for i := 2; ; i++ {
+		info, err = os.OpenFile(filepath.Join(infoDir, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+	infoPath := info.Name()
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\nX-MarsZip=true\n",
+		(&url.URL{Path: filepath.ToSlash(absPath)}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = movePath(absPath, filepath.Join(filesDir, name))
+	}
+	if err != nil {
+		os.Remove(infoPath)
+		return "", err
+	}
+	return filepath.Join(filesDir, name), nil
+}
+
+// movePath 移动文件或文件夹，跨磁盘无法直接重命名时先复制再删除
+func movePath(oldPath, newPath string) error {
+	if err := os.Rename(oldPath, newPath); err == nil {
+		return nil
+	}
+	if err := copyTree(oldPath, newPath); err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+	return os.RemoveAll(oldPath)
+}
+
+// copyTree 递归复制文件或文件夹，保留权限和修改时间
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// listTrash 列出回收站中由本程序移入的项目，按删除时间从早到晚排序
+func listTrash(trashDir string) ([]trashItem, error) {
+	entries, err := os.ReadDir(filepath.Join(trashDir, "info"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []trashItem
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".trashinfo") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(trashDir, "info", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		item := trashItem{Name: strings.TrimSuffix(entry.Name(), ".trashinfo")}
+		ours := false
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+			switch key {
+			case "Path":
+				if p, err := url.PathUnescape(value); err == nil {
+					item.OriginalPath = filepath.FromSlash(p)
+				}
+			case "DeletionDate":
+				item.DeletedAt, _ = time.ParseInLocation("2006-01-02T15:04:05", value, time.Local)
+			case "X-MarsZip":
+				ours = value == "true"
+			}
+		}
+		// 共用系统回收站时不处理其他程序移入的项目
+		if !ours {
+			continue
+		}
+		item.Size = dirSize(dirFS(filepath.Join(trashDir, "files")), item.Name)
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.Before(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// removeTrashItem 从回收站中永久删除一项
+func removeTrashItem(trashDir string, item trashItem) error {
+	if err := os.RemoveAll(filepath.Join(trashDir, "files", item.Name)); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(trashDir, "info", item.Name+".trashinfo"))
+}
+
+// purgeTrash 按保留策略清理回收站：删除超过 retentionDays 天的项目，
+// 总大小超过 maxBytes 时从最早的项目开始删除，两个值为 0 时表示不限制
+func purgeTrash(trashDir string, retentionDays int, maxBytes int64) error {
+	if retentionDays <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	items, err := listTrash(trashDir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	for _, item := range items {
+		expired := retentionDays > 0 && item.DeletedAt.Before(cutoff)
+		overCap := maxBytes > 0 && total > maxBytes
+		if !expired && !overCap {
+			continue
+		}
+		if err := removeTrashItem(trashDir, item); err != nil {
+			return err
+		}
+		total -= item.Size
+		logger.Info("purge trash", "src", item.OriginalPath, "trash", item.Name, "size", item.Size, "deleted_at", item.DeletedAt)
+	}
+	return nil
+}
+
+// restoreTrashItem 将回收站中的一项移回原始路径，原始路径已存在时报错
+func restoreTrashItem(trashDir string, item trashItem) error {
+	if _, err := os.Lstat(item.OriginalPath); err == nil {
+		return errors.New(msg("error.restoreExists", item.OriginalPath))
+	}
+	if err := os.MkdirAll(filepath.Dir(item.OriginalPath), 0777); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := movePath(filepath.Join(trashDir, "files", item.Name), item.OriginalPath); err != nil {
+		return err
+	}
+	logger.Info("restore", "src", item.Name, "dst", item.OriginalPath, "size", item.Size, "duration", time.Since(start))
+	return os.Remove(filepath.Join(trashDir, "info", item.Name+".trashinfo"))
+}
+
+// restoreFromTrash 将回收站中的项目恢复到原始位置；
+// 未指定名称且未指定 all 时只列出项目，prefix 不为空时只处理名称以其开头的项目
+func restoreFromTrash(trashDir, prefix string, all bool, names []string) error {
+	items, err := listTrash(trashDir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 && !all {
+		for _, item := range items {
+			if strings.HasPrefix(filepath.Base(item.OriginalPath), prefix) {
+				fmt.Printf("%-24s %s  %10s  %s\n", item.Name, item.DeletedAt.Format("2006-01-02 15:04:05"), formatBytes(item.Size), item.OriginalPath)
+			}
+		}
+		return nil
+	}
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var firstErr error
+	restored := 0
+	for _, item := range items {
+		if !strings.HasPrefix(filepath.Base(item.OriginalPath), prefix) || (!all && !wanted[item.Name]) {
+			continue
+		}
+		delete(wanted, item.Name)
+		if err := restoreTrashItem(trashDir, item); err != nil {
+			logger.Error("restore failed", "src", item.Name, "dst", item.OriginalPath, "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		restored++
+	}
+	for name := range wanted {
+		logger.Error("restore failed", "src", name, "err", msg("error.notInTrash", name))
+		if firstErr == nil {
+			firstErr = errors.New(msg("error.notInTrash", name))
+		}
+	}
+	fmt.Fprintln(statusOut, msg("summary.restored", restored))
+	return firstErr
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTrashItem 直接在回收站中放入一项，删除时间为 deletedAt，ours 为 false 时模拟其他程序移入的项目
+func writeTrashItem(t *testing.T, trashDir, name string, size int, deletedAt time.Time, ours bool) {
+	t.Helper()
+	for _, dir := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashDir, dir), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(trashDir, "files", name), make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info := "[Trash Info]\nPath=/tmp/" + name + "\nDeletionDate=" + deletedAt.Format("2006-01-02T15:04:05") + "\n"
+	if ours {
+		info += "X-MarsZip=true\n"
+	}
+	if err := os.WriteFile(filepath.Join(trashDir, "info", name+".trashinfo"), []byte(info), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTrashRoundTrip 同名的项目移入回收站时改名，列出时只包括本程序移入的项目，恢复到原始路径，原始路径已存在时不覆盖
+func TestTrashRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	trashDir := filepath.Join(dir, "trash")
+	source := filepath.Join(dir, "src", "P 1")
+	writeFolder := func(data string) {
+		if err := os.MkdirAll(source, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFolder("first")
+	first, err := moveToTrash(trashDir, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFolder("second!")
+	second, err := moveToTrash(trashDir, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(first) != "P 1" || filepath.Base(second) != "P 1.2" {
+		t.Errorf("trash names %q, %q", first, second)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("source still exists: %v", err)
+	}
+	writeTrashItem(t, trashDir, "foreign", 10, time.Now(), false)
+
+	items, err := listTrash(trashDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("items = %+v, want the two moved folders", items)
+	}
+	// 删除时间只精确到秒，同一秒内移入的项目按名称查找
+	byName := make(map[string]trashItem)
+	for _, item := range items {
+		byName[item.Name] = item
+	}
+	for name, size := range map[string]int64{"P 1": 5, "P 1.2": 7} {
+		if item := byName[name]; item.OriginalPath != source || item.Size != size {
+			t.Errorf("%s = %+v, want %d bytes from %s", name, item, size, source)
+		}
+	}
+
+	if err := restoreTrashItem(trashDir, byName["P 1.2"]); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(source, "a.txt")); err != nil || string(data) != "second!" {
+		t.Errorf("restored content %q, %v", data, err)
+	}
+	if err := restoreTrashItem(trashDir, byName["P 1"]); err == nil {
+		t.Error("restore over an existing path succeeded")
+	}
+	if items, _ := listTrash(trashDir); len(items) != 1 || items[0].Name != "P 1" {
+		t.Errorf("items after restore = %+v", items)
+	}
+}
+
+// TestPurgeTrash 删除超过保留天数的项目，总大小超限时从最早的项目开始删除，不删除其他程序移入的项目
+func TestPurgeTrash(t *testing.T) {
+	trashDir := t.TempDir()
+	now := time.Now()
+	writeTrashItem(t, trashDir, "old", 10, now.AddDate(0, 0, -10), true)
+	writeTrashItem(t, trashDir, "older-foreign", 10, now.AddDate(0, 0, -20), false)
+	writeTrashItem(t, trashDir, "mid", 30, now.Add(-2*time.Hour), true)
+	writeTrashItem(t, trashDir, "new", 30, now.Add(-time.Hour), true)
+
+	names := func() []string {
+		items, err := listTrash(trashDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+	if err := purgeTrash(trashDir, 0, 0); err != nil || len(names()) != 3 {
+		t.Fatalf("unlimited purge removed items: %v, %v", names(), err)
+	}
+	if err := purgeTrash(trashDir, 7, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names(), ","); got != "mid,new" {
+		t.Errorf("after retention purge: %s", got)
+	}
+	if err := purgeTrash(trashDir, 0, 40); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names(), ","); got != "new" {
+		t.Errorf("after size purge: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(trashDir, "files", "older-foreign")); err != nil {
+		t.Errorf("foreign item purged: %v", err)
+	}
+}
+
+// TestPackTrashPolicy 按 trash 方式打包后批次文件夹进入回收站，restore 把它恢复到源目录
+func TestPackTrashPolicy(t *testing.T) {
+	defer func(w io.Writer) { statusOut = w }(statusOut)
+	statusOut = io.Discard
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := defaultPackOptions()
+	opts.DeletePolicy = "trash"
+	opts.TrashDir = ".trash"
+	if _, err := organizeFilesAndCompress(dirFS(dir), opts); err != nil {
+		t.Fatal(err)
+	}
+	folder := filepath.Join(dir, opts.Prefix+"1")
+	if _, err := os.Stat(folder); !os.IsNotExist(err) {
+		t.Fatalf("batch folder not removed: %v", err)
+	}
+	trashDir := resolveTrashDir(dir, opts)
+	if trashDir != filepath.Join(dir, ".trash") {
+		t.Errorf("trash dir = %q", trashDir)
+	}
+	if err := restoreFromTrash(trashDir, opts.Prefix, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(folder, "b.txt")); err != nil || string(data) != "b.txt" {
+		t.Errorf("restored b.txt: %q, %v", data, err)
+	}
+	if err := restoreFromTrash(trashDir, opts.Prefix, false, []string{"nope"}); err == nil {
+		t.Error("restoring an unknown item succeeded")
+	}
+}
+
+// TestResolveTrashDir 设置的目录优先，Linux 上默认使用 XDG_DATA_HOME 下的回收站，其他系统使用源目录下的目录
+func TestResolveTrashDir(t *testing.T) {
+	opts := defaultPackOptions()
+	source := filepath.Join(string(filepath.Separator), "src")
+	abs := filepath.Join(string(filepath.Separator), "abs", "trash")
+	opts.TrashDir = abs
+	if got := resolveTrashDir(source, opts); got != abs {
+		t.Errorf("absolute: %q", got)
+	}
+	opts.TrashDir = "t"
+	if got := resolveTrashDir(source, opts); got != filepath.Join(source, "t") {
+		t.Errorf("relative: %q", got)
+	}
+	opts.TrashDir = ""
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	want := filepath.Join(source, trashDirName)
+	if runtime.GOOS == "linux" {
+		want = filepath.Join(data, "Trash")
+	}
+	if got := resolveTrashDir(source, opts); got != want {
+		t.Errorf("default: %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pendingFile 监视模式下等待打包的文件状态
+type pendingFile struct {
+	entry       os.DirEntry
+	size        int64
+	modTime     time.Time
+	firstSeen   time.Time // 第一次发现该文件的时间
+	stableSince time.Time // 大小和修改时间最近一次变化的时间
+	closed      bool      // 收到写入完成的通知，或启动时已存在，等待确认是否写完
+	written     bool      // 文件已写完：大小和修改时间保持不变 StableFor，且确认没有被写打开
+}
+
+// watchOptions 监视模式的时间设置
+type watchOptions struct {
+	Interval   time.Duration // 检查等待超时的间隔；不支持 inotify 的系统上也是扫描源目录的间隔
+	StableFor  time.Duration // 文件大小和修改时间保持不变多久后，再确认没有被写打开即视为写入完成
+	FlushAfter time.Duration // 文件等待多久后即使不满一批也打包
+}
+
+// 监视目录中文件变化的类型
+const (
+	eventWritten  = iota // 写入后关闭或移入目录，文件已完整
+	eventChanged         // 文件正在被写入
+	eventRemoved         // 删除或移出目录
+	eventOverflow        // 通知队列溢出，需要重新扫描目录
+)
+
+// dirEvent 监视目录中一个文件的变化
+type dirEvent struct {
+	Name string
+	Op   int
+}
+
+// filesOpenForWriting 返回 dir 中的文件 names 里正被某个进程以写方式打开的文件名。
+// 仅在 Linux 上通过 /proc 检查，其他系统只依靠文件大小和修改时间判断是否写入完成。
+// /proc 中的描述符指向解析过符号链接的绝对路径，因此先同样解析 names，dir 或其上级是链接时也能匹配
+func filesOpenForWriting(dir string, names []string) map[string]bool {
+	open := make(map[string]bool)
+	if runtime.GOOS != "linux" || len(names) == 0 {
+		return open
+	}
+	paths := make(map[string]string) // 解析后的路径 → 文件名
+	for _, name := range names {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if resolved, err = filepath.Abs(resolved); err == nil {
+			paths[resolved] = name
+		}
+	}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return open
+	}
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // 没有权限查看其他用户的进程
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || paths[target] == "" {
+				continue
+			}
+			// fdinfo 中的 flags 为八进制，低两位为访问模式：1 只写，2 读写
+			data, err := os.ReadFile(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name()))
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				if value, ok := strings.CutPrefix(line, "flags:"); ok {
+					flags, err := strconv.ParseInt(strings.TrimSpace(value), 8, 64)
+					if err == nil && flags&3 != 0 {
+						open[paths[target]] = true
+					}
+				}
+			}
+		}
+	}
+	return open
+}
+
+// watchAndCompress 持续监视源目录，文件写入完成后累计满一批或等待超时即打包，直到 ctx 被取消。
+// Linux 上收到 inotify 的写入完成通知后，文件保持不变 StableFor 且没有进程仍以写方式打开才视为写完；
+// 其他系统定时扫描并比较文件大小和修改时间
+func watchAndCompress(ctx context.Context, sourceDir string, opts packOptions, wopts watchOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	prefix = opts.Prefix
+	var state *archiveState
+	if opts.Incremental {
+		var err error
+		state, err = loadState(dirFS(sourceDir))
+		if err != nil {
+			return err
+		}
+	}
+	watcher, err := newDirWatcher(sourceDir)
+	if err != nil {
+		if !errors.Is(err, errors.ErrUnsupported) {
+			logger.Warn("watch notify unavailable", "dir", sourceDir, "err", err)
+		}
+		return pollAndCompress(ctx, sourceDir, opts, wopts, state)
+	}
+	defer watcher.Close()
+	pending := make(map[string]*pendingFile)
+	logger.Info("watch started", "dir", sourceDir, "mode", "inotify", "flush_after", wopts.FlushAfter)
+
+	// inspect 读取源目录中的文件 name，按打包规则过滤，增量打包时跳过已归档的内容
+	inspect := func(name string) (os.DirEntry, fs.FileInfo, bool, error) {
+		info, err := os.Lstat(filepath.Join(sourceDir, name))
+		if err != nil {
+			return nil, nil, false, nil // 已被移走或删除
+		}
+		entry, ok := packCandidate(dirFS(sourceDir), fs.FileInfoToDirEntry(info), opts)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		if state != nil {
+			remaining, err := state.skipArchived([]os.DirEntry{entry})
+			if err != nil || len(remaining) == 0 {
+				return nil, nil, false, err
+			}
+		}
+		if info, err = entry.Info(); err != nil {
+			return nil, nil, false, nil
+		}
+		return entry, info, true, nil
+	}
+
+	// scan 读取整个源目录，在启动时和通知队列溢出后使用。
+	// 已有的文件与收到写入完成通知的文件一样，等待确认写完
+	scan := func() error {
+		_, fileEntries, err := collectFiles(dirFS(sourceDir), opts)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			fileEntries, err = state.skipArchived(fileEntries)
+			if err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		seen := make(map[string]bool)
+		for _, entry := range fileEntries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			seen[entry.Name()] = true
+			p, ok := pending[entry.Name()]
+			if !ok {
+				p = &pendingFile{firstSeen: now}
+				pending[entry.Name()] = p
+			}
+			if p.written && p.size == info.Size() && p.modTime.Equal(info.ModTime()) {
+				continue
+			}
+			p.entry, p.size, p.modTime, p.stableSince, p.closed, p.written = entry, info.Size(), info.ModTime(), now, true, false
+		}
+		for name := range pending {
+			if !seen[name] {
+				delete(pending, name)
+			}
+		}
+		return nil
+	}
+
+	// handle 按通知更新等待中的文件。写入完成的通知只让文件开始等待确认，见 settle
+	handle := func(event dirEvent) error {
+		switch event.Op {
+		case eventOverflow:
+			logger.Warn("watch events overflowed", "dir", sourceDir)
+			return scan()
+		case eventRemoved:
+			delete(pending, event.Name)
+		case eventChanged:
+			if p, ok := pending[event.Name]; ok {
+				p.closed, p.written = false, false
+			}
+		case eventWritten:
+			entry, info, ok, err := inspect(event.Name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				delete(pending, event.Name)
+				return nil
+			}
+			now := time.Now()
+			p, ok := pending[event.Name]
+			if !ok {
+				p = &pendingFile{firstSeen: now}
+				pending[event.Name] = p
+			}
+			p.entry, p.size, p.modTime, p.stableSince, p.closed, p.written = entry, info.Size(), info.ModTime(), now, true, false
+			logger.Debug("watch file closed", "src", event.Name, "size", info.Size())
+		}
+		return nil
+	}
+
+	// settle 确认等待中的文件是否写完：收到写入完成的通知后大小和修改时间保持不变 StableFor，
+	// 且没有进程仍以写方式打开。仍被写打开的文件等待下一次写入完成的通知，关闭后又被改写的文件重新计时
+	settle := func() error {
+		now := time.Now()
+		var candidates []string
+		for name, p := range pending {
+			if !p.closed || p.written || now.Sub(p.stableSince) < wopts.StableFor {
+				continue
+			}
+			entry, info, ok, err := inspect(name)
+			if err != nil {
+				return err
+			}
+			switch {
+			case !ok:
+				delete(pending, name)
+			case info.Size() != p.size || !info.ModTime().Equal(p.modTime):
+				p.entry, p.size, p.modTime, p.stableSince = entry, info.Size(), info.ModTime(), now
+			default:
+				p.entry = entry
+				candidates = append(candidates, name)
+			}
+		}
+		writing := filesOpenForWriting(sourceDir, candidates)
+		for _, name := range candidates {
+			if writing[name] {
+				pending[name].closed = false
+				logger.Debug("watch file still open", "src", name)
+				continue
+			}
+			pending[name].written = true
+		}
+		return nil
+	}
+
+	if err := scan(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(wopts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := settle(); err != nil {
+			return err
+		}
+		var ready []os.DirEntry
+		for _, p := range pending {
+			if p.written {
+				ready = append(ready, p.entry)
+			}
+		}
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i].Name() < ready[j].Name()
+		})
+		if err := flushWatched(sourceDir, pending, ready, opts, state, wopts.FlushAfter); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("watch stopped", "dir", sourceDir, "pending", len(pending))
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return watcher.Err
+			}
+			if err := handle(event); err != nil {
+				return err
+			}
+			// 处理完已到达的通知后再判断是否打包
+			for len(watcher.Events) > 0 {
+				if event, ok = <-watcher.Events; !ok {
+					return watcher.Err
+				}
+				if err := handle(event); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollAndCompress 在不支持 inotify 时定时扫描源目录，文件大小和修改时间保持不变 StableFor 后视为写完
+func pollAndCompress(ctx context.Context, sourceDir string, opts packOptions, wopts watchOptions, state *archiveState) error {
+	pending := make(map[string]*pendingFile)
+	logger.Info("watch started", "dir", sourceDir, "mode", "poll", "interval", wopts.Interval, "stable", wopts.StableFor, "flush_after", wopts.FlushAfter)
+
+	ticker := time.NewTicker(wopts.Interval)
+	defer ticker.Stop()
+	for {
+		_, fileEntries, err := collectFiles(dirFS(sourceDir), opts)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			fileEntries, err = state.skipArchived(fileEntries)
+			if err != nil {
+				return err
+			}
+		}
+
+		// 更新等待中的文件状态，大小或修改时间有变化时重新计时
+		now := time.Now()
+		seen := make(map[string]bool)
+		for _, entry := range fileEntries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			seen[entry.Name()] = true
+			p, ok := pending[entry.Name()]
+			if !ok {
+				pending[entry.Name()] = &pendingFile{entry: entry, size: info.Size(), modTime: info.ModTime(), firstSeen: now, stableSince: now}
+				logger.Debug("watch new file", "src", entry.Name(), "size", info.Size())
+				continue
+			}
+			p.entry = entry
+			if p.size != info.Size() || !p.modTime.Equal(info.ModTime()) {
+				p.size, p.modTime, p.stableSince, p.written = info.Size(), info.ModTime(), now, false
+			}
+		}
+		for name := range pending {
+			if !seen[name] {
+				delete(pending, name)
+			}
+		}
+
+		// 找出已写入完成的文件。确认没有被写打开的文件在大小和修改时间变化前不再检查
+		var candidates []string
+		for name, p := range pending {
+			if !p.written && now.Sub(p.stableSince) >= wopts.StableFor {
+				candidates = append(candidates, name)
+			}
+		}
+		writing := filesOpenForWriting(sourceDir, candidates)
+		for _, name := range candidates {
+			pending[name].written = !writing[name]
+		}
+		var stable []os.DirEntry
+		for _, entry := range fileEntries {
+			if p := pending[entry.Name()]; p != nil && p.written {
+				stable = append(stable, entry)
+			}
+		}
+		if err := flushWatched(sourceDir, pending, stable, opts, state, wopts.FlushAfter); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("watch stopped", "dir", sourceDir, "pending", len(pending))
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// flushWatched 打包已写完的文件 ready：满一批时只打包完整的批次，
+// 最早的文件等待超过 flushAfter 后把剩余文件也打包。打包的文件从 pending 中移除
+func flushWatched(sourceDir string, pending map[string]*pendingFile, ready []os.DirEntry, opts packOptions, state *archiveState, flushAfter time.Duration) error {
+	now := time.Now()
+	var readyBytes int64
+	var oldest time.Time
+	for _, entry := range ready {
+		p := pending[entry.Name()]
+		readyBytes += p.size
+		if oldest.IsZero() || p.firstSeen.Before(oldest) {
+			oldest = p.firstSeen
+		}
+	}
+
+	batches := planBatches(ready, opts)
+	if len(batches) > 0 && !oldest.IsZero() && now.Sub(oldest) < flushAfter {
+		last := batches[len(batches)-1]
+		full := len(last) >= opts.MaxFiles
+		if opts.BatchBy == "size" {
+			var lastBytes int64
+			for _, entry := range last {
+				lastBytes += pending[entry.Name()].size
+			}
+			full = lastBytes >= opts.MaxBatchBytes
+		}
+		if !full {
+			batches = batches[:len(batches)-1]
+		}
+	}
+	if len(batches) == 0 {
+		return nil
+	}
+	maxZipNum, exists, err, _ := findMaxPrefixNumber(dirFS(sourceDir), ".", opts.Prefix)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		maxZipNum = 0
+	}
+	files := 0
+	for _, batch := range batches {
+		files += len(batch)
+		for _, entry := range batch {
+			delete(pending, entry.Name())
+		}
+	}
+	logger.Info("watch flush", "dir", sourceDir, "files", files, "batches", len(batches), "stable_bytes", readyBytes)
+	return compressBatches(dirFS(sourceDir), numberedJobs(opts.Prefix, maxZipNum, batches), opts, state)
+}
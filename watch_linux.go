@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// dirWatcher 通过 inotify 监视目录中的文件变化
+type dirWatcher struct {
+	file   *os.File
+	done   chan struct{}
+	Events chan dirEvent // 读取结束或出错时关闭，错误见 Err
+	Err    error
+}
+
+// newDirWatcher 开始监视 dir 根目录，不包括子文件夹
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MODIFY | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		syscall.Close(fd)
+		return nil, &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	// 非阻塞的描述符由运行时轮询，Close 可以中断正在进行的 Read
+	w := &dirWatcher{file: os.NewFile(uintptr(fd), "inotify"), done: make(chan struct{}), Events: make(chan dirEvent, 64)}
+	go w.read(dir)
+	return w, nil
+}
+
+func (w *dirWatcher) read(dir string) {
+	defer close(w.Events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.Err = err
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			name := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+nameLen]
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1] // 名称以 NUL 补齐
+			}
+			offset += syscall.SizeofInotifyEvent + nameLen
+
+			event := dirEvent{Name: string(name)}
+			switch {
+			case mask&syscall.IN_Q_OVERFLOW != 0:
+				event.Op = eventOverflow
+			case mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+				w.Err = &os.PathError{Op: "watch", Path: dir, Err: syscall.ENOENT}
+				return
+			case mask&syscall.IN_IGNORED != 0 || mask&syscall.IN_ISDIR != 0:
+				continue
+			case mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+				event.Op = eventWritten
+			case mask&syscall.IN_MODIFY != 0:
+				event.Op = eventChanged
+			case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				event.Op = eventRemoved
+			default:
+				continue
+			}
+			select {
+			case w.Events <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Close 停止监视，Events 随后关闭
+func (w *dirWatcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// dirWatcher 在不支持 inotify 的系统上不可用，监视模式改为定时扫描
+type dirWatcher struct {
+	Events chan dirEvent
+	Err    error
+}
+
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (w *dirWatcher) Close() error {
+	return nil
+}
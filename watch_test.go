@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestFilesOpenForWriting 通过符号链接访问源目录时也能识别正在写入的文件
+func TestFilesOpenForWriting(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only checked through /proc on Linux")
+	}
+	dir := t.TempDir()
+	realDir := filepath.Join(dir, "real")
+	if err := os.Mkdir(realDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("real", link); err != nil {
+		t.Fatal(err)
+	}
+	writing, err := os.Create(filepath.Join(realDir, "writing.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writing.Close()
+	if err := os.WriteFile(filepath.Join(realDir, "done.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reading, err := os.Open(filepath.Join(realDir, "done.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reading.Close()
+
+	for _, d := range []string{realDir, link} {
+		open := filesOpenForWriting(d, []string{"writing.txt", "done.txt", "missing.txt"})
+		if len(open) != 1 || !open["writing.txt"] {
+			t.Errorf("filesOpenForWriting(%s) = %v, want writing.txt only", d, open)
+		}
+	}
+}
@@ -1,8 +1,12 @@
+//go:build ignore
+
+// 旧版的交互式打包程序，与 zip_20240930.go 同属 main 包，不参与模块构建，需要时单独构建：go build zip.go
 package main
 
 import (
 	"archive/zip"
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -15,6 +19,129 @@ import (
 var prefix = "MarsGoExe_"     // 文件夹和压缩包的前缀
 var maxFilesPerFolder = 10    // 默认值
 var deleteSourceFiles = false // 是否删除源文件
+var symlinkPolicy = "follow"  // 符号链接的处理方式：follow 打包指向的文件，store 保存为链接，skip 跳过
+
+// locale 当前界面语言，"zh" 或 "en"
+var locale = "zh"
+
+// catalogs 消息目录：语言 -> 消息键 -> 文本（可包含 fmt 格式化占位符）
+var catalogs = map[string]map[string]string{
+	"zh": {
+		"banner.line":            "！！！======================================================================== ！！！",
+		"banner.warning":         "！！！输入框留空回车将使用程序默认值且无法回退只能关闭窗口重新进入，请谨慎操作 ！！！",
+		"prompt.prefix":          "请输入文件夹和压缩包的前缀（直接回车将使用默认值%s）: ",
+		"prompt.prefixExists":    "警告：已存在以该前缀命名的文件夹或压缩包。是否继续使用当前前缀并从最大编号%d后继续？(y/n): ",
+		"prompt.prefixRetry":     "请重新输入前缀。",
+		"prompt.maxFiles":        "请输入每个文件夹中的最大文件数（正整数，空行回车将使用默认值%d）: ",
+		"prompt.maxFilesDefault": "使用默认值%d作为每个文件夹中的最大文件数。",
+		"prompt.maxFilesConfirm": "确认使用每个文件夹中的最大文件数 %d 吗？(y/n): ",
+		"prompt.notConfirmed":    "未确认，请重新输入。",
+		"prompt.maxFilesInvalid": "输入错误：请输入一个有效的正整数或留空使用默认值。",
+		"prompt.maxFilesSet":     "每个文件夹中的最大文件数设置为：%d",
+		"prompt.deleteSource":    "压缩完成后是否需要删除源文件？(y/n，空行回车将默认为不删除源文件，如果删除源文件则无法恢复！！！): ",
+		"prompt.deleteConfirm":   "确认删除源文件吗？(y/n，如果删除源文件则无法恢复！！！): ",
+		"prompt.deleteRetry":     "未确认删除源文件，请重新选择。",
+		"prompt.yesNoInvalid":    "无效输入，请重新输入(y/n)。",
+		"summary.willDelete":     "压缩完成后将会删除源文件。",
+		"summary.willKeep":       "压缩完成后将不会删除源文件。",
+		"summary.done":           "文件组织、压缩和删除完成。",
+		"status.noFiles":         "源目录下没有文件。",
+		"status.compressFailed":  "压缩文件夹 %s 失败: %v",
+		"status.deleteFailed":    "删除文件夹 %s 失败: %v",
+		"status.deleted":         "已删除文件夹 %s",
+		"status.kept":            "未删除文件夹 %s",
+		"status.compressed":      "已压缩文件夹 %s",
+		"status.skipSpecial":     "跳过特殊文件 %s（套接字、管道或设备）",
+		"status.skipSymlink":     "跳过符号链接 %s",
+		"status.skipBrokenLink":  "跳过无法跟随的符号链接 %s: %v",
+		"error.readInput":        "读取输入时发生错误:",
+		"error.checkPrefix":      "检查前缀时发生错误:",
+		"error.process":          "处理文件时发生错误: %v",
+		"error.lang":             "不支持的语言 %q，可选 zh 或 en",
+		"flag.lang":              "界面语言：zh 或 en（默认根据 LC_ALL/LANG 环境变量选择）",
+		"flag.symlinks":          "符号链接：follow 打包指向的文件，store 保存为链接，skip 跳过",
+		"error.symlinks":         "不支持的符号链接处理方式 %q，可选 follow、store 或 skip",
+	},
+	"en": {
+		"banner.line":            "!!! ======================================================================== !!!",
+		"banner.warning":         "!!! An empty answer uses the default and cannot be undone; close the window to start over !!!",
+		"prompt.prefix":          "Enter the prefix for folders and archives (press Enter for the default %s): ",
+		"prompt.prefixExists":    "Warning: folders or archives with this prefix already exist. Keep this prefix and continue from number %d? (y/n): ",
+		"prompt.prefixRetry":     "Please enter the prefix again.",
+		"prompt.maxFiles":        "Enter the maximum number of files per folder (positive integer, press Enter for the default %d): ",
+		"prompt.maxFilesDefault": "Using the default of %d files per folder.",
+		"prompt.maxFilesConfirm": "Use a maximum of %d files per folder? (y/n): ",
+		"prompt.notConfirmed":    "Not confirmed, please enter it again.",
+		"prompt.maxFilesInvalid": "Invalid input: enter a positive integer or leave it empty for the default.",
+		"prompt.maxFilesSet":     "Maximum number of files per folder set to: %d",
+		"prompt.deleteSource":    "Delete the source files after compressing? (y/n, an empty answer keeps them; deleted files CANNOT be recovered!!!): ",
+		"prompt.deleteConfirm":   "Really delete the source files? (y/n, deleted files CANNOT be recovered!!!): ",
+		"prompt.deleteRetry":     "Deletion not confirmed, please choose again.",
+		"prompt.yesNoInvalid":    "Invalid input, please enter y or n.",
+		"summary.willDelete":     "The source files will be deleted after compressing.",
+		"summary.willKeep":       "The source files will be kept after compressing.",
+		"summary.done":           "Files organized, compressed and deleted.",
+		"status.noFiles":         "There are no files in the source directory.",
+		"status.compressFailed":  "Failed to compress folder %s: %v",
+		"status.deleteFailed":    "Failed to delete folder %s: %v",
+		"status.deleted":         "Deleted folder %s",
+		"status.kept":            "Kept folder %s",
+		"status.compressed":      "Compressed folder %s",
+		"status.skipSpecial":     "Skipped special file %s (socket, FIFO or device)",
+		"status.skipSymlink":     "Skipped symlink %s",
+		"status.skipBrokenLink":  "Skipped symlink %s that cannot be followed: %v",
+		"error.readInput":        "Error reading input:",
+		"error.checkPrefix":      "Error checking the prefix:",
+		"error.process":          "Error processing files: %v",
+		"error.lang":             "unsupported language %q, expected zh or en",
+		"flag.lang":              "interface language: zh or en (defaults to the LC_ALL/LANG environment variables)",
+		"flag.symlinks":          "symlinks: follow packs the target file, store keeps the link, skip leaves it out",
+		"error.symlinks":         "unsupported symlink policy %q, expected follow, store or skip",
+	},
+}
+
+// msg 返回当前语言下的消息文本，缺失时回退到中文
+func msg(key string, args ...interface{}) string {
+	text, ok := catalogs[locale][key]
+	if !ok {
+		text, ok = catalogs["zh"][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// parseLocale 将 zh_CN.UTF-8、en_US 等语言标识归一化为目录中的语言，无法识别时返回空字符串
+func parseLocale(value string) string {
+	value = strings.ToLower(value)
+	if i := strings.IndexAny(value, "_.-@"); i >= 0 {
+		value = value[:i]
+	}
+	switch value {
+	case "zh":
+		return "zh"
+	case "en", "c", "posix":
+		return "en"
+	}
+	return ""
+}
+
+// detectLocale 依次根据 LC_ALL 和 LANG 环境变量确定界面语言，默认使用中文
+func detectLocale() string {
+	for _, name := range []string{"LC_ALL", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if l := parseLocale(value); l != "" {
+				return l
+			}
+			break
+		}
+	}
+	return "zh"
+}
 
 func organizeFilesAndCompress(sourceDir string, prefixStr string, maxFilesPerFolder int, deleteSource bool) error {
 	prefix = prefixStr
@@ -26,17 +153,17 @@ func organizeFilesAndCompress(sourceDir string, prefixStr string, maxFilesPerFol
 		maxZipNum = 0 // 如果没有找到任何以该前缀命名的文件或文件夹，则最大编号为0
 	}
 
-	// 过滤出文件（忽略文件夹、.exe文件和.zip文件）
+	// 过滤出文件（忽略文件夹、.exe文件、.zip文件、特殊文件和按策略不打包的符号链接）
 	var fileEntries []os.DirEntry
 	for _, entry := range files {
-		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".exe") && !strings.HasSuffix(entry.Name(), ".zip") {
+		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".exe") && !strings.HasSuffix(entry.Name(), ".zip") && packable(sourceDir, entry) {
 			fileEntries = append(fileEntries, entry)
 		}
 	}
 
 	// 如果没有文件，则直接返回
 	if len(fileEntries) == 0 {
-		fmt.Println("源目录下没有文件。")
+		fmt.Println(msg("status.noFiles"))
 		return nil
 	}
 
@@ -63,10 +190,14 @@ func organizeFilesAndCompress(sourceDir string, prefixStr string, maxFilesPerFol
 		}
 
 		// 移动文件到新文件夹
+		batch := make(map[string]bool)
+		for _, file := range fileEntries[i:end] {
+			batch[file.Name()] = true
+		}
 		for _, file := range fileEntries[i:end] {
 			oldPath := filepath.Join(sourceDir, file.Name())
 			newPath := filepath.Join(folderPath, file.Name())
-			err = os.Rename(oldPath, newPath)
+			err = moveFile(oldPath, newPath, batch)
 			if err != nil {
 				return err
 			}
@@ -76,7 +207,7 @@ func organizeFilesAndCompress(sourceDir string, prefixStr string, maxFilesPerFol
 		zipFilePath := filepath.Join(sourceDir, fmt.Sprintf("%s.zip", folderName))
 		err = compressFolder(folderPath, zipFilePath)
 		if err != nil {
-			fmt.Printf("压缩文件夹 %s 失败: %v\n", folderPath, err)
+			fmt.Println(msg("status.compressFailed", folderPath, err))
 			continue // 跳过删除文件夹，因为压缩失败
 		}
 
@@ -85,22 +216,67 @@ func organizeFilesAndCompress(sourceDir string, prefixStr string, maxFilesPerFol
 		if deleteSource {
 			err = os.RemoveAll(folderPath)
 			if err != nil {
-				fmt.Printf("删除文件夹 %s 失败: %v\n", folderPath, err)
+				fmt.Println(msg("status.deleteFailed", folderPath, err))
 				// 注意：这里可以根据需要决定是否要返回错误或继续执行
 				// 如果选择继续执行，则不返回错误
 			}
-			fmt.Printf("已删除文件夹 %s\n", folderPath)
+			fmt.Println(msg("status.deleted", folderPath))
 		} else {
-			fmt.Printf("未删除文件夹 %s\n", folderPath)
+			fmt.Println(msg("status.kept", folderPath))
 		}
 
-		fmt.Printf("已压缩文件夹 %s\n", folderPath)
+		fmt.Println(msg("status.compressed", folderPath))
 		startFolderNum++
 	}
 
 	return nil
 }
 
+// packable 判断源目录中的条目能否打包：套接字、管道和设备等特殊文件跳过，符号链接按 symlinkPolicy 处理，
+// 跟随时指向目录的链接和文件夹一样忽略
+func packable(dir string, entry os.DirEntry) bool {
+	mode := entry.Type()
+	if mode&os.ModeSymlink != 0 {
+		switch symlinkPolicy {
+		case "skip":
+			fmt.Println(msg("status.skipSymlink", entry.Name()))
+			return false
+		case "store":
+			return true
+		}
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			fmt.Println(msg("status.skipBrokenLink", entry.Name(), err))
+			return false
+		}
+		if info.IsDir() {
+			return false
+		}
+		mode = info.Mode().Type()
+	}
+	if !mode.IsRegular() {
+		fmt.Println(msg("status.skipSpecial", entry.Name()))
+		return false
+	}
+	return true
+}
+
+// moveFile 移动文件。相对路径的符号链接指向同一批次以外的文件时，按新位置改写目标后再移动
+func moveFile(oldPath, newPath string, batch map[string]bool) error {
+	target, err := os.Readlink(oldPath)
+	if err != nil || filepath.IsAbs(target) || batch[filepath.Clean(target)] {
+		return os.Rename(oldPath, newPath)
+	}
+	rel, err := filepath.Rel(filepath.Dir(newPath), filepath.Join(filepath.Dir(oldPath), target))
+	if err != nil {
+		return os.Rename(oldPath, newPath)
+	}
+	if err := os.Symlink(rel, newPath); err != nil {
+		return err
+	}
+	return os.Remove(oldPath)
+}
+
 func compressFolder(folderPath, zipFilePath string) error {
 	zipFile, err := os.Create(zipFilePath)
 	if err != nil {
@@ -119,6 +295,32 @@ func compressFolder(folderPath, zipFilePath string) error {
 
 	for _, file := range files {
 		filePath := filepath.Join(folderPath, file.Name())
+
+		// 保存符号链接时，条目内容为链接目标，外部属性中带有符号链接的 Unix 权限位
+		if file.Type()&os.ModeSymlink != 0 && symlinkPolicy == "store" {
+			info, err := os.Lstat(filePath)
+			if err != nil {
+				return err
+			}
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = file.Name()
+			zf, err := w.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(zf, filepath.ToSlash(target)); err != nil {
+				return err
+			}
+			continue
+		}
+
 		f, err := os.Open(filePath)
 		if err != nil {
 			return err
@@ -174,22 +376,40 @@ func findMaxPrefixNumber(dir, prefix string) (int, bool, error, []os.DirEntry) {
 }
 
 func main() {
+	locale = detectLocale()
+	lang := flag.String("lang", "", msg("flag.lang"))
+	flag.StringVar(&symlinkPolicy, "symlinks", symlinkPolicy, msg("flag.symlinks"))
+	flag.Parse()
+	if *lang != "" {
+		locale = parseLocale(*lang)
+		if _, ok := catalogs[locale]; !ok {
+			fmt.Fprintln(os.Stderr, msg("error.lang", *lang))
+			os.Exit(2)
+		}
+	}
+	switch symlinkPolicy {
+	case "follow", "store", "skip":
+	default:
+		fmt.Fprintln(os.Stderr, msg("error.symlinks", symlinkPolicy))
+		os.Exit(2)
+	}
+
 	ex, err := os.Executable()
 	if err != nil {
 		panic(err)
 	}
 	exePath := filepath.Dir(ex)
 	sourceDirectory := exePath // 或者你可以指定其他目录
-	fmt.Println("！！！======================================================================== ！！！")
-	fmt.Println("！！！输入框留空回车将使用程序默认值且无法回退只能关闭窗口重新进入，请谨慎操作 ！！！")
-	fmt.Println("！！！======================================================================== ！！！")
+	fmt.Println(msg("banner.line"))
+	fmt.Println(msg("banner.warning"))
+	fmt.Println(msg("banner.line"))
 	var inputPrefix string
 	for {
-		fmt.Print("请输入文件夹和压缩包的前缀（直接回车将使用默认值MarsGoExe_）: ")
+		fmt.Print(msg("prompt.prefix", "MarsGoExe_"))
 		reader := bufio.NewReader(os.Stdin)
 		inputPrefix, err = reader.ReadString('\n')
 		if err != nil {
-			fmt.Println("读取输入时发生错误:", err)
+			fmt.Println(msg("error.readInput"), err)
 			return
 		}
 		inputPrefix = strings.TrimSpace(inputPrefix)
@@ -201,20 +421,20 @@ func main() {
 		// 检查前缀是否已存在，并找到最大编号
 		maxNum, exists, err, _ := findMaxPrefixNumber(sourceDirectory, inputPrefix)
 		if err != nil {
-			fmt.Println("检查前缀时发生错误:", err)
+			fmt.Println(msg("error.checkPrefix"), err)
 			return
 		}
 
 		if exists {
-			fmt.Printf("警告：已存在以该前缀命名的文件夹或压缩包。是否继续使用当前前缀并从最大编号%d后继续？(y/n): ", maxNum+1)
+			fmt.Print(msg("prompt.prefixExists", maxNum+1))
 			confirm, err := reader.ReadString('\n')
 			if err != nil {
-				fmt.Println("读取输入时发生错误:", err)
+				fmt.Println(msg("error.readInput"), err)
 				return
 			}
 			confirm = strings.TrimSpace(confirm)
 			if strings.ToLower(confirm) != "y" {
-				fmt.Println("请重新输入前缀。")
+				fmt.Println(msg("prompt.prefixRetry"))
 				continue
 			}
 		}
@@ -223,13 +443,13 @@ func main() {
 
 	for {
 		// 提示用户输入
-		fmt.Print("请输入每个文件夹中的最大文件数（正整数，空行回车将使用默认值10）: ")
+		fmt.Print(msg("prompt.maxFiles", 10))
 
 		// 使用bufio读取一行输入
 		reader := bufio.NewReader(os.Stdin)
 		inputmax, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Println("读取输入时发生错误:", err)
+			fmt.Println(msg("error.readInput"), err)
 			return
 		}
 
@@ -238,7 +458,7 @@ func main() {
 
 		// 检查输入是否为空
 		if inputmax == "" {
-			fmt.Println("使用默认值10作为每个文件夹中的最大文件数。")
+			fmt.Println(msg("prompt.maxFilesDefault", 10))
 			maxFilesPerFolder = 10 // 直接设置默认值并跳出循环
 			break
 		}
@@ -246,10 +466,10 @@ func main() {
 		// 尝试将输入转换为整数
 		if num, err := strconv.Atoi(inputmax); err == nil && num > 0 {
 			// 如果转换成功且是正整数，询问用户是否确认
-			fmt.Printf("确认使用每个文件夹中的最大文件数 %d 吗？(y/n): ", num)
+			fmt.Print(msg("prompt.maxFilesConfirm", num))
 			confirm, err := reader.ReadString('\n')
 			if err != nil {
-				fmt.Println("读取输入时发生错误:", err)
+				fmt.Println(msg("error.readInput"), err)
 				return
 			}
 			confirm = strings.TrimSpace(confirm)
@@ -259,33 +479,33 @@ func main() {
 				break
 			} else {
 				// 如果用户未确认，则不更新maxFilesPerFolder，提示重新输入
-				fmt.Println("未确认，请重新输入。")
+				fmt.Println(msg("prompt.notConfirmed"))
 			}
 		} else {
 			// 转换失败或不是正整数，提示重新输入
-			fmt.Println("输入错误：请输入一个有效的正整数或留空使用默认值。")
+			fmt.Println(msg("prompt.maxFilesInvalid"))
 		}
 	}
 
 	// 使用maxFilesPerFolder
-	fmt.Printf("每个文件夹中的最大文件数设置为：%d\n", maxFilesPerFolder)
+	fmt.Println(msg("prompt.maxFilesSet", maxFilesPerFolder))
 
 	// 询问用户是否需要删除源文件
 	for {
-		fmt.Print("压缩完成后是否需要删除源文件？(y/n，空行回车将默认为不删除源文件，如果删除源文件则无法恢复！！！): ")
+		fmt.Print(msg("prompt.deleteSource"))
 		reader := bufio.NewReader(os.Stdin)
 		inputDelete, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Println("读取输入时发生错误:", err)
+			fmt.Println(msg("error.readInput"), err)
 			return
 		}
 		inputDelete = strings.TrimSpace(inputDelete)
 
 		if strings.ToLower(inputDelete) == "y" {
-			fmt.Printf("确认删除源文件吗？(y/n，如果删除源文件则无法恢复！！！): ")
+			fmt.Print(msg("prompt.deleteConfirm"))
 			confirmDelete, err := reader.ReadString('\n')
 			if err != nil {
-				fmt.Println("读取输入时发生错误:", err)
+				fmt.Println(msg("error.readInput"), err)
 				return
 			}
 			confirmDelete = strings.TrimSpace(confirmDelete)
@@ -294,31 +514,30 @@ func main() {
 				deleteSourceFiles = true
 				break
 			} else {
-				fmt.Println("未确认删除源文件，请重新选择。")
+				fmt.Println(msg("prompt.deleteRetry"))
 				continue // 回到询问是否删除源文件的循环开始
 			}
 		} else if strings.ToLower(inputDelete) == "n" || inputDelete == "" {
 			deleteSourceFiles = false
 			break
 		} else {
-			fmt.Println("无效输入，请重新输入(y/n)。")
+			fmt.Println(msg("prompt.yesNoInvalid"))
 		}
 	}
 
 	// 使用maxFilesPerFolder和deleteSourceFiles
-	fmt.Printf("压缩完成后将%s删除源文件。\n", func() string {
-		if deleteSourceFiles {
-			return "会"
-		}
-		return "不会"
-	}())
+	if deleteSourceFiles {
+		fmt.Println(msg("summary.willDelete"))
+	} else {
+		fmt.Println(msg("summary.willKeep"))
+	}
 
 	err = organizeFilesAndCompress(sourceDirectory, inputPrefix, maxFilesPerFolder, deleteSourceFiles)
 	if err != nil {
-		fmt.Printf("处理文件时发生错误: %v\n", err)
+		fmt.Println(msg("error.process", err))
 		return
 	}
-	fmt.Println("文件组织、压缩和删除完成。")
+	fmt.Println(msg("summary.done"))
 }
 
 //   for /d %%X in (*) do "D:\7zip\7z.exe" a "%%X.7z" "%%X\"  保存为BAT,放在需要压缩文件夹的目录,请不要使用管理员权限运行该批处理文件,否则会把文件压缩到windows/system32目录下.
@@ -3,13 +3,22 @@ package main
 import (
 	"archive/zip"
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var prefix = "MarsGoExe_"      // 文件夹和压缩包的前缀
@@ -18,511 +27,1809 @@ var deleteSourceFiles = false  // 是否删除源文件
 var sourceDirectory string     // 源目录
 var deleteEmptyFolders = false // 是否删除已提取的空文件夹
 
-// compressFolder 压缩指定文件夹为 zip 文件
-func compressFolder(folderPath, zipFilePath string) error {
-	zipFile, err := os.Create(zipFilePath)
-	if err != nil {
-		return err
+// formatBytes 将字节数格式化为易读的形式
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration 将时长格式化为 hh:mm:ss
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, d/time.Second)
+}
+
+// maxSymlinkDepth 跟随指向目录的链接时，一条路径上最多经过的链接数。
+// 无法判断两个目录是否相同的文件系统上，以此保证遍历结束
+const maxSymlinkDepth = 16
+
+// compressFolder 压缩 fsys 中的文件夹 folder，把 zip 内容写到 w，跳过 skip 中的文件名，report 不为 nil 时上报进度。
+// 条目名按 opts.NameEncoding 编码，符号链接按 opts.Symlinks 处理。跟随指向目录的链接时，
+// 只有链接指向当前路径上的某个上级目录才构成循环而跳过，指向已写入的同级目录的链接照常写入
+func compressFolder(w io.Writer, fsys fs.FS, folder string, skip map[string]bool, opts packOptions, report func(progressEvent)) error {
+	zipWriter := zip.NewWriter(w)
+	// ancestors 当前路径上的目录，进入目录时压入，离开时弹出
+	type ancestor struct {
+		info     fs.FileInfo
+		realPath string // 在 fsys 中解析链接后的路径，无法解析时为空
+	}
+	var ancestors []ancestor
+	isAncestor := func(info fs.FileInfo, realPath string) bool {
+		for _, dir := range ancestors {
+			if os.SameFile(dir.info, info) || (realPath != "" && dir.realPath == realPath) {
+				return true
+			}
+		}
+		return false
 	}
-	defer zipFile.Close()
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
 
-	err = filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+	var walk func(name string, links int) error
+	walk = func(name string, links int) error {
+		info, err := fs.Stat(fsys, name)
 		if err != nil {
 			return err
 		}
+		realPath, _ := fsRealPath(fsys, name)
+		ancestors = append(ancestors, ancestor{info: info, realPath: realPath})
+		defer func() { ancestors = ancestors[:len(ancestors)-1] }()
+
 		header, err := zip.FileInfoHeader(info)
 		if err != nil {
 			return err
 		}
 		// 修改这里的路径处理，使其直接包含文件，不包含多层目录
-		header.Name = filepath.Base(path)
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate
+		setZipEntryName(header, path.Base(name)+"/", opts.NameEncoding)
+		if _, err := zipWriter.CreateHeader(header); err != nil {
+			return err
 		}
-		writer, err := zipWriter.CreateHeader(header)
+
+		entries, err := fs.ReadDir(fsys, name)
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return err
+		for _, d := range entries {
+			child := path.Join(name, d.Name())
+			if d.IsDir() {
+				if err := walk(child, links); err != nil {
+					return err
+				}
+				continue
 			}
-			defer file.Close()
-			_, err = io.Copy(writer, file)
-			if err != nil {
-				return err
+			if skip[d.Name()] {
+				continue
 			}
-		}
-		return nil
-	})
-
-	return err
-}
-
-// findMaxPrefixNumber 查找具有给定前缀的最大编号
-func findMaxPrefixNumber(sourceDir, prefix string) (int, bool, error, []os.DirEntry) {
-	var maxNum int
-	exists := false
-	files, err := os.ReadDir(sourceDir)
-	if err != nil {
-		return 0, false, err, nil
-	}
-	for _, file := range files {
-		name := file.Name()
-		if file.IsDir() && strings.HasPrefix(name, prefix) {
-			numStr := strings.TrimPrefix(name, prefix)
-			if num, err := strconv.Atoi(numStr); err == nil {
-				if num > maxNum {
-					maxNum = num
-					exists = true
+			if d.Type()&fs.ModeSymlink != 0 && opts.Symlinks == "follow" {
+				if target, err := fs.Stat(fsys, child); err == nil && target.IsDir() {
+					realPath, _ := fsRealPath(fsys, child)
+					switch {
+					case isAncestor(target, realPath):
+						logger.Warn("skip file", "src", fsPath(fsys, child), "reason", "symlink loop")
+					case links >= maxSymlinkDepth:
+						logger.Warn("skip file", "src", fsPath(fsys, child), "reason", "symlink depth", "limit", maxSymlinkDepth)
+					default:
+						if err := walk(child, links+1); err != nil {
+							return err
+						}
+					}
+					continue
 				}
 			}
-		} else if !file.IsDir() && strings.HasSuffix(name, ".zip") && strings.HasPrefix(strings.TrimSuffix(name, filepath.Ext(name)), prefix) {
-			numStr := strings.TrimPrefix(strings.TrimSuffix(name, filepath.Ext(name)), prefix)
-			if num, err := strconv.Atoi(numStr); err == nil {
-				if num > maxNum {
-					maxNum = num
-					exists = true
-				}
+			if err := addZipEntry(zipWriter, fsys, child, d.Name(), opts, report); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
-	return maxNum, exists, nil, files
-}
-
-// organizeFilesAndCompress 组织文件并压缩
-func organizeFilesAndCompress(sourceDir, prefixStr string, maxFilesPerFolder int, deleteSource bool) (int, error) {
-	prefix = prefixStr
-	maxZipNum, exists, err, files := findMaxPrefixNumber(sourceDir, prefix)
-	if err != nil {
-		return 0, err
-	}
-	if !exists {
-		maxZipNum = 0 // 如果没有找到任何以该前缀命名的文件或文件夹，则最大编号为0
-	}
-
-	// 过滤出文件（忽略文件夹、.exe文件和.zip文件）
-	var fileEntries []os.DirEntry
-	for _, entry := range files {
-		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".exe") && !strings.HasSuffix(entry.Name(), ".zip") {
-			fileEntries = append(fileEntries, entry)
-		}
-	}
-
-	// 如果没有文件，则直接返回
-	if len(fileEntries) == 0 {
-		fmt.Println("源目录下没有文件。")
-		return 0, nil
+	if err := walk(folder, 0); err != nil {
+		return err
 	}
+	return zipWriter.Close()
+}
 
-	// 排序文件
-	sort.Slice(fileEntries, func(i, j int) bool {
-		return fileEntries[i].Name() < fileEntries[j].Name()
-	})
-
-	// 处理文件，每maxFilesPerFolder个放入一个文件夹并压缩
-	startFolderNum := maxZipNum + 1
-	finalFolderNum := startFolderNum
-	for i := 0; i < len(fileEntries); i += maxFilesPerFolder {
-		end := i + maxFilesPerFolder
-		if end > len(fileEntries) {
-			end = len(fileEntries)
-		}
-		folderName := fmt.Sprintf("%s%d", prefix, startFolderNum)
-		folderPath := filepath.Join(sourceDir, folderName)
-
-		// 创建文件夹
-		err = os.MkdirAll(folderPath, 0777)
-		if err != nil && !os.IsExist(err) {
-			return 0, err
-		}
-
-		// 移动文件到新文件夹
-		for _, file := range fileEntries[i:end] {
-			oldPath := filepath.Join(sourceDir, file.Name())
-			newPath := filepath.Join(folderPath, file.Name())
-			err = os.Rename(oldPath, newPath)
-			if err != nil {
-				return 0, err
+// fsRealPath 返回 fsys 中 name 逐级解析符号链接后的路径。链接为绝对路径、解析到 fsys 之外、
+// 文件系统不支持读取链接或链接过多时返回 false
+func fsRealPath(fsys fs.FS, name string) (string, bool) {
+	resolved := "."
+	rest := strings.Split(name, "/")
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return "", false
 			}
-			fmt.Printf("移动文件: %s -> %s\n", oldPath, newPath)
+			resolved = path.Dir(resolved)
+			continue
 		}
-
-		// 压缩文件夹
-		zipFilePath := filepath.Join(sourceDir, fmt.Sprintf("%s.zip", folderName))
-		err = compressFolder(folderPath, zipFilePath)
+		next := path.Join(resolved, elem)
+		info, err := fs.Lstat(fsys, next)
 		if err != nil {
-			fmt.Printf("压缩文件夹 %s 失败: %v\n", folderPath, err)
-			continue // 跳过删除文件夹，因为压缩失败
+			return "", false
 		}
-
-		// 删除文件夹
-		// 根据用户选择是否删除源文件
-		if deleteSource {
-			err = os.RemoveAll(folderPath)
-			if err != nil {
-				fmt.Printf("删除文件夹 %s 失败: %v\n", folderPath, err)
-			} else {
-				fmt.Printf("已删除文件夹 %s\n", folderPath)
-			}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
 		}
-
-		startFolderNum++
-		finalFolderNum = startFolderNum - 1
+		if links++; links > 40 {
+			return "", false
+		}
+		target, err := fs.ReadLink(fsys, next)
+		if err != nil || path.IsAbs(target) || filepath.IsAbs(filepath.FromSlash(target)) {
+			return "", false
+		}
+		rest = append(strings.Split(strings.ReplaceAll(target, `\`, "/"), "/"), rest...) // 相对于链接所在的目录
 	}
-
-	return finalFolderNum, nil
+	return resolved, true
 }
 
-// organizeFilesOnly 组织文件但不压缩
-func organizeFilesOnly(sourceDir, prefixStr string, maxFilesPerFolder int) (int, error) {
-	prefix = prefixStr
-	maxZipNum, exists, err, files := findMaxPrefixNumber(sourceDir, prefix)
+// packableFile 按符号链接策略 policy 检查 fsys 中的 name 能否作为文件打包，返回打包时使用的文件信息：
+// store 时为链接本身，follow 时为指向的文件。套接字、管道、设备、失效的链接和指向目录的链接跳过并记录警告
+func packableFile(fsys fs.FS, name, policy string) (fs.FileInfo, bool) {
+	info, err := fs.Lstat(fsys, name)
 	if err != nil {
-		return 0, err
-	}
-	if !exists {
-		maxZipNum = 0 // 如果没有找到任何以该前缀命名的文件或文件夹，则最大编号为0
-	}
-
-	// 过滤出文件（忽略文件夹、.exe文件和.zip文件）
-	var fileEntries []os.DirEntry
-	for _, entry := range files {
-		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".exe") && !strings.HasSuffix(entry.Name(), ".zip") {
-			fileEntries = append(fileEntries, entry)
-		}
-	}
-
-	// 如果没有文件，则直接返回
-	if len(fileEntries) == 0 {
-		fmt.Println("源目录下没有文件。")
-		return 0, nil
+		logger.Warn("skip file", "src", fsPath(fsys, name), "err", err)
+		return nil, false
 	}
-
-	// 排序文件
-	sort.Slice(fileEntries, func(i, j int) bool {
-		return fileEntries[i].Name() < fileEntries[j].Name()
-	})
-
-	// 处理文件，每maxFilesPerFolder个放入一个文件夹
-	startFolderNum := maxZipNum + 1
-	finalFolderNum := startFolderNum
-	for i := 0; i < len(fileEntries); i += maxFilesPerFolder {
-		end := i + maxFilesPerFolder
-		if end > len(fileEntries) {
-			end = len(fileEntries)
+	if info.Mode()&fs.ModeSymlink != 0 {
+		switch policy {
+		case "skip":
+			logger.Info("skip file", "src", fsPath(fsys, name), "reason", "symlink")
+			return nil, false
+		case "store":
+			return info, true
 		}
-		folderName := fmt.Sprintf("%s%d", prefix, startFolderNum)
-		folderPath := filepath.Join(sourceDir, folderName)
-
-		// 创建文件夹
-		err = os.MkdirAll(folderPath, 0777)
-		if err != nil && !os.IsExist(err) {
-			return 0, err
+		info, err = fs.Stat(fsys, name)
+		if err != nil {
+			logger.Warn("skip file", "src", fsPath(fsys, name), "reason", "broken symlink", "err", err)
+			return nil, false
 		}
-
-		// 移动文件到新文件夹
-		for _, file := range fileEntries[i:end] {
-			oldPath := filepath.Join(sourceDir, file.Name())
-			newPath := filepath.Join(folderPath, file.Name())
-			err = os.Rename(oldPath, newPath)
-			if err != nil {
-				return 0, err
-			}
-			fmt.Printf("移动文件: %s -> %s\n", oldPath, newPath)
+		if info.IsDir() {
+			logger.Warn("skip file", "src", fsPath(fsys, name), "reason", "symlink to directory")
+			return nil, false
 		}
-
-		startFolderNum++
-		finalFolderNum = startFolderNum - 1
 	}
-
-	return finalFolderNum, nil
+	if !info.Mode().IsRegular() {
+		logger.Warn("skip file", "src", fsPath(fsys, name), "reason", "not a regular file", "type", info.Mode().Type().String())
+		return nil, false
+	}
+	return info, true
 }
 
-// getUserInput 获取用户输入
-func getUserInput(reader *bufio.Reader, prompt, defaultValue string) (string, error) {
-	fmt.Print(prompt)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return "", err
+// addZipEntry 把 fsys 中的文件 name 写入压缩包，条目名为 entryName。保存符号链接时条目内容为链接目标，
+// 外部属性中带有符号链接的 Unix 权限位；跟随时写入指向的文件；无法打包的文件跳过
+func addZipEntry(zipWriter *zip.Writer, fsys fs.FS, name, entryName string, opts packOptions, report func(progressEvent)) error {
+	info, ok := packableFile(fsys, name, opts.Symlinks)
+	if !ok {
+		return nil
 	}
-	input = strings.TrimSpace(input)
-	if input == "" {
-		input = defaultValue
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := fs.ReadLink(fsys, name)
+		if err != nil {
+			return err
+		}
+		return addZipFile(zipWriter, strings.NewReader(target), entryName, opts.NameEncoding, info, report)
 	}
-	return input, nil
-}
-
-// extractFromFolder 从文件夹中提取文件
-func extractFromFolder(folderPath, destinationPath string) error {
-	files, err := os.ReadDir(folderPath)
+	file, err := fsys.Open(name)
 	if err != nil {
 		return err
 	}
-	for _, file := range files {
-		oldPath := filepath.Join(folderPath, file.Name())
-		newPath := filepath.Join(destinationPath, file.Name())
-		if file.IsDir() {
-			err = os.MkdirAll(newPath, 0777)
-			if err != nil {
-				return err
-			}
-			err = extractFromFolder(oldPath, newPath)
-			if err != nil {
-				return err
-			}
-		} else {
-			err = os.Rename(oldPath, newPath)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("移动文件: %s -> %s\n", oldPath, newPath)
-		}
-	}
-	return nil
+	defer file.Close()
+	return addZipFile(zipWriter, file, entryName, opts.NameEncoding, info, report)
 }
 
-// removeEmptyFolders 删除空文件夹
-func removeEmptyFolders(folderPath, prefix string) error {
-	files, err := os.ReadDir(folderPath)
+// addZipFile 以 Deflate 方式把文件内容 src 写入压缩包，条目名为 name 并按 encoding 编码，report 不为 nil 时上报进度
+func addZipFile(zipWriter *zip.Writer, src io.Reader, name, encoding string, info fs.FileInfo, report func(progressEvent)) error {
+	header, err := zip.FileInfoHeader(info)
 	if err != nil {
 		return err
 	}
-	if len(files) == 0 {
-		return os.Remove(folderPath)
+	setZipEntryName(header, name, encoding)
+	header.Method = zip.Deflate
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
 	}
-	for _, file := range files {
-		if file.IsDir() {
-			subFolderPath := filepath.Join(folderPath, file.Name())
-			err := removeEmptyFolders(subFolderPath, prefix)
-			if err != nil {
-				return err
-			}
-		}
+	if report != nil {
+		writer = &progressWriter{w: writer, report: func(n int64) {
+			report(progressEvent{Type: progressBytesWritten, Bytes: n})
+		}}
+	}
+	_, err = io.Copy(writer, src)
+	if err != nil {
+		return err
 	}
-	files, _ = os.ReadDir(folderPath)
-	if len(files) == 0 {
-		return os.Remove(folderPath)
+	if report != nil {
+		report(progressEvent{Type: progressFileAdded, File: name})
 	}
 	return nil
 }
 
-// extractFromZip 从压缩包中提取文件
-func extractFromZip(zipFilePath, destinationPath string) error {
-	reader, err := zip.OpenReader(zipFilePath)
+// verifyZip 读取 fsys 中压缩包 name 的所有条目以校验 CRC32，并检查文件条目数量
+func verifyZip(fsys fs.FS, name string, wantFiles int) error {
+	reader, closer, err := openZipFS(fsys, name)
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
+	defer closer.Close()
 
+	files := 0
 	for _, file := range reader.File {
-		filePath := filepath.Join(destinationPath, file.Name)
 		if file.FileInfo().IsDir() {
-			os.MkdirAll(filePath, os.ModePerm)
 			continue
 		}
-
-		fileReader, err := file.Open()
-		if err != nil {
-			return err
-		}
-		defer fileReader.Close()
-
-		targetFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+		rc, err := file.Open()
 		if err != nil {
 			return err
 		}
-		defer targetFile.Close()
-
-		_, err = io.Copy(targetFile, fileReader)
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
 		if err != nil {
-			return err
+			return fmt.Errorf("%s: %w", file.Name, err)
 		}
+		files++
+	}
+	if files != wantFiles {
+		return errors.New(msg("error.zipFileCount", files, wantFiles))
 	}
-
 	return nil
 }
 
-// findNextAvailableFolder 查找下一个可用的同名文件夹
-func findNextAvailableFolder(baseFolder string) (string, error) {
-	baseName := filepath.Base(baseFolder)
-	dir := filepath.Dir(baseFolder)
-	num := 1
-	for {
-		folderPath := filepath.Join(dir, fmt.Sprintf("%s_%d", baseName, num))
-		_, err := os.Stat(folderPath)
-		if os.IsNotExist(err) {
-			return folderPath, nil
-		}
-		num++
-	}
+// manifestSuffix 清单文件相对于压缩包路径的后缀
+const manifestSuffix = ".manifest.json"
+
+// archiveManifest 压缩包的清单，与压缩包放在同一目录，记录打包时每个条目的大小和 CRC32
+type archiveManifest struct {
+	Archive string          `json:"archive"`
+	Created time.Time       `json:"created"`
+	Entries []manifestEntry `json:"entries"`
 }
 
-// getDestinationFolder 确定解压目标文件夹
-func getDestinationFolder(sourceDir, baseFolder string) (string, error) {
-	destinationPath := filepath.Join(sourceDir, baseFolder)
-	// 检查是否存在同名文件夹
-	_, err := os.Stat(destinationPath)
-	if os.IsNotExist(err) {
-		// 文件夹不存在，创建它
-		err = os.MkdirAll(destinationPath, 0777)
-		if err != nil {
-			return "", err
-		}
-		return destinationPath, nil
+// manifestEntry 清单中的一个条目
+type manifestEntry struct {
+	Name    string `json:"name"`
+	Size    uint64 `json:"size"`
+	CRC32   uint32 `json:"crc32"`
+	AliasOf string `json:"aliasOf,omitempty"` // 去重时未写入压缩包的重复文件，内容与该条目相同
+}
+
+// isArchiveSidecar 判断文件名是否为程序为压缩包生成的附属文件（清单、校验和）
+func isArchiveSidecar(name string) bool {
+	if _, ok := checksumFileAlgorithm(name); ok {
+		return true
 	}
+	return strings.HasSuffix(name, manifestSuffix) || strings.HasSuffix(name, uploadStateSuffix)
+}
 
-	// 存在同名文件夹，检查是否为空
-	entries, _ := os.ReadDir(destinationPath)
-	if len(entries) == 0 {
-		// 文件夹为空，直接使用
-		return destinationPath, nil
+// writeManifest 根据 fsys 中压缩包 name 的中央目录生成清单文件，aliases 中的重复文件按其保留副本记录
+func writeManifest(fsys writableFS, name string, aliases map[string]string) error {
+	reader, closer, err := openZipFS(fsys, name)
+	if err != nil {
+		return err
 	}
+	defer closer.Close()
 
-	// 文件夹不为空，查找下一个可用的同名文件夹
-	maxNum, _, _, _ := findMaxPrefixNumber(sourceDir, baseFolder+"_")
-	nextNum := maxNum + 1
-	destinationPath = filepath.Join(sourceDir, fmt.Sprintf("%s_%d", baseFolder, nextNum))
-	err = os.MkdirAll(destinationPath, 0777)
+	manifest := archiveManifest{Archive: path.Base(name), Created: time.Now()}
+	byName := make(map[string]manifestEntry)
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entry := manifestEntry{Name: file.Name, Size: file.UncompressedSize64, CRC32: file.CRC32}
+		byName[file.Name] = entry
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	var names []string
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	for _, alias := range names {
+		original, ok := byName[aliases[alias]]
+		if !ok {
+			return fmt.Errorf("%s: %s", alias, msg("test.missingEntry"))
+		}
+		manifest.Entries = append(manifest.Entries, manifestEntry{Name: alias, Size: original.Size, CRC32: original.CRC32, AliasOf: original.Name})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return "", err
+		return err
 	}
-	return destinationPath, nil
+	return writeFile(fsys, name+manifestSuffix, data, 0666)
 }
 
-// extractFromZips 从压缩包中提取文件
-func extractFromZips(sourceDir, prefix string, onlyWithPrefix bool) error {
-	files, err := os.ReadDir(sourceDir)
+// readManifest 读取 fsys 中压缩包 name 的清单文件，清单不存在时返回 nil
+func readManifest(fsys fs.FS, name string) (*archiveManifest, error) {
+	data, err := fs.ReadFile(fsys, name+manifestSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var manifest archiveManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
 	}
+	return &manifest, nil
+}
 
+// findMaxPrefixNumber 查找 fsys 的 dir 目录中具有给定前缀的最大编号
+func findMaxPrefixNumber(fsys fs.FS, dir, prefix string) (int, bool, error, []fs.DirEntry) {
+	var maxNum int
+	exists := false
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return 0, false, err, nil
+	}
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".zip") && (!onlyWithPrefix || strings.HasPrefix(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())), prefix)) {
-			zipFilePath := filepath.Join(sourceDir, file.Name())
-			fmt.Printf("正在处理压缩包: %s\n", zipFilePath)
-
-			// 确定解压目标路径
-			baseFolder := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
-			destinationPath, err := getDestinationFolder(sourceDir, baseFolder)
-			if err != nil {
-				return err
+		name := file.Name()
+		if file.IsDir() && strings.HasPrefix(name, prefix) {
+			numStr := strings.TrimPrefix(name, prefix)
+			if num, err := strconv.Atoi(numStr); err == nil {
+				if num > maxNum {
+					maxNum = num
+					exists = true
+				}
 			}
-
-			// 解压文件
-			err = extractFromZip(zipFilePath, destinationPath)
-			if err != nil {
-				fmt.Printf("从压缩包 %s 提取文件时发生错误: %v\n", zipFilePath, err)
-			} else {
-				fmt.Printf("从压缩包 %s 提取文件完成。\n", zipFilePath)
+		} else if !file.IsDir() && strings.HasSuffix(name, ".zip") && strings.HasPrefix(strings.TrimSuffix(name, path.Ext(name)), prefix) {
+			numStr := strings.TrimPrefix(strings.TrimSuffix(name, path.Ext(name)), prefix)
+			if num, err := strconv.Atoi(numStr); err == nil {
+				if num > maxNum {
+					maxNum = num
+					exists = true
+				}
 			}
 		}
 	}
-	return nil
+	return maxNum, exists, nil, files
 }
 
-func main() {
-	reader := bufio.NewReader(os.Stdin)
-	ex, err := os.Executable()
-	if err != nil {
-		panic(err)
-	}
-	sourceDirectory = filepath.Dir(ex) // 或者你可以指定其他目录
-
-	// 程序开始提示
-	fmt.Println("！！！======================================================================== ！！！")
-	fmt.Println("！！！输入框留空回车将使用程序默认值且无法回退只能关闭窗口重新进入，请谨慎操作 ！！！")
-	fmt.Println("！！！======================================================================== ！！！")
-
-	// 输入文件前缀
-	inputPrefix, _ := getUserInput(reader, "请输入文件夹和压缩包的前缀（直接回车将使用默认值MarsGoExe_）: ", "MarsGoExe_")
-	prefix = inputPrefix
+// packOptions 打包设置，来自配置文件中的配置方案、命令行参数或交互输入
+type packOptions struct {
+	Prefix            string          // 文件夹和压缩包的前缀
+	MaxFiles          int             // 按文件数分批时，每批的最大文件数
+	BatchBy           string          // 分批方式：count 按文件数，size 按总大小
+	MaxBatchBytes     int64           // 按大小分批时，每批的最大总字节数
+	Format            string          // 压缩包格式，目前仅支持 zip
+	Include           []string        // 只处理文件名匹配这些通配符的文件，为空时处理全部
+	Exclude           []string        // 跳过文件名匹配这些通配符的文件
+	Hidden            string          // 以 . 开头的隐藏文件：skip 跳过，include 打包
+	Junk              string          // 匹配 JunkPatterns 的系统和临时文件：skip 跳过，include 打包
+	JunkPatterns      []string        // 系统和临时文件的通配符，匹配文件名时不区分大小写
+	DeletePolicy      string          // 压缩后如何处理源文件：keep 保留，delete 删除，trash 移入回收站
+	OnlyWithPrefix    *bool           // 提取时是否只处理带前缀的文件夹或压缩包，nil 时使用各操作的默认值
+	Manifest          bool            // 是否为每个压缩包生成清单文件
+	TopUp             bool            // 先把新文件追加到最后一个未满的压缩包，再新建批次
+	Incremental       bool            // 增量模式：跳过状态文件中记录为已打包过的文件
+	Dedup             string          // 内容重复的文件：off 不检查，skip 留在源目录，alias 只打包一份并在清单中记录，separate 放入单独的 dupes 批次
+	Checksums         string          // 校验和文件：none 不生成，sidecar 每个压缩包一个附属文件，sums 输出目录中的汇总文件
+	ChecksumAlgorithm string          // 校验和算法：sha256 或 blake3
+	TrashDir          string          // 回收站目录，为空时使用默认位置
+	TrashDays         int             // 回收站中的项目保留天数，0 表示不限
+	TrashMaxBytes     int64           // 回收站的最大总大小，0 表示不限
+	UploadEndpoint    string          // S3 兼容对象存储的地址，与 UploadBucket 都设置时在压缩后上传
+	UploadRegion      string          // 签名使用的区域，为空时使用 us-east-1
+	UploadBucket      string          // 存储桶
+	UploadKey         string          // 对象键模板，为空时使用 {name}
+	UploadAccessKey   string          // 访问密钥，为空时读取 AWS_ACCESS_KEY_ID
+	UploadSecretKey   string          // 私有访问密钥，为空时读取 AWS_SECRET_ACCESS_KEY
+	UploadVirtualHost bool            // 使用 bucket.host 形式的地址，默认使用 host/bucket 路径形式
+	UploadPartBytes   int64           // 大于该大小的压缩包使用分段上传，也是每段的大小
+	UploadDeleteLocal bool            // 上传确认后删除本地的压缩包
+	PushTarget        string          // SFTP 目标 sftp://[user@]host[:port][/dir]，设置后在压缩后推送
+	PushIdentity      string          // SSH 私钥文件，为空时使用 ssh 的默认设置
+	PushRetries       int             // 推送失败时的最多尝试次数
+	Sink              string          // 压缩包写到哪里：为空时写入源目录，- 标准输出，http(s):// 地址流式 PUT，s3 流式写入 Upload* 设置的存储桶
+	NameEncoding      string          // 压缩包中条目名的编码：utf-8 设置 UTF-8 标记，gbk 或 shift-jis 写入旧式代码页的名称
+	Symlinks          string          // 符号链接：follow 打包指向的文件，store 保存为链接，skip 跳过；skip 时解压也不恢复链接
+	ExtractDepth      int             // 解压时递归解压嵌套归档的层数，0 表示不解压嵌套的归档
+	ExtractSubdirs    bool            // 解压时也处理源目录子文件夹中的压缩包
+	ExtractConflict   string          // 解压出的文件已存在时：overwrite 覆盖，rename 改名，skip 跳过，error 报错
+	ExtractMaxBytes   int64           // 每个压缩包（含嵌套的归档）最多解压出的字节数，0 表示不限
+	ExtractMaxEntries int             // 每个压缩包（含嵌套的归档）最多解压出的条目数，0 表示不限
+	ExtractInclude    []string        // 只解压匹配这些通配符的条目，含 / 的通配符匹配完整路径，否则匹配文件名
+	ExtractExclude    []string        // 不解压匹配这些通配符的条目
+	ExtractNames      map[string]bool // 只解压这些条目名，与 ExtractInclude 匹配任一即可
+	ExtractEncoding   string          // 没有 UTF-8 标记的条目名的编码：auto 自动检测，utf-8、gbk 或 shift-jis
+}
 
-	// 提示用户选择操作
-	action, _ := getUserInput(reader, "请选择操作：\n1. 压缩文件\n2. 仅组织文件\n3. 从文件夹或压缩包中提取文件\n请输入数字(1, 2 或 3): ", "")
-	switch action {
-	case "1":
-		// 压缩文件
-		maxFilesPerFolderStr, _ := getUserInput(reader, "请输入每个文件夹中的最大文件数（正整数，空行回车将使用默认值10）: ", "10")
-		maxFilesPerFolder, _ := strconv.Atoi(maxFilesPerFolderStr)
-		deleteConfirm, _ := getUserInput(reader, "压缩完成后是否需要删除源文件？(y/n, 直接回车将使用默认值n): ", "n")
-		deleteSourceFiles := strings.ToLower(deleteConfirm) == "y"
+// defaultPackOptions 返回程序内置的默认设置
+func defaultPackOptions() packOptions {
+	return packOptions{
+		Prefix:            "MarsGoExe_",
+		MaxFiles:          10,
+		BatchBy:           "count",
+		Format:            "zip",
+		Hidden:            "skip",
+		Junk:              "skip",
+		JunkPatterns:      append([]string(nil), defaultJunkPatterns...),
+		DeletePolicy:      "keep",
+		Checksums:         "none",
+		Dedup:             "off",
+		ChecksumAlgorithm: "sha256",
+		UploadPartBytes:   16 << 20,
+		PushRetries:       3,
+		NameEncoding:      "utf-8",
+		Symlinks:          "follow",
+		ExtractConflict:   "overwrite",
+		ExtractEncoding:   "auto",
+	}
+}
 
-		// 组织文件并压缩
-		finalFolderNum, err := organizeFilesAndCompress(sourceDirectory, prefix, maxFilesPerFolder, deleteSourceFiles)
-		if err != nil {
-			fmt.Printf("处理文件时发生错误: %v\n", err)
-			return
+// validate 检查设置是否有效
+func (o packOptions) validate() error {
+	switch o.BatchBy {
+	case "count":
+		if o.MaxFiles <= 0 {
+			return errors.New(msg("error.maxFiles", o.MaxFiles))
 		}
-		fmt.Printf("文件组织、压缩完成。最后的文件夹编号是 %d。\n", finalFolderNum)
-	case "2":
-		// 仅组织文件
-		maxFilesPerFolderStr, _ := getUserInput(reader, "请输入每个文件夹中的最大文件数（正整数，空行回车将使用默认值10）: ", "10")
-		maxFilesPerFolder, _ := strconv.Atoi(maxFilesPerFolderStr)
-
-		// 仅组织文件
-		finalFolderNum, err := organizeFilesOnly(sourceDirectory, prefix, maxFilesPerFolder)
-		if err != nil {
-			fmt.Printf("处理文件时发生错误: %v\n", err)
+	case "size":
+		if o.MaxBatchBytes <= 0 {
+			return errors.New(msg("error.maxBatchSize", o.MaxBatchBytes))
+		}
+	default:
+		return errors.New(msg("error.batchBy", o.BatchBy))
+	}
+	if o.Format != "zip" {
+		return errors.New(msg("error.format", o.Format))
+	}
+	switch o.DeletePolicy {
+	case "keep", "delete", "trash":
+	default:
+		return errors.New(msg("error.deletePolicy", o.DeletePolicy))
+	}
+	switch o.Dedup {
+	case "off", "skip", "alias", "separate":
+	default:
+		return errors.New(msg("error.dedup", o.Dedup))
+	}
+	switch o.Checksums {
+	case "none", "sidecar", "sums":
+	default:
+		return errors.New(msg("error.checksums", o.Checksums))
+	}
+	if _, ok := checksumAlgorithms[o.ChecksumAlgorithm]; !ok {
+		return errors.New(msg("error.checksumAlgorithm", o.ChecksumAlgorithm))
+	}
+	if (o.UploadEndpoint == "") != (o.UploadBucket == "") {
+		return errors.New(msg("error.uploadNotConfigured"))
+	}
+	if o.UploadPartBytes < minPartSize {
+		return errors.New(msg("error.uploadPartSize", o.UploadPartBytes))
+	}
+	if o.PushTarget != "" {
+		if _, err := parsePushTarget(o.PushTarget); err != nil {
+			return err
+		}
+	}
+	if o.PushRetries < 1 {
+		return errors.New(msg("error.pushRetries", o.PushRetries))
+	}
+	if err := o.validateSink(); err != nil {
+		return err
+	}
+	switch o.Symlinks {
+	case "follow", "store", "skip":
+	default:
+		return errors.New(msg("error.symlinks", o.Symlinks))
+	}
+	if _, ok := codePages[o.NameEncoding]; !ok && o.NameEncoding != "utf-8" {
+		return errors.New(msg("error.nameEncoding", o.NameEncoding))
+	}
+	if _, ok := codePages[o.ExtractEncoding]; !ok && o.ExtractEncoding != "utf-8" && o.ExtractEncoding != "auto" {
+		return errors.New(msg("error.nameEncoding", o.ExtractEncoding))
+	}
+	if o.ExtractDepth < 0 {
+		return errors.New(msg("error.extractDepth", o.ExtractDepth))
+	}
+	switch o.ExtractConflict {
+	case "overwrite", "rename", "skip", "error":
+	default:
+		return errors.New(msg("error.extractConflictPolicy", o.ExtractConflict))
+	}
+	if o.ExtractMaxBytes < 0 || o.ExtractMaxEntries < 0 {
+		return errors.New(msg("error.extractLimit"))
+	}
+	for _, policy := range []string{o.Hidden, o.Junk} {
+		if policy != "skip" && policy != "include" {
+			return errors.New(msg("error.skipPolicy", policy))
+		}
+	}
+	for _, pattern := range append(append(append([]string{}, o.Include...), o.Exclude...), o.JunkPatterns...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range append(append([]string{}, o.ExtractInclude...), o.ExtractExclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// validateSink 检查写入目标：远程目标上的压缩包无法再读取，需要本地压缩包的功能不能同时使用
+func (o packOptions) validateSink() error {
+	switch {
+	case o.Sink == "", o.Sink == "-", o.Sink == "s3":
+	case strings.HasPrefix(o.Sink, "http://"), strings.HasPrefix(o.Sink, "https://"):
+		if _, err := url.Parse(o.Sink); err != nil {
+			return err
+		}
+	default:
+		return errors.New(msg("error.sink", o.Sink))
+	}
+	if o.Sink == "" {
+		return nil
+	}
+	if o.Sink == "s3" && o.UploadEndpoint == "" {
+		return errors.New(msg("error.uploadNotConfigured"))
+	}
+	for _, conflict := range []struct {
+		flag string
+		used bool
+	}{
+		{"-manifest", o.Manifest},
+		{"-dedup alias", o.Dedup == "alias"},
+		{"-top-up", o.TopUp},
+		{"-checksums", o.Checksums != "none"},
+		{"-upload-endpoint", o.UploadEndpoint != "" && o.Sink != "s3"},
+		{"-push", o.PushTarget != ""},
+	} {
+		if conflict.used {
+			return errors.New(msg("error.sinkLocalOnly", o.Sink, conflict.flag))
+		}
+	}
+	return nil
+}
+
+// matches 判断文件名是否通过包含和排除规则
+func (o packOptions) matches(name string) bool {
+	for _, pattern := range o.Exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, pattern := range o.Include {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultJunkPatterns 默认跳过的系统和临时文件：macOS 的目录元数据，Windows 的缩略图缓存和文件夹设置，
+// Office 和 LibreOffice 的锁文件，编辑器的交换和备份文件，以及没有下载完的文件
+var defaultJunkPatterns = []string{
+	".DS_Store", "._*", "Thumbs.db", "ehthumbs.db", "desktop.ini",
+	"~$*", ".~lock.*#",
+	"*.swp", "*.swo", "*~", "*.tmp", "*.temp",
+	"*.crdownload", "*.part",
+}
+
+// skipReason 按隐藏文件和系统、临时文件的设置判断是否跳过 name（可以是带 / 的相对路径），
+// 返回跳过的原因，不跳过时为空。路径中任一部分以 . 开头都算隐藏文件
+func (o packOptions) skipReason(name string) string {
+	if o.Junk == "skip" {
+		base := strings.ToLower(path.Base(name))
+		for _, pattern := range o.JunkPatterns {
+			if ok, _ := filepath.Match(strings.ToLower(pattern), base); ok {
+				return "junk"
+			}
+		}
+	}
+	if o.Hidden == "skip" {
+		for _, part := range strings.Split(name, "/") {
+			if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+				return "hidden"
+			}
+		}
+	}
+	return ""
+}
+
+// extractFiltered 判断解压时是否只选择部分条目
+func (o packOptions) extractFiltered() bool {
+	return len(o.ExtractInclude) > 0 || len(o.ExtractExclude) > 0 || len(o.ExtractNames) > 0
+}
+
+// extractSelected 判断条目是否通过解压时的选择规则：先排除，再看条目名列表和包含规则，
+// 两者都为空时选择全部
+func (o packOptions) extractSelected(name string) bool {
+	name = strings.TrimPrefix(strings.ReplaceAll(name, "\\", "/"), "./")
+	matchAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			target := path.Base(name)
+			if strings.Contains(pattern, "/") {
+				target = name
+			}
+			if ok, _ := path.Match(pattern, target); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if matchAny(o.ExtractExclude) {
+		return false
+	}
+	if len(o.ExtractInclude) == 0 && len(o.ExtractNames) == 0 {
+		return true
+	}
+	return o.ExtractNames[name] || matchAny(o.ExtractInclude)
+}
+
+// collectFiles 列出 fsys 根目录中待处理的文件，返回已有的最大编号和按名称排序的文件
+func collectFiles(fsys fs.FS, opts packOptions) (int, []fs.DirEntry, error) {
+	maxZipNum, exists, err, files := findMaxPrefixNumber(fsys, ".", opts.Prefix)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !exists {
+		maxZipNum = 0 // 如果没有找到任何以该前缀命名的文件或文件夹，则最大编号为0
+	}
+
+	var fileEntries []os.DirEntry
+	for _, entry := range files {
+		if entry, ok := packCandidate(fsys, entry, opts); ok {
+			fileEntries = append(fileEntries, entry)
+		}
+	}
+
+	// 排序文件
+	sort.Slice(fileEntries, func(i, j int) bool {
+		return fileEntries[i].Name() < fileEntries[j].Name()
+	})
+	return maxZipNum, fileEntries, nil
+}
+
+// packCandidate 判断根目录中的条目是否参与打包。
+// 忽略文件夹、.exe文件、.zip文件、程序自身的日志、配置和状态文件，以及不符合过滤规则的文件，
+// 隐藏文件、系统和临时文件、特殊文件和按策略不打包的符号链接也被跳过，不计入批次
+func packCandidate(fsys fs.FS, entry fs.DirEntry, opts packOptions) (fs.DirEntry, bool) {
+	if entry.IsDir() || strings.HasSuffix(entry.Name(), ".exe") || strings.HasSuffix(entry.Name(), ".zip") || isArchiveSidecar(entry.Name()) || strings.HasPrefix(entry.Name(), stateFileName) || isToolFile(fsPath(fsys, entry.Name())) || !opts.matches(entry.Name()) {
+		return nil, false
+	}
+	if reason := opts.skipReason(entry.Name()); reason != "" {
+		logger.Debug("skip file", "src", fsPath(fsys, entry.Name()), "reason", reason)
+		return nil, false
+	}
+	info, ok := packableFile(fsys, entry.Name(), opts.Symlinks)
+	if !ok {
+		return nil, false
+	}
+	if entry.Type()&fs.ModeSymlink != 0 && opts.Symlinks == "follow" {
+		entry = fs.FileInfoToDirEntry(info) // 按指向的文件分批和判断是否变化
+	}
+	return entry, true
+}
+
+// planBatches 按分批方式将文件分成若干批，按大小分批时单个超限文件独占一批
+func planBatches(fileEntries []os.DirEntry, opts packOptions) [][]os.DirEntry {
+	var batches [][]os.DirEntry
+	if opts.BatchBy == "size" {
+		var current []os.DirEntry
+		var currentSize int64
+		for _, entry := range fileEntries {
+			var size int64
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			if len(current) > 0 && currentSize+size > opts.MaxBatchBytes {
+				batches = append(batches, current)
+				current, currentSize = nil, 0
+			}
+			current = append(current, entry)
+			currentSize += size
+		}
+		if len(current) > 0 {
+			batches = append(batches, current)
+		}
+		return batches
+	}
+	for i := 0; i < len(fileEntries); i += opts.MaxFiles {
+		end := i + opts.MaxFiles
+		if end > len(fileEntries) {
+			end = len(fileEntries)
+		}
+		batches = append(batches, fileEntries[i:end])
+	}
+	return batches
+}
+
+// moveBatch 在 fsys 根目录中创建批次文件夹 folder 并将文件移入
+func moveBatch(fsys writableFS, folder string, batch []fs.DirEntry) error {
+	// 创建文件夹
+	err := fsys.MkdirAll(folder, 0777)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	// 移动文件到新文件夹；指向同一批次中文件的链接随文件一起移动，其他相对路径的链接改写目标
+	names := make(map[string]bool, len(batch))
+	for _, file := range batch {
+		names[file.Name()] = true
+	}
+	for _, file := range batch {
+		oldName, newName := file.Name(), path.Join(folder, file.Name())
+		if target, linkErr := fsys.ReadLink(oldName); linkErr == nil && !names[path.Clean(target)] {
+			err = moveLink(fsys, oldName, newName, target)
+		} else {
+			err = moveFile(fsys, oldName, newName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// organizeFilesAndCompress 组织 fsys 根目录中的文件并压缩
+func organizeFilesAndCompress(fsys writableFS, opts packOptions) (int, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+	prefix = opts.Prefix
+	maxZipNum, fileEntries, err := collectFiles(fsys, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// 增量模式下跳过已打包过的文件
+	var state *archiveState
+	if opts.Incremental {
+		state, err = loadState(fsys)
+		if err != nil {
+			return 0, err
+		}
+		fileEntries, err = state.skipArchived(fileEntries)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// 如果没有文件，则直接返回
+	if len(fileEntries) == 0 {
+		logger.Info("no files in source directory", "dir", fsPath(fsys, "."))
+		return 0, nil
+	}
+
+	// 按内容去重
+	var aliases map[string]string
+	var dupes []os.DirEntry
+	if opts.Dedup != "off" {
+		var aliasOf map[string]string
+		fileEntries, dupes, aliasOf, err = findDuplicates(fsys, fileEntries)
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range dupes {
+			logger.Info("duplicate file", "src", entry.Name(), "original", aliasOf[entry.Name()], "policy", opts.Dedup)
+		}
+		switch opts.Dedup {
+		case "skip":
+			dupes = nil // 重复文件留在源目录中
+		case "alias":
+			aliases, dupes = aliasOf, nil
+		}
+	}
+
+	// 先补满最后一个未满的压缩包，剩余文件再分成新的批次
+	var topUp *batchJob
+	if opts.TopUp && maxZipNum > 0 {
+		topUp, fileEntries, err = planTopUp(fsys, maxZipNum, fileEntries, aliases, opts)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	batches := planBatches(fileEntries, opts)
+	jobs := numberedJobs(opts.Prefix, maxZipNum, batches)
+	if topUp != nil {
+		jobs = append([]batchJob{*topUp}, jobs...)
+	}
+	assignAliases(jobs, aliases)
+	if len(dupes) > 0 {
+		jobs = append(jobs, batchJob{folderName: dupesFolderName(fsys, opts.Prefix), files: dupes})
+	}
+	if err := compressBatches(fsys, jobs, opts, state); err != nil {
+		return 0, err
+	}
+	return maxZipNum + len(batches), nil
+}
+
+// batchJob 一个待压缩的批次
+type batchJob struct {
+	folderName string
+	files      []os.DirEntry     // 写入压缩包的文件
+	aliases    map[string]string // 内容重复的文件名 -> 压缩包中保留的文件名，随批次移动但不写入压缩包
+	topUp      bool              // 追加到已有的同名压缩包，而不是新建
+}
+
+// numberedJobs 为每批文件分配从 maxZipNum+1 开始的编号
+func numberedJobs(prefix string, maxZipNum int, batches [][]os.DirEntry) []batchJob {
+	jobs := make([]batchJob, len(batches))
+	for i, batch := range batches {
+		jobs[i] = batchJob{folderName: fmt.Sprintf("%s%d", prefix, maxZipNum+1+i), files: batch}
+	}
+	return jobs
+}
+
+// assignAliases 把重复文件归入其保留副本所在的批次
+func assignAliases(jobs []batchJob, aliases map[string]string) {
+	batchOf := make(map[string]int)
+	for i, job := range jobs {
+		for _, entry := range job.files {
+			batchOf[entry.Name()] = i
+		}
+	}
+	for alias, original := range aliases {
+		i, ok := batchOf[original]
+		if !ok {
+			continue
+		}
+		if jobs[i].aliases == nil {
+			jobs[i].aliases = make(map[string]string)
+		}
+		jobs[i].aliases[alias] = original
+	}
+}
+
+// compressBatches 将每批文件移入对应的文件夹并压缩，移动文件失败时停止并返回错误。
+// state 不为 nil 时把打包成功的文件记录到增量状态中
+func compressBatches(fsys writableFS, jobs []batchJob, opts packOptions, state *archiveState) error {
+	// 统计总字节数，用于进度上报
+	var totalBytes int64
+	for _, job := range jobs {
+		for _, entry := range job.files {
+			if info, err := entry.Info(); err == nil {
+				totalBytes += info.Size()
+			}
+		}
+	}
+
+	// 上传、推送和移入回收站需要本地文件，在移动文件之前检查
+	sourceDir, local := localPath(fsys, ".")
+	if !local && (opts.UploadEndpoint != "" && opts.Sink != "s3" || opts.PushTarget != "" || opts.DeletePolicy == "trash") {
+		return errors.New(msg("error.localOnly"))
+	}
+
+	// 标准输出只能写一个压缩包，在移动文件之前检查
+	sink, err := newArchiveSink(fsys, opts)
+	if err != nil {
+		return err
+	}
+	if _, ok := sink.(*stdoutSink); ok && len(jobs) > 1 {
+		return errors.New(msg("error.sinkStdoutBatches", len(jobs)))
+	}
+
+	// 需要上传时先检查访问密钥等设置，流式写入对象存储时由写入目标上传
+	var uploader *s3Client
+	if opts.UploadEndpoint != "" && sink.Local() {
+		if uploader, err = newS3Client(opts); err != nil {
+			return err
+		}
+	}
+
+	// 处理文件，每批放入一个文件夹并压缩
+	for i, job := range jobs {
+		report := func(ev progressEvent) {
+			ev.Batch = i + 1
+			ev.TotalBatches = len(jobs)
+			ev.Folder = job.folderName
+			ev.TotalBytes = totalBytes
+			emitProgress(ev)
+		}
+		if err := compressBatch(fsys, job, opts, state, sink, uploader, report); err != nil {
+			return err
+		}
+	}
+
+	// 按保留策略清理回收站
+	if opts.DeletePolicy == "trash" {
+		trashDir := resolveTrashDir(sourceDir, opts)
+		if err := purgeTrash(trashDir, opts.TrashDays, opts.TrashMaxBytes); err != nil {
+			logger.Error("purge trash failed", "trash", trashDir, "err", err)
+		}
+	}
+	return nil
+}
+
+// compressBatch 将一批文件移入文件夹、压缩写入 sink、校验并按设置处理源文件。
+// 只有移动文件失败时返回错误，压缩或校验失败时记录日志并保留文件夹
+func compressBatch(fsys writableFS, job batchJob, opts packOptions, state *archiveState, sink archiveSink, uploader *s3Client, report func(progressEvent)) error {
+	folderPath := fsPath(fsys, job.folderName)
+	report(progressEvent{Type: progressBatchStarted})
+
+	err := moveBatch(fsys, job.folderName, job.files)
+	if err != nil {
+		return err
+	}
+	skip := make(map[string]bool)
+	for alias := range job.aliases {
+		if err := moveFile(fsys, alias, path.Join(job.folderName, alias)); err != nil {
+			return err
+		}
+		skip[alias] = true
+	}
+
+	// 压缩文件夹，补充已有的压缩包时只追加本批文件（只用于本地目录）
+	zipName := job.folderName + ".zip"
+	zipFilePath := fsPath(fsys, zipName)
+	start := time.Now()
+	existing := 0
+	event := "create zip"
+	var zipSize int64
+	if job.topUp {
+		event = "update zip"
+		existing, err = appendToZip(fsys, job.folderName, zipName, job.files, opts, report)
+		if info, statErr := fsys.Stat(zipName); statErr == nil {
+			zipSize = info.Size()
+		}
+	} else {
+		zipSize, err = writeToSink(sink, zipName, func(w io.Writer) error {
+			return compressFolder(w, fsys, job.folderName, skip, opts, report)
+		})
+	}
+	if err != nil {
+		logger.Error(event+" failed", "src", folderPath, "dst", sink.Location(zipName), "err", err)
+		return nil // 跳过删除文件夹，因为压缩失败
+	}
+	logger.Info(event, "src", folderPath, "dst", sink.Location(zipName), "size", zipSize, "files", len(job.files), "existing", existing, "duration", time.Since(start))
+
+	// 校验压缩包，校验失败时保留文件夹；远程目标上的压缩包无法再读取，
+	// 写入目标确认收到完整内容即可，清单、校验和、上传和推送已由 validate 排除
+	if sink.Local() {
+		err = verifyZip(fsys, zipName, existing+len(job.files))
+		if err != nil {
+			logger.Error("verify zip failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+		report(progressEvent{Type: progressBatchVerified})
+	}
+
+	// 生成清单，重复文件只记录在清单中；补充压缩包时重新生成原有的清单并保留其中的重复文件；
+	// 失败时保留文件夹以便重新生成
+	aliases := job.aliases
+	hasManifest := false
+	if job.topUp {
+		manifest, err := readManifest(fsys, zipName)
+		if err != nil {
+			logger.Error("read manifest failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+		if manifest != nil {
+			hasManifest = true
+			aliases = make(map[string]string)
+			for _, entry := range manifest.Entries {
+				if entry.AliasOf != "" {
+					aliases[entry.Name] = entry.AliasOf
+				}
+			}
+			for alias, original := range job.aliases {
+				aliases[alias] = original
+			}
+		}
+	}
+	if opts.Manifest || hasManifest || len(aliases) > 0 {
+		if err := writeManifest(fsys, zipName, aliases); err != nil {
+			logger.Error("write manifest failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+		logger.Info("write manifest", "src", zipFilePath, "dst", fsPath(fsys, zipName+manifestSuffix), "aliases", len(aliases))
+	}
+
+	// 补充压缩包后原有的校验和已失效，重新计算
+	if job.topUp {
+		updated, err := refreshChecksums(fsys, zipName)
+		if err != nil {
+			logger.Error("write checksum failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+		for _, name := range updated {
+			logger.Info("write checksum", "src", zipFilePath, "dst", fsPath(fsys, name))
+		}
+	}
+
+	// 生成校验和文件，失败时保留文件夹以便重新生成
+	if opts.Checksums != "none" {
+		checksumName, err := writeChecksum(fsys, zipName, opts)
+		if err != nil {
+			logger.Error("write checksum failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+		logger.Info("write checksum", "src", zipFilePath, "dst", fsPath(fsys, checksumName), "algorithm", opts.ChecksumAlgorithm)
+	}
+
+	// 记录到增量状态，失败时保留文件夹，避免下次运行重复打包
+	if state != nil {
+		if err := state.recordBatch(job.folderName, zipName, job); err != nil {
+			logger.Error("record state failed", "src", zipFilePath, "state", fsPath(fsys, stateFileName), "err", err)
+			return nil
+		}
+	}
+
+	// 上传到对象存储，失败时保留文件夹和压缩包，之后可以用 upload 命令续传
+	if uploader != nil {
+		if _, err := uploadArchive(uploader, zipFilePath, opts); err != nil {
+			logger.Error("upload failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+	}
+
+	// 推送到 SFTP 服务器，失败时保留文件夹和压缩包，之后可以用 push 命令重新推送
+	if opts.PushTarget != "" {
+		if err := pushArchive(zipFilePath, opts); err != nil {
+			logger.Error("push failed", "src", zipFilePath, "err", err)
+			return nil
+		}
+	}
+
+	// 删除文件夹
+	// 根据用户选择是否删除源文件
+	if opts.DeletePolicy != "keep" {
+		if removeSource(fsys, job.folderName, opts) == nil {
+			report(progressEvent{Type: progressBatchDeleted})
+		}
+	}
+
+	// 上传已确认，删除本地的压缩包
+	if uploader != nil && opts.UploadDeleteLocal {
+		sourceDir, _ := localPath(fsys, ".")
+		if err := deleteUploaded(sourceDir, zipFilePath, opts); err != nil {
+			logger.Error("delete uploaded archive failed", "src", zipFilePath, "err", err)
+		}
+	}
+	return nil
+}
+
+// organizeFilesOnly 组织 fsys 根目录中的文件但不压缩
+func organizeFilesOnly(fsys writableFS, opts packOptions) (int, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+	prefix = opts.Prefix
+	maxZipNum, fileEntries, err := collectFiles(fsys, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// 如果没有文件，则直接返回
+	if len(fileEntries) == 0 {
+		logger.Info("no files in source directory", "dir", fsPath(fsys, "."))
+		return 0, nil
+	}
+
+	// 处理文件，每批放入一个文件夹
+	finalFolderNum := maxZipNum
+	for i, batch := range planBatches(fileEntries, opts) {
+		finalFolderNum = maxZipNum + 1 + i
+		err = moveBatch(fsys, fmt.Sprintf("%s%d", prefix, finalFolderNum), batch)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return finalFolderNum, nil
+}
+
+// removeSource 按源文件处理方式删除 fsys 中的批次文件夹 folder 或将其移入回收站，回收站只用于本地目录
+func removeSource(fsys writableFS, folder string, opts packOptions) error {
+	start := time.Now()
+	folderPath := fsPath(fsys, folder)
+	size := dirSize(fsys, folder)
+	if opts.DeletePolicy == "trash" {
+		sourceDir, ok := localPath(fsys, ".")
+		if !ok {
+			return errors.New(msg("error.localOnly"))
+		}
+		trashPath, err := moveToTrash(resolveTrashDir(sourceDir, opts), folderPath)
+		if err != nil {
+			logger.Error("trash folder failed", "src", folderPath, "err", err)
+			return err
+		}
+		logger.Info("trash folder", "src", folderPath, "dst", trashPath, "size", size, "duration", time.Since(start))
+		return nil
+	}
+	if err := fsys.RemoveAll(folder); err != nil {
+		logger.Error("delete folder failed", "src", folderPath, "err", err)
+		return err
+	}
+	logger.Info("delete folder", "src", folderPath, "size", size, "duration", time.Since(start))
+	return nil
+}
+
+// listFlag 以逗号分隔、可重复指定的字符串列表参数
+type listFlag struct {
+	values *[]string
+	set    bool
+}
+
+func (f *listFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	// 第一次在命令行上指定时替换配置文件中的值
+	if !f.set {
+		*f.values = nil
+		f.set = true
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f.values = append(*f.values, v)
+		}
+	}
+	return nil
+}
+
+// sizeFlag 以 parseSize 格式指定的大小参数
+type sizeFlag struct {
+	value *int64
+}
+
+func (f sizeFlag) String() string {
+	if f.value == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*f.value, 10)
+}
+
+func (f sizeFlag) Set(value string) error {
+	size, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	*f.value = size
+	return nil
+}
+
+// nameEncodingFlag 编码名称参数，接受 cp936、sjis 等其他写法
+type nameEncodingFlag struct {
+	value *string
+}
+
+func (f nameEncodingFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f nameEncodingFlag) Set(value string) error {
+	*f.value = normalizeNameEncoding(value)
+	return nil
+}
+
+// addBatchFlags 注册分批相关的命令行参数，默认值取自 opts
+func addBatchFlags(fs *flag.FlagSet, opts *packOptions) {
+	fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+	fs.IntVar(&opts.MaxFiles, "max-files", opts.MaxFiles, msg("flag.maxFiles"))
+	fs.StringVar(&opts.BatchBy, "batch-by", opts.BatchBy, msg("flag.batchBy"))
+	fs.Var(sizeFlag{&opts.MaxBatchBytes}, "max-batch-size", msg("flag.maxBatchSize"))
+	fs.Var(&listFlag{values: &opts.Include}, "include", msg("flag.include"))
+	fs.Var(&listFlag{values: &opts.Exclude}, "exclude", msg("flag.exclude"))
+	fs.StringVar(&opts.Hidden, "hidden", opts.Hidden, msg("flag.hidden"))
+	fs.StringVar(&opts.Junk, "junk", opts.Junk, msg("flag.junk"))
+	fs.Var(&listFlag{values: &opts.JunkPatterns}, "junk-patterns", msg("flag.junkPatterns"))
+	fs.StringVar(&opts.Symlinks, "symlinks", opts.Symlinks, msg("flag.symlinks"))
+}
+
+// getUserInput 获取用户输入
+func getUserInput(reader *bufio.Reader, prompt, defaultValue string) (string, error) {
+	fmt.Print(prompt)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		input = defaultValue
+	}
+	return input, nil
+}
+
+// yesNo 将布尔值转换为交互提示中的 y/n 默认值
+func yesNo(b bool) string {
+	if b {
+		return "y"
+	}
+	return "n"
+}
+
+// compressWithProgress 组织文件并压缩，压缩过程中显示进度条
+func compressWithProgress(sourceDir string, opts packOptions) (int, error) {
+	activeProgressBar = newProgressBar(statusOut)
+	progressHandler = activeProgressBar.handle
+	defer func() {
+		activeProgressBar.finish()
+		activeProgressBar, progressHandler = nil, nil
+	}()
+	return organizeFilesAndCompress(dirFS(sourceDir), opts)
+}
+
+// runInteractive 通过交互提示完成操作，提示中的默认值取自 opts
+func runInteractive(opts packOptions) {
+	reader := bufio.NewReader(os.Stdin)
+
+	// 程序开始提示
+	fmt.Println(msg("banner.line"))
+	fmt.Println(msg("banner.warning"))
+	fmt.Println(msg("banner.line"))
+
+	// 输入文件前缀
+	opts.Prefix, _ = getUserInput(reader, msg("prompt.prefix", opts.Prefix), opts.Prefix)
+	prefix = opts.Prefix
+
+	// 提示用户选择操作
+	action, _ := getUserInput(reader, msg("prompt.action"), "")
+	switch action {
+	case "1":
+		// 压缩文件
+		if opts.BatchBy == "count" {
+			maxFilesPerFolderStr, _ := getUserInput(reader, msg("prompt.maxFiles", strconv.Itoa(opts.MaxFiles)), strconv.Itoa(opts.MaxFiles))
+			opts.MaxFiles, _ = strconv.Atoi(maxFilesPerFolderStr)
+		}
+		defaultDelete := map[string]string{"keep": "n", "delete": "y", "trash": "t"}[opts.DeletePolicy]
+		deleteConfirm, _ := getUserInput(reader, msg("prompt.deleteSource", defaultDelete), defaultDelete)
+		switch strings.ToLower(deleteConfirm) {
+		case "y":
+			opts.DeletePolicy = "delete"
+		case "t":
+			opts.DeletePolicy = "trash"
+		default:
+			opts.DeletePolicy = "keep"
+		}
+
+		// 组织文件并压缩
+		finalFolderNum, err := compressWithProgress(sourceDirectory, opts)
+		if err != nil {
+			logger.Error("organize files failed", "dir", sourceDirectory, "err", err)
 			return
 		}
-		fmt.Printf("文件组织完成。最后的文件夹编号是 %d。\n", finalFolderNum)
+		fmt.Println(msg("summary.compressed", finalFolderNum))
+	case "2":
+		// 仅组织文件
+		if opts.BatchBy == "count" {
+			maxFilesPerFolderStr, _ := getUserInput(reader, msg("prompt.maxFiles", strconv.Itoa(opts.MaxFiles)), strconv.Itoa(opts.MaxFiles))
+			opts.MaxFiles, _ = strconv.Atoi(maxFilesPerFolderStr)
+		}
+
+		// 仅组织文件
+		finalFolderNum, err := organizeFilesOnly(dirFS(sourceDirectory), opts)
+		if err != nil {
+			logger.Error("organize files failed", "dir", sourceDirectory, "err", err)
+			return
+		}
+		fmt.Println(msg("summary.organized", finalFolderNum))
 	case "3":
 		// 从文件夹或压缩包中提取文件
-		extractFromOption, _ := getUserInput(reader, "请选择提取方式：\n1. 从文件夹中提取文件\n2. 从压缩包中提取文件\n请输入数字(1 或 2): ", "")
+		extractFromOption, _ := getUserInput(reader, msg("prompt.extractFrom"), "")
 		switch extractFromOption {
 		case "1":
 			// 从文件夹中提取文件
-			deleteEmptyFoldersConfirm, _ := getUserInput(reader, "是否删除已提取的空文件夹？(y/n, 直接回车将使用默认值n): ", "n")
+			deleteEmptyFoldersConfirm, _ := getUserInput(reader, msg("prompt.deleteEmpty", "n"), "n")
 			deleteEmptyFolders = strings.ToLower(deleteEmptyFoldersConfirm) == "y"
-			onlyWithPrefixConfirm, _ := getUserInput(reader, "是否只从指定前缀的文件夹中提取文件？(y/n, 直接回车将使用默认值n): ", "n")
+			defaultOnly := "n"
+			if opts.OnlyWithPrefix != nil {
+				defaultOnly = yesNo(*opts.OnlyWithPrefix)
+			}
+			onlyWithPrefixConfirm, _ := getUserInput(reader, msg("prompt.folderPrefix", defaultOnly), defaultOnly)
 			onlyWithPrefix := strings.ToLower(onlyWithPrefixConfirm) == "y"
 
 			// 从文件夹中提取文件
-			files, _ := os.ReadDir(sourceDirectory)
-			for _, file := range files {
-				if file.IsDir() && (!onlyWithPrefix || strings.HasPrefix(file.Name(), prefix)) {
-					folderPath := filepath.Join(sourceDirectory, file.Name())
-					fmt.Printf("正在处理文件夹: %s\n", folderPath)
-					err := extractFromFolder(folderPath, sourceDirectory)
-					if err != nil {
-						fmt.Printf("从文件夹 %s 提取文件时发生错误: %v\n", folderPath, err)
-					} else {
-						fmt.Printf("从文件夹 %s 提取文件完成。\n", folderPath)
-					}
-
-					// 删除空文件夹
-					if deleteEmptyFolders && strings.HasPrefix(file.Name(), prefix) {
-						err := removeEmptyFolders(folderPath, prefix)
-						if err != nil {
-							fmt.Printf("删除空文件夹 %s 时发生错误: %v\n", folderPath, err)
-						} else {
-							fmt.Printf("已删除空文件夹 %s\n", folderPath)
-						}
-					}
-				}
-			}
+			extractFromFolders(dirFS(sourceDirectory), prefix, onlyWithPrefix, deleteEmptyFolders)
 		case "2":
 			// 从压缩包中提取文件
-			onlyWithPrefixConfirm, _ := getUserInput(reader, "是否只从指定前缀的压缩包中提取文件？(y/n, 直接回车将使用默认值y): ", "y")
+			defaultOnly := "y"
+			if opts.OnlyWithPrefix != nil {
+				defaultOnly = yesNo(*opts.OnlyWithPrefix)
+			}
+			onlyWithPrefixConfirm, _ := getUserInput(reader, msg("prompt.zipPrefix", defaultOnly), defaultOnly)
 			onlyWithPrefix := strings.ToLower(onlyWithPrefixConfirm) == "y"
 
 			// 从压缩包中提取文件
-			err := extractFromZips(sourceDirectory, prefix, onlyWithPrefix)
+			err := extractFromZips(dirFS(sourceDirectory), prefix, onlyWithPrefix, opts)
 			if err != nil {
-				fmt.Printf("从压缩包中提取文件时发生错误: %v\n", err)
+				logger.Error("extract zips failed", "dir", sourceDirectory, "err", err)
 			} else {
-				fmt.Println("从压缩包中提取文件完成。")
+				fmt.Println(msg("summary.extracted"))
 			}
 		default:
-			fmt.Println("无效的选择，请重新运行程序并选择有效的选项。")
+			fmt.Println(msg("error.invalidChoice"))
 		}
 	default:
-		fmt.Println("无效的选择，请重新运行程序并选择有效的选项。")
+		fmt.Println(msg("error.invalidChoice"))
+	}
+}
+
+// addChecksumFlags 注册校验和相关的命令行参数，默认值取自 opts
+func addChecksumFlags(fs *flag.FlagSet, opts *packOptions) {
+	fs.StringVar(&opts.Checksums, "checksums", opts.Checksums, msg("flag.checksums"))
+	fs.StringVar(&opts.ChecksumAlgorithm, "checksum-algorithm", opts.ChecksumAlgorithm, msg("flag.checksumAlgorithm"))
+}
+
+// addTrashFlags 注册回收站相关的命令行参数，默认值取自 opts
+func addTrashFlags(fs *flag.FlagSet, opts *packOptions) {
+	fs.StringVar(&opts.TrashDir, "trash-dir", opts.TrashDir, msg("flag.trashDir"))
+	fs.IntVar(&opts.TrashDays, "trash-days", opts.TrashDays, msg("flag.trashDays"))
+	fs.Var(sizeFlag{&opts.TrashMaxBytes}, "trash-max-size", msg("flag.trashMaxSize"))
+}
+
+// addUploadFlags 注册上传到对象存储的选项，访问密钥只能通过配置文件或环境变量设置
+func addUploadFlags(fs *flag.FlagSet, opts *packOptions) {
+	fs.StringVar(&opts.UploadEndpoint, "upload-endpoint", opts.UploadEndpoint, msg("flag.uploadEndpoint"))
+	fs.StringVar(&opts.UploadRegion, "upload-region", opts.UploadRegion, msg("flag.uploadRegion"))
+	fs.StringVar(&opts.UploadBucket, "upload-bucket", opts.UploadBucket, msg("flag.uploadBucket"))
+	fs.StringVar(&opts.UploadKey, "upload-key", opts.UploadKey, msg("flag.uploadKey"))
+	fs.BoolVar(&opts.UploadVirtualHost, "upload-virtual-host", opts.UploadVirtualHost, msg("flag.uploadVirtualHost"))
+	fs.Var(sizeFlag{&opts.UploadPartBytes}, "upload-part-size", msg("flag.uploadPartSize"))
+	fs.BoolVar(&opts.UploadDeleteLocal, "upload-delete-local", opts.UploadDeleteLocal, msg("flag.uploadDeleteLocal"))
+}
+
+// addPushFlags 注册推送到 SFTP 服务器的选项
+func addPushFlags(fs *flag.FlagSet, opts *packOptions) {
+	fs.StringVar(&opts.PushTarget, "push", opts.PushTarget, msg("flag.push"))
+	fs.StringVar(&opts.PushIdentity, "push-identity", opts.PushIdentity, msg("flag.pushIdentity"))
+	fs.IntVar(&opts.PushRetries, "push-retries", opts.PushRetries, msg("flag.pushRetries"))
+}
+
+// archivesFromArgs 返回命令行中指定的压缩包，参数为目录时查找其中的压缩包，没有参数时查找源目录
+func archivesFromArgs(args []string, prefix string, onlyWithPrefix bool) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{sourceDirectory}
+	}
+	var archives []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			archives = append(archives, arg)
+			continue
+		}
+		found, err := findArchives(arg, prefix, onlyWithPrefix)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, found...)
+	}
+	return archives, nil
+}
+
+// numberedArchivesFromArgs 收集命令行参数中的压缩包，参数为目录时取其中以前缀加编号命名的压缩包，
+// 没有参数时使用源目录
+func numberedArchivesFromArgs(args []string, prefix string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{sourceDirectory}
+	}
+	var archives []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			archives = append(archives, arg)
+			continue
+		}
+		found, err := numberedArchives(arg, prefix)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, found...)
+	}
+	return archives, nil
+}
+
+// runCommand 以非交互方式执行子命令，参数的默认值取自 opts
+func runCommand(name string, args []string, opts packOptions) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	switch name {
+	case "pack":
+		addBatchFlags(fs, &opts)
+		fs.StringVar(&opts.Format, "format", opts.Format, msg("flag.format"))
+		fs.StringVar(&opts.DeletePolicy, "delete", opts.DeletePolicy, msg("flag.delete"))
+		fs.BoolVar(&opts.Manifest, "manifest", opts.Manifest, msg("flag.manifest"))
+		addChecksumFlags(fs, &opts)
+		fs.BoolVar(&opts.Incremental, "incremental", opts.Incremental, msg("flag.incremental"))
+		addUploadFlags(fs, &opts)
+		addPushFlags(fs, &opts)
+		fs.StringVar(&opts.Dedup, "dedup", opts.Dedup, msg("flag.dedup"))
+		fs.BoolVar(&opts.TopUp, "top-up", opts.TopUp, msg("flag.topUp"))
+		fs.StringVar(&opts.Sink, "sink", opts.Sink, msg("flag.sink"))
+		fs.Var(nameEncodingFlag{&opts.NameEncoding}, "name-encoding", msg("flag.nameEncoding"))
+		toStdout := fs.Bool("stdout", false, msg("flag.stdout"))
+		filesFrom := fs.String("files-from", "", msg("flag.filesFrom"))
+		addTrashFlags(fs, &opts)
+		fs.Parse(args)
+		if *toStdout {
+			opts.Sink = "-"
+		}
+		if opts.Sink == "-" {
+			statusOut = os.Stderr
+		}
+		if *filesFrom != "" {
+			count, location, err := packFileList(sourceDirectory, *filesFrom, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(statusOut, msg("summary.packedList", count, location))
+			return nil
+		}
+		finalFolderNum, err := organizeFilesAndCompress(dirFS(sourceDirectory), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(statusOut, msg("summary.compressed", finalFolderNum))
+	case "organize":
+		addBatchFlags(fs, &opts)
+		fs.Parse(args)
+		finalFolderNum, err := organizeFilesOnly(dirFS(sourceDirectory), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(statusOut, msg("summary.organized", finalFolderNum))
+	case "extract":
+		from := fs.String("from", "zips", msg("flag.from"))
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		onlyWithPrefix := fs.Bool("only-with-prefix", opts.OnlyWithPrefix == nil || *opts.OnlyWithPrefix, msg("flag.onlyWithPrefix"))
+		deleteEmpty := fs.Bool("delete-empty", false, msg("flag.deleteEmpty"))
+		fs.IntVar(&opts.ExtractDepth, "depth", opts.ExtractDepth, msg("flag.extractDepth"))
+		fs.BoolVar(&opts.ExtractSubdirs, "subdirs", opts.ExtractSubdirs, msg("flag.extractSubdirs"))
+		fs.StringVar(&opts.ExtractConflict, "on-conflict", opts.ExtractConflict, msg("flag.extractConflict"))
+		fs.Var(sizeFlag{&opts.ExtractMaxBytes}, "max-size", msg("flag.extractMaxSize"))
+		fs.IntVar(&opts.ExtractMaxEntries, "max-entries", opts.ExtractMaxEntries, msg("flag.extractMaxEntries"))
+		fs.Var(&listFlag{values: &opts.ExtractInclude}, "include", msg("flag.extractInclude"))
+		fs.Var(&listFlag{values: &opts.ExtractExclude}, "exclude", msg("flag.extractExclude"))
+		fs.Var(nameEncodingFlag{&opts.ExtractEncoding}, "name-encoding", msg("flag.extractNameEncoding"))
+		fs.StringVar(&opts.Symlinks, "symlinks", opts.Symlinks, msg("flag.extractSymlinks"))
+		namesFrom := fs.String("names", "", msg("flag.extractNames"))
+		fs.Parse(args)
+		if *namesFrom != "" {
+			names, err := readEntryNames(*namesFrom)
+			if err != nil {
+				return err
+			}
+			opts.ExtractNames = names
+		}
+		prefix = opts.Prefix
+		switch *from {
+		case "zips":
+			if err := extractFromZips(dirFS(sourceDirectory), prefix, *onlyWithPrefix, opts); err != nil {
+				return err
+			}
+			fmt.Fprintln(statusOut, msg("summary.extracted"))
+		case "folders":
+			extractFromFolders(dirFS(sourceDirectory), prefix, *onlyWithPrefix, *deleteEmpty)
+		default:
+			return errors.New(msg("error.extractFrom", *from))
+		}
+	case "watch":
+		addBatchFlags(fs, &opts)
+		fs.StringVar(&opts.Format, "format", opts.Format, msg("flag.format"))
+		fs.StringVar(&opts.DeletePolicy, "delete", opts.DeletePolicy, msg("flag.delete"))
+		fs.BoolVar(&opts.Manifest, "manifest", opts.Manifest, msg("flag.manifest"))
+		addChecksumFlags(fs, &opts)
+		fs.BoolVar(&opts.Incremental, "incremental", opts.Incremental, msg("flag.incremental"))
+		addUploadFlags(fs, &opts)
+		addPushFlags(fs, &opts)
+		fs.StringVar(&opts.Sink, "sink", opts.Sink, msg("flag.sink"))
+		fs.Var(nameEncodingFlag{&opts.NameEncoding}, "name-encoding", msg("flag.nameEncoding"))
+		addTrashFlags(fs, &opts)
+		var wopts watchOptions
+		fs.DurationVar(&wopts.Interval, "interval", 5*time.Second, msg("flag.watchInterval"))
+		fs.DurationVar(&wopts.StableFor, "stable", 10*time.Second, msg("flag.watchStable"))
+		fs.DurationVar(&wopts.FlushAfter, "flush-after", 10*time.Minute, msg("flag.watchFlushAfter"))
+		fs.Parse(args)
+		if opts.Sink == "-" {
+			return errors.New(msg("error.sinkStdoutWatch"))
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return watchAndCompress(ctx, sourceDirectory, opts, wopts)
+	case "repack":
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		toPrefix := fs.String("to-prefix", "", msg("flag.toPrefix"))
+		fs.IntVar(&opts.MaxFiles, "max-files", opts.MaxFiles, msg("flag.maxFiles"))
+		fs.StringVar(&opts.BatchBy, "batch-by", opts.BatchBy, msg("flag.batchBy"))
+		fs.Var(sizeFlag{&opts.MaxBatchBytes}, "max-batch-size", msg("flag.maxBatchSize"))
+		fs.StringVar(&opts.Format, "format", opts.Format, msg("flag.format"))
+		level := fs.Int("level", -1, msg("flag.level"))
+		opts.DeletePolicy = "delete" // 重新打包后默认删除原压缩包
+		fs.StringVar(&opts.DeletePolicy, "delete", opts.DeletePolicy, msg("flag.repackDelete"))
+		fs.BoolVar(&opts.Manifest, "manifest", opts.Manifest, msg("flag.manifest"))
+		addChecksumFlags(fs, &opts)
+		addTrashFlags(fs, &opts)
+		fs.Parse(args)
+		prefix = opts.Prefix
+		count, err := repackArchives(sourceDirectory, *toPrefix, *level, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(statusOut, msg("summary.repacked", count))
+	case "merge":
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		output := fs.String("o", "", msg("flag.mergeOutput"))
+		conflict := fs.String("on-conflict", "rename", msg("flag.mergeConflict"))
+		fs.StringVar(&opts.DeletePolicy, "delete", "keep", msg("flag.mergeDelete"))
+		fs.BoolVar(&opts.Manifest, "manifest", opts.Manifest, msg("flag.manifest"))
+		addChecksumFlags(fs, &opts)
+		addTrashFlags(fs, &opts)
+		fs.Parse(args)
+		if *output == "" {
+			return errors.New(msg("error.mergeNoOutput"))
+		}
+		archives, err := numberedArchivesFromArgs(fs.Args(), opts.Prefix)
+		if err != nil {
+			return err
+		}
+		if err := mergeArchives(archives, *output, *conflict, opts); err != nil {
+			return err
+		}
+		fmt.Fprintln(statusOut, msg("summary.merged", len(archives), *output))
+	case "split":
+		toPrefix := fs.String("to-prefix", "", msg("flag.splitPrefix"))
+		fs.IntVar(&opts.MaxFiles, "max-files", opts.MaxFiles, msg("flag.maxFiles"))
+		fs.StringVar(&opts.BatchBy, "batch-by", opts.BatchBy, msg("flag.batchBy"))
+		fs.Var(sizeFlag{&opts.MaxBatchBytes}, "max-batch-size", msg("flag.maxBatchSize"))
+		fs.StringVar(&opts.DeletePolicy, "delete", "keep", msg("flag.mergeDelete"))
+		fs.BoolVar(&opts.Manifest, "manifest", opts.Manifest, msg("flag.manifest"))
+		addChecksumFlags(fs, &opts)
+		addTrashFlags(fs, &opts)
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errors.New(msg("error.splitArgs"))
+		}
+		count, err := splitArchive(fs.Arg(0), *toPrefix, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(statusOut, msg("summary.split", fs.Arg(0), count))
+	case "convert":
+		to := fs.String("to", "", msg("flag.convertTo"))
+		output := fs.String("o", "", msg("flag.convertOutput"))
+		fs.StringVar(&opts.DeletePolicy, "delete", "keep", msg("flag.mergeDelete"))
+		addChecksumFlags(fs, &opts)
+		addTrashFlags(fs, &opts)
+		fs.Parse(args)
+		if _, _, ok := archiveFormatOf("." + *to); !ok || strings.HasPrefix(*to, ".") {
+			return errors.New(msg("error.archiveFormat", *to))
+		}
+		if fs.NArg() == 0 {
+			return errors.New(msg("error.convertArgs"))
+		}
+		if *output != "" && fs.NArg() > 1 {
+			return errors.New(msg("error.convertOutput"))
+		}
+		for _, input := range fs.Args() {
+			dst := *output
+			if dst == "" {
+				_, ext, ok := archiveFormatOf(input)
+				if !ok {
+					return fmt.Errorf("%s: %s", input, msg("error.archiveFormatOf"))
+				}
+				dst = strings.TrimSuffix(input, ext) + "." + *to
+			}
+			start := time.Now()
+			files, err := convertArchive(input, dst, *to)
+			if err != nil {
+				return err
+			}
+			logger.Info("convert archive", "src", input, "dst", dst, "format", *to, "files", files, "duration", time.Since(start))
+			if opts.Checksums != "none" {
+				dir, name := localFile(dst)
+				checksumName, err := writeChecksum(dir, name, opts)
+				if err != nil {
+					return err
+				}
+				logger.Info("write checksum", "src", dst, "dst", fsPath(dir, checksumName), "algorithm", opts.ChecksumAlgorithm)
+			}
+			if err := removeArchives(filepath.Dir(input), []string{input}, nil, opts); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(statusOut, msg("summary.converted", fs.NArg(), *to))
+	case "list":
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		output := fs.String("output", "table", msg("flag.listOutput"))
+		fs.Parse(args)
+		archives, err := numberedArchivesFromArgs(fs.Args(), opts.Prefix)
+		if err != nil {
+			return err
+		}
+		var listings []archiveListing
+		for _, archive := range archives {
+			listing, err := listArchive(archive)
+			if err != nil {
+				return err
+			}
+			listings = append(listings, listing)
+		}
+		return printListings(os.Stdout, listings, *output)
+	case "upload":
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		addUploadFlags(fs, &opts)
+		fs.Parse(args)
+		if opts.UploadEndpoint == "" {
+			return errors.New(msg("error.uploadNotConfigured"))
+		}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		client, err := newS3Client(opts)
+		if err != nil {
+			return err
+		}
+		archives, err := numberedArchivesFromArgs(fs.Args(), opts.Prefix)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, archive := range archives {
+			if _, err := uploadArchive(client, archive, opts); err != nil {
+				logger.Error("upload failed", "src", archive, "err", err)
+				failed++
+				continue
+			}
+			if opts.UploadDeleteLocal {
+				if err := deleteUploaded(filepath.Dir(archive), archive, opts); err != nil {
+					logger.Error("delete uploaded archive failed", "src", archive, "err", err)
+				}
+			}
+		}
+		fmt.Fprintln(statusOut, msg("summary.uploaded", len(archives)-failed, failed))
+		if failed > 0 {
+			return errors.New(msg("error.uploadFailed", failed))
+		}
+	case "push":
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		addPushFlags(fs, &opts)
+		fs.Parse(args)
+		if opts.PushTarget == "" {
+			return errors.New(msg("error.pushNotConfigured"))
+		}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		archives, err := numberedArchivesFromArgs(fs.Args(), opts.Prefix)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, archive := range archives {
+			if err := pushArchive(archive, opts); err != nil {
+				logger.Error("push failed", "src", archive, "err", err)
+				failed++
+			}
+		}
+		fmt.Fprintln(statusOut, msg("summary.pushed", len(archives)-failed, failed))
+		if failed > 0 {
+			return errors.New(msg("error.pushFailed", failed))
+		}
+	case "test":
+		fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, msg("flag.prefix"))
+		onlyWithPrefix := fs.Bool("only-with-prefix", opts.OnlyWithPrefix != nil && *opts.OnlyWithPrefix, msg("flag.testOnlyWithPrefix"))
+		fs.Parse(args)
+		archives, err := archivesFromArgs(fs.Args(), opts.Prefix, *onlyWithPrefix)
+		if err != nil {
+			return err
+		}
+		return testArchives(archives)
+	case "verify":
+		fs.Parse(args)
+		paths := fs.Args()
+		if len(paths) == 0 {
+			paths = []string{sourceDirectory}
+		}
+		entries, err := findChecksums(paths)
+		if err != nil {
+			return err
+		}
+		return verifyChecksums(entries)
+	case "restore":
+		addTrashFlags(fs, &opts)
+		all := fs.Bool("all", false, msg("flag.restoreAll"))
+		fs.StringVar(&opts.Prefix, "prefix", "", msg("flag.restorePrefix"))
+		fs.Parse(args)
+		return restoreFromTrash(resolveTrashDir(sourceDirectory, opts), opts.Prefix, *all, fs.Args())
+	default:
+		return errors.New(msg("error.unknownCommand", name))
+	}
+	return nil
+}
+
+func main() {
+	// 先根据环境变量和 -lang 参数确定语言，使参数说明也能本地化
+	locale = detectLocale()
+	if l := parseLocale(langFromArgs(os.Args[1:])); l != "" {
+		locale = l
+	}
+	logLevel := flag.String("log-level", "info", msg("flag.logLevel"))
+	logFormat := flag.String("log-format", "text", msg("flag.logFormat"))
+	logFile := flag.String("log-file", "", msg("flag.logFile"))
+	lang := flag.String("lang", "", msg("flag.lang"))
+	configPath := flag.String("config", "", msg("flag.config"))
+	profileName := flag.String("profile", "", msg("flag.profile"))
+	dir := flag.String("dir", "", msg("flag.dir"))
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), msg("usage.header", filepath.Base(os.Args[0])))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *lang != "" {
+		locale = parseLocale(*lang)
+		if _, ok := catalogs[locale]; !ok {
+			fmt.Fprintln(os.Stderr, msg("error.lang", *lang))
+			os.Exit(2)
+		}
+	}
+	closeLog, err := setupLogging(*logLevel, *logFormat, *logFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer closeLog()
+	if err := loadCodePages(); err != nil {
+		logger.Error("load code pages failed", "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	ex, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+	exeDir := filepath.Dir(ex)
+	sourceDirectory = exeDir // 默认处理程序所在目录，可通过 -dir 指定其他目录
+	if *dir != "" {
+		sourceDirectory = *dir
+	}
+
+	// 读取配置文件，作为交互提示和命令行参数的默认值
+	opts := defaultPackOptions()
+	if *configPath == "" {
+		*configPath = findConfigFile(sourceDirectory, exeDir)
+	}
+	if *configPath != "" {
+		opts, err = loadConfig(*configPath, *profileName)
+	} else if *profileName != "" {
+		err = errors.New(msg("error.noConfig", *profileName))
+	}
+	if err != nil {
+		logger.Error("load config failed", "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if flag.NArg() == 0 {
+		runInteractive(opts)
+		return
+	}
+	if err := runCommand(flag.Arg(0), flag.Args()[1:], opts); err != nil {
+		logger.Error("command failed", "command", flag.Arg(0), "err", err)
+		closeLog()
+		os.Exit(1)
 	}
 }
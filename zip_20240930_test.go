@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPlanBatches(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, size := range map[string]int{"a": 3, "b": 3, "c": 3, "d": 10, "e": 1} {
+		fsys[name] = &fstest.MapFile{Data: make([]byte, size)}
+	}
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		batchBy  string
+		maxFiles int
+		maxBytes int64
+		want     string
+	}{
+		{"count", 2, 0, "ab cd e"},
+		{"count", 5, 0, "abcde"},
+		{"count", 10, 0, "abcde"},
+		{"size", 0, 6, "ab c d e"}, // 超过上限的文件独占一批
+		{"size", 0, 100, "abcde"},
+		{"size", 0, 1, "a b c d e"},
+	}
+	for _, tt := range tests {
+		opts := defaultPackOptions()
+		opts.BatchBy, opts.MaxFiles, opts.MaxBatchBytes = tt.batchBy, tt.maxFiles, tt.maxBytes
+		var got []string
+		for _, batch := range planBatches(entries, opts) {
+			var names string
+			for _, entry := range batch {
+				names += entry.Name()
+			}
+			got = append(got, names)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("planBatches(%s, %d, %d) = %q, want %q", tt.batchBy, tt.maxFiles, tt.maxBytes, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		hidden, junk string
+		name         string
+		want         string
+	}{
+		{"skip", "skip", "a.txt", ""},
+		{"skip", "skip", "report.docx", ""},
+		{"skip", "skip", ".gitignore", "hidden"},
+		{"skip", "skip", ".git/config", "hidden"},
+		{"skip", "skip", "sub/.env", "hidden"},
+		{"skip", "skip", "./a.txt", ""},
+		{"skip", "skip", ".DS_Store", "junk"},
+		{"skip", "skip", "Thumbs.db", "junk"},
+		{"skip", "skip", "THUMBS.DB", "junk"},
+		{"skip", "skip", "sub/desktop.ini", "junk"},
+		{"skip", "skip", "~$report.docx", "junk"},
+		{"skip", "skip", "notes.txt~", "junk"},
+		{"skip", "skip", "a.swp", "junk"},
+		{"skip", "skip", "setup.exe.crdownload", "junk"},
+		{"include", "skip", ".gitignore", ""},
+		{"include", "skip", ".DS_Store", "junk"},
+		{"skip", "include", ".DS_Store", "hidden"},
+		{"skip", "include", "Thumbs.db", ""},
+		{"include", "include", ".DS_Store", ""},
+	}
+	for _, tt := range tests {
+		opts := defaultPackOptions()
+		opts.Hidden, opts.Junk = tt.hidden, tt.junk
+		if got := opts.skipReason(tt.name); got != tt.want {
+			t.Errorf("skipReason(%q) with hidden=%s junk=%s = %q, want %q", tt.name, tt.hidden, tt.junk, got, tt.want)
+		}
+	}
+}
+
+// zipNames 返回压缩包中按顺序排列的条目名
+func zipNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+// TestCompressFolderSymlinks 跟随指向目录的链接：指向上级目录的链接跳过，
+// 指向同一个非上级目录的多个链接都写入，不支持链接的文件系统上也能结束
+func TestCompressFolderSymlinks(t *testing.T) {
+	links := map[string]string{
+		"B/o1":       "../other",
+		"B/o2":       "../other",
+		"B/self":     ".",
+		"B/sub/up":   "..",
+		"B/sub/back": "../../B",
+	}
+	files := []string{"B/x", "B/sub/y", "other/z"}
+	want := "B/ o1/ z o2/ z sub/ y x"
+
+	t.Run("dir", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range files {
+			os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for name, target := range links {
+			if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+				t.Skip(err)
+			}
+		}
+		// 绝对路径的链接无法在 fsys 中解析，靠文件标识判断
+		if err := os.Symlink(filepath.Join(dir, "B"), filepath.Join(dir, "B/sub/abs")); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := compressFolder(&buf, dirFS(dir), "B", nil, defaultPackOptions(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(zipNames(t, buf.Bytes()), " "); got != want {
+			t.Errorf("entries = %s, want %s", got, want)
+		}
+	})
+
+	mapFS := fstest.MapFS{}
+	for _, name := range files {
+		mapFS[name] = &fstest.MapFile{Data: []byte(name), Mode: 0o644}
+	}
+	for name, target := range links {
+		mapFS[name] = &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink | 0o777}
+	}
+	t.Run("map", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := compressFolder(&buf, mapFS, "B", nil, defaultPackOptions(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(zipNames(t, buf.Bytes()), " "); got != want {
+			t.Errorf("entries = %s, want %s", got, want)
+		}
+	})
+	t.Run("opaque", func(t *testing.T) {
+		// 只有 Open 的文件系统无法读取链接也无法比较文件标识，由链接深度限制结束遍历
+		opaque := struct{ fs.FS }{fstest.MapFS{
+			"B/x":      mapFS["B/x"],
+			"B/sub/up": mapFS["B/sub/up"],
+		}}
+		var buf bytes.Buffer
+		if err := compressFolder(&buf, opaque, "B", nil, defaultPackOptions(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(zipNames(t, buf.Bytes())); got > 4*(maxSymlinkDepth+1) {
+			t.Errorf("%d entries, walk did not stop at the link depth limit", got)
+		}
+	})
+}